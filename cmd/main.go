@@ -12,13 +12,21 @@ import (
 	historyDelivery "github.com/vvinokurshin/AvitoInternship/internal/history/delivery"
 	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository/postgres"
 	historyUseCase "github.com/vvinokurshin/AvitoInternship/internal/history/usecase"
+	layerDelivery "github.com/vvinokurshin/AvitoInternship/internal/layer/delivery"
+	layerRepository "github.com/vvinokurshin/AvitoInternship/internal/layer/repository/postgres"
+	layerUseCase "github.com/vvinokurshin/AvitoInternship/internal/layer/usecase"
+	reportDelivery "github.com/vvinokurshin/AvitoInternship/internal/report/delivery"
+	reportRepository "github.com/vvinokurshin/AvitoInternship/internal/report/repository/postgres"
+	reportUseCase "github.com/vvinokurshin/AvitoInternship/internal/report/usecase"
 	segmentDelivery "github.com/vvinokurshin/AvitoInternship/internal/segment/delivery"
 	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository/postgres"
 	segmentUseCase "github.com/vvinokurshin/AvitoInternship/internal/segment/usecase"
+	transaction "github.com/vvinokurshin/AvitoInternship/internal/transaction/postgres"
 	userDelivery "github.com/vvinokurshin/AvitoInternship/internal/user/delivery"
 	userRepository "github.com/vvinokurshin/AvitoInternship/internal/user/repository/postgres"
 	userUseCase "github.com/vvinokurshin/AvitoInternship/internal/user/usecase"
 	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/storage"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"net/http"
@@ -55,22 +63,41 @@ func main() {
 		log.Fatal(err)
 	}
 
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var files http.Handler
+	if local, ok := store.(*storage.Local); ok {
+		files = local
+	}
+
 	userRepo := userRepository.New(cfg, db)
-	segmentRepo, err := segmentRepository.New(cfg, db)
+	segmentRepo, err := segmentRepository.New(cfg, db, historyRepository.NewWriter(cfg))
 	if err != nil {
 		log.Fatal(err)
 	}
 	historyRepo := historyRepository.New(cfg, db)
-	userUC := userUseCase.New(cfg, userRepo)
-	segmentUC := segmentUseCase.New(cfg, segmentRepo, userRepo)
+	layerRepo := layerRepository.New(cfg, db)
+	reportRepo := reportRepository.New(cfg, db)
+	uow := transaction.New(cfg, db, segmentRepo)
+	userUC := userUseCase.New(cfg, uow, userRepo, segmentRepo, historyRepo)
+	segmentUC := segmentUseCase.New(cfg, uow, segmentRepo, userRepo, layerRepo)
+	layerUC := layerUseCase.New(cfg, layerRepo, segmentRepo)
 	historyUC := historyUseCase.New(cfg, historyRepo)
+	reportUC, err := reportUseCase.New(cfg, reportRepo, historyUC, store)
+	if err != nil {
+		log.Fatal(err)
+	}
 	userDel := userDelivery.New(cfg, userUC)
 	segmentDel := segmentDelivery.New(cfg, segmentUC)
+	layerDel := layerDelivery.New(cfg, layerUC)
 	historyDel := historyDelivery.New(cfg, historyUC)
+	reportDel := reportDelivery.New(cfg, reportUC)
 
 	router := mux.NewRouter()
 	router.PathPrefix("/swagger").Handler(httpSwagger.WrapHandler)
-	r.AddRoutes(router, cfg, userDel, segmentDel, historyDel)
+	r.AddRoutes(router, cfg, userDel, segmentDel, layerDel, historyDel, reportDel, files)
 
 	server := http.Server{
 		Addr:         ":" + cfg.Project.Port,
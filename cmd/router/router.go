@@ -4,13 +4,15 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	historyDelivery "github.com/vvinokurshin/AvitoInternship/internal/history/delivery"
+	layerDelivery "github.com/vvinokurshin/AvitoInternship/internal/layer/delivery"
+	reportDelivery "github.com/vvinokurshin/AvitoInternship/internal/report/delivery"
 	segmentDelivery "github.com/vvinokurshin/AvitoInternship/internal/segment/delivery"
 	userDelivery "github.com/vvinokurshin/AvitoInternship/internal/user/delivery"
 	"net/http"
 )
 
 func AddRoutes(r *mux.Router, cfg *config.Config, userD userDelivery.DeliveryI, segmentD segmentDelivery.DeliveryI,
-	historyD historyDelivery.DeliveryI) {
+	layerD layerDelivery.DeliveryI, historyD historyDelivery.DeliveryI, reportD reportDelivery.DeliveryI, files http.Handler) {
 	// User
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUserCreate, userD.CreateUser).Methods(http.MethodPost)
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUser, userD.EditUser).Methods(http.MethodPut)
@@ -18,12 +20,38 @@ func AddRoutes(r *mux.Router, cfg *config.Config, userD userDelivery.DeliveryI,
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUser, userD.GetUser).Methods(http.MethodGet)
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUserSegments, segmentD.GetUserSegments).Methods(http.MethodGet)
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUserEditSegments, segmentD.EditUserSegments).Methods(http.MethodPut)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUsersSegments, segmentD.GetUsersSegments).Methods(http.MethodPost)
 
 	// Segment
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentCreate, segmentD.CreateSegment).Methods(http.MethodPost)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegment, segmentD.UpdateSegment).Methods(http.MethodPut)
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegment, segmentD.DeleteSegment).Methods(http.MethodDelete)
 	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegment, segmentD.GetSegment).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentRestore, segmentD.RestoreSegment).Methods(http.MethodPost)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentPurge, segmentD.PurgeSegment).Methods(http.MethodDelete)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentUsers, segmentD.GetSegmentUsers).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentUsers, segmentD.AddSegmentUsers).Methods(http.MethodPost)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentUsers, segmentD.RemoveSegmentUsers).Methods(http.MethodDelete)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegments, segmentD.GetSegments).Methods(http.MethodGet)
+
+	// Layer
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteLayerCreate, layerD.CreateLayer).Methods(http.MethodPost)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteLayer, layerD.GetLayer).Methods(http.MethodGet)
 
 	// History
-	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteGetHistory, historyD.GetHistoryCSV).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteGetHistory, historyD.GetHistory).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUserHistory, historyD.GetUserHistory).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteUserSnapshot, historyD.GetUserSnapshot).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteSegmentSnapshot, historyD.GetSegmentSnapshot).
+		Methods(http.MethodGet)
+
+	// Report
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteReportCreate, reportD.CreateReport).Methods(http.MethodPost)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteReport, reportD.GetReport).Methods(http.MethodGet)
+	r.HandleFunc(cfg.Routes.RoutePrefix+cfg.Routes.RouteReportFile, reportD.DownloadReport).Methods(http.MethodGet)
+
+	// Files are served by the application only by the local storage, S3 links point to the bucket
+	if files != nil {
+		r.Handle(cfg.Routes.RoutePrefix+cfg.Routes.RouteFiles+"/{name}", files).Methods(http.MethodGet)
+	}
 }
@@ -18,17 +18,19 @@ const docTemplate = `{
     "paths": {
         "/history": {
             "get": {
-                "description": "getting the history of adding/removing users in a segment for a specific month",
+                "description": "getting the history of adding/removing users in a segment for a specific month, with the actor and reason of each change, as a file: CSV by default, another format is selected by format or the Accept header",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
                 ],
                 "tags": [
                     "history"
                 ],
-                "summary": "GetHistoryCSV",
+                "summary": "GetHistory",
                 "parameters": [
                     {
                         "type": "integer",
@@ -43,6 +45,18 @@ const docTemplate = `{
                         "name": "month",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv, excel (CSV with BOM and CRLF), ndjson or parquet",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "column delimiter of csv and excel, ; by default",
+                        "name": "delimiter",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -50,7 +64,7 @@ const docTemplate = `{
                         "description": "downloaded file"
                     },
                     "400": {
-                        "description": "invalid parameters",
+                        "description": "delimiter is invalid. it must be a single character other than a quote or a line break, and only for csv or excel",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -64,9 +78,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/segment/create": {
+        "/layer/create": {
             "post": {
-                "description": "create segment",
+                "description": "create layer of mutually exclusive segments",
                 "consumes": [
                     "application/json"
                 ],
@@ -74,35 +88,35 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "segment"
+                    "layer"
                 ],
-                "summary": "CreateSegment",
+                "summary": "CreateLayer",
                 "parameters": [
                     {
-                        "description": "form segment",
-                        "name": "segment",
+                        "description": "form layer",
+                        "name": "layer",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.FormSegment"
+                            "$ref": "#/definitions/models.FormLayer"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "segment created",
+                        "description": "layer created",
                         "schema": {
-                            "$ref": "#/definitions/models.SegmentResponse"
+                            "$ref": "#/definitions/models.LayerResponse"
                         }
                     },
                     "400": {
-                        "description": "percent is invalid",
+                        "description": "invalid form",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
                     "409": {
-                        "description": "segment with this slug already exists",
+                        "description": "layer with this name already exists",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -116,9 +130,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/segment/{slug}": {
+        "/layer/{name}": {
             "get": {
-                "description": "get segment",
+                "description": "get layer with its segments",
                 "consumes": [
                     "application/json"
                 ],
@@ -126,23 +140,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "segment"
+                    "layer"
                 ],
-                "summary": "GetSegment",
+                "summary": "GetLayer",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "slug",
-                        "name": "slug",
+                        "description": "name",
+                        "name": "name",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success get segment info",
+                        "description": "success get layer info",
                         "schema": {
-                            "$ref": "#/definitions/models.SegmentResponse"
+                            "$ref": "#/definitions/models.LayerResponse"
                         }
                     },
                     "400": {
@@ -152,7 +166,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "segment not found",
+                        "description": "layer not found",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -164,9 +178,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "delete segment",
+            }
+        },
+        "/reports": {
+            "post": {
+                "description": "queue a history report: the monthly history of all users (type history) or the history of a user (type userHistory)",
                 "consumes": [
                     "application/json"
                 ],
@@ -174,36 +190,41 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "segment"
+                    "report"
                 ],
-                "summary": "DeleteSegment",
+                "summary": "CreateReport",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "slug",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
+                        "description": "form report",
+                        "name": "report",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FormReport"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "segment deleted"
+                    "202": {
+                        "description": "report queued",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReportResponse"
+                        }
                     },
                     "400": {
-                        "description": "invalid url",
+                        "description": "period is invalid. format: RFC 3339 or YYYY-MM-DD, from before to",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
-                    "404": {
-                        "description": "segment not found",
+                    "500": {
+                        "description": "internal server error",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
-                    "500": {
-                        "description": "internal server error",
+                    "503": {
+                        "description": "report queue is full, try again later",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -211,9 +232,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/create": {
-            "post": {
-                "description": "create user",
+        "/reports/{id}": {
+            "get": {
+                "description": "get status of a report and a signed url to download it when it is done",
                 "consumes": [
                     "application/json"
                 ],
@@ -221,35 +242,33 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "report"
                 ],
-                "summary": "CreateUser",
+                "summary": "GetReport",
                 "parameters": [
                     {
-                        "description": "form user",
-                        "name": "segment",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.FormUser"
-                        }
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "user created",
+                        "description": "success get report",
                         "schema": {
-                            "$ref": "#/definitions/models.UserResponse"
+                            "$ref": "#/definitions/models.ReportResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid form",
+                        "description": "invalid url",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
-                    "409": {
-                        "description": "user with this nickname already exists",
+                    "404": {
+                        "description": "report not found",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -263,9 +282,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/{id}": {
+        "/reports/{id}/file": {
             "get": {
-                "description": "get user",
+                "description": "redirect to a fresh signed url of the file of a finished report",
                 "consumes": [
                     "application/json"
                 ],
@@ -273,9 +292,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "report"
                 ],
-                "summary": "GetUser",
+                "summary": "DownloadReport",
                 "parameters": [
                     {
                         "type": "integer",
@@ -286,11 +305,8 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "success get user info",
-                        "schema": {
-                            "$ref": "#/definitions/models.UserResponse"
-                        }
+                    "302": {
+                        "description": "redirect to the file"
                     },
                     "400": {
                         "description": "invalid url",
@@ -299,7 +315,19 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "user not found",
+                        "description": "report not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "report is not ready",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "410": {
+                        "description": "report has expired",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -311,9 +339,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "edit user",
+            }
+        },
+        "/segment/create": {
+            "post": {
+                "description": "create segment",
                 "consumes": [
                     "application/json"
                 ],
@@ -321,48 +351,47 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "segment"
                 ],
-                "summary": "EditUser",
+                "summary": "CreateSegment",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "id",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "form user",
+                        "description": "form segment",
                         "name": "segment",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.FormUser"
+                            "$ref": "#/definitions/models.FormSegment"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "user info edited",
+                        "description": "segment created",
                         "schema": {
-                            "$ref": "#/definitions/models.UserResponse"
+                            "$ref": "#/definitions/models.SegmentResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid form",
-                        "schema": {
-                            "$ref": "#/definitions/errors.JSONError"
-                        }
-                    },
-                    "404": {
-                        "description": "user not found",
+                        "description": "startsAt must be before endsAt",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
                     "409": {
-                        "description": "user with this nickname already exists",
+                        "description": "segment with this slug already exists",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -374,9 +403,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "delete user",
+            }
+        },
+        "/segment/{slug}": {
+            "get": {
+                "description": "get segment",
                 "consumes": [
                     "application/json"
                 ],
@@ -384,21 +415,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "segment"
                 ],
-                "summary": "DeleteUser",
+                "summary": "GetSegment",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "id",
-                        "name": "id",
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "user deleted"
+                        "description": "success get segment info",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentResponse"
+                        }
                     },
                     "400": {
                         "description": "invalid url",
@@ -407,7 +441,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "user not found",
+                        "description": "segment not found",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -419,11 +453,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/user/{id}/segments": {
-            "get": {
-                "description": "get user's segment",
+            },
+            "put": {
+                "description": "change segment's rollout percent or targeting rule",
                 "consumes": [
                     "application/json"
                 ],
@@ -433,31 +465,52 @@ const docTemplate = `{
                 "tags": [
                     "segment"
                 ],
-                "summary": "GetUserSegments",
+                "summary": "UpdateSegment",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "id",
-                        "name": "id",
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "form update segment",
+                        "name": "segment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FormUpdateSegment"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success get user's segments",
+                        "description": "segment updated",
                         "schema": {
-                            "$ref": "#/definitions/models.SegmentsResponse"
+                            "$ref": "#/definitions/models.SegmentResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid url",
+                        "description": "startsAt must be before endsAt",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
                     "404": {
-                        "description": "user not found",
+                        "description": "segment not found",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -469,11 +522,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/user/{id}/segments/edit": {
-            "put": {
-                "description": "edit user's segment",
+            },
+            "delete": {
+                "description": "archive segment: it is hidden from users, its slug stays reserved and history is kept",
                 "consumes": [
                     "application/json"
                 ],
@@ -483,34 +534,40 @@ const docTemplate = `{
                 "tags": [
                     "segment"
                 ],
-                "summary": "EditUserSegments",
+                "summary": "DeleteSegment",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "id",
-                        "name": "id",
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "form segment",
-                        "name": "segment",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.FormEditSegments"
-                        }
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "reason or ticket recorded in history",
+                        "name": "reason",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success edit user's segments",
-                        "schema": {
-                            "$ref": "#/definitions/models.SegmentsResponse"
-                        }
+                        "description": "segment archived"
                     },
                     "400": {
-                        "description": "field until is invalid. format: YYYY-MM-DD HH:MM",
+                        "description": "invalid url",
                         "schema": {
                             "$ref": "#/definitions/errors.JSONError"
                         }
@@ -521,6 +578,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.JSONError"
                         }
                     },
+                    "409": {
+                        "description": "segment is archived",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
                     "500": {
                         "description": "internal server error",
                         "schema": {
@@ -529,113 +592,1580 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "errors.JSONError": {
-            "type": "object",
-            "properties": {
-                "code": {
-                    "type": "integer"
-                },
-                "message": {
-                    "type": "string"
-                }
-            }
         },
-        "models.AddUserToSegment": {
-            "type": "object",
-            "properties": {
-                "segmentSlug": {
-                    "type": "string"
-                },
-                "until": {
-                    "type": "string"
-                }
-            }
+        "/segment/{slug}/history/snapshot": {
+            "get": {
+                "description": "restoring from history the members of the segment at a moment in the past, page by page ordered by user id; the segment may be deleted since",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "history"
+                ],
+                "summary": "GetSegmentSnapshot",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "moment: RFC 3339 or YYYY-MM-DD (midnight UTC), now by default",
+                        "name": "at",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, 100 by default, up to 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get segment snapshot",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentSnapshotResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "limit is invalid",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/segment/{slug}/purge": {
+            "delete": {
+                "description": "irreversibly delete archived segment, history is kept",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "PurgeSegment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "segment slug repeated as confirmation",
+                        "name": "confirm",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "segment purged"
+                    },
+                    "400": {
+                        "description": "purge must be confirmed with the segment slug",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "segment not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "segment must be archived before purge",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/segment/{slug}/restore": {
+            "post": {
+                "description": "restore archived segment",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "RestoreSegment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "reason or ticket recorded in history",
+                        "name": "reason",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "segment restored",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid url",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "segment not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "layer has no free traffic for this percent",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/segment/{slug}/users": {
+            "get": {
+                "description": "get members of the segment page by page ordered by user id, count is the number of all members matching the filters. members of rule segments are matched on read and cannot be listed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "GetSegmentUsers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "MANUAL, PERCENTAGE, IMPORT or API",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only memberships with until before the moment: RFC 3339 or YYYY-MM-DD",
+                        "name": "expiringBefore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only memberships added after the moment: RFC 3339 or YYYY-MM-DD",
+                        "name": "addedAfter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, 100 by default, up to 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get segment users",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentUsersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "members of rule segments are matched on read and not stored, so they cannot be listed",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "segment not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "add many users to the segment in batches, one transaction per batch; unknown users and users of another segment of the exclusive layer are skipped and reported\nthe body is a JSON form or a CSV with one user ID per line, sent as text/csv or as the file field of multipart/form-data; with a CSV until, ttl, source and reason are query parameters",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "AddSegmentUsers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "user IDs with until or ttl, source (IMPORT by default) and reason",
+                        "name": "form",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.FormSegmentUsersBulk"
+                        }
+                    },
+                    {
+                        "type": "file",
+                        "description": "CSV with one user ID per line",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "until for a CSV",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ttl for a CSV",
+                        "name": "ttl",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "source for a CSV: MANUAL, IMPORT or API",
+                        "name": "source",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success add users to segment",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentUsersBulkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "ttl is invalid. format: positive duration like 48h or 90m",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "segment not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "segment is archived",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "415": {
+                        "description": "content type is not supported. use application/json, text/csv or multipart/form-data",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "remove many users from the segment in batches, one transaction per batch; unknown users are skipped and reported\nthe body is a JSON form or a CSV with one user ID per line as for adding, until, ttl and source are ignored",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "RemoveSegmentUsers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "user IDs and reason",
+                        "name": "form",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.FormSegmentUsersBulk"
+                        }
+                    },
+                    {
+                        "type": "file",
+                        "description": "CSV with one user ID per line",
+                        "name": "file",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success remove users from segment",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentUsersBulkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "user IDs are invalid. send a JSON array userIDs or a CSV with one ID per line",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "segment not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "segment is archived",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "415": {
+                        "description": "content type is not supported. use application/json, text/csv or multipart/form-data",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/segments": {
+            "get": {
+                "description": "get all segments, archived included, with the number of members whose membership has not expired, null for rule segments",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "GetSegments",
+                "responses": {
+                    "200": {
+                        "description": "success get segments",
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentSummariesResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/create": {
+            "post": {
+                "description": "create user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "CreateUser",
+                "parameters": [
+                    {
+                        "description": "form user",
+                        "name": "segment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FormUser"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "user created",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid form",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "user with this nickname already exists",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}": {
+            "get": {
+                "description": "get user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "GetUser",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get user info",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid url",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "user not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "edit user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "EditUser",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "form user",
+                        "name": "segment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FormUser"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "user info edited",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid form",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "user not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "409": {
+                        "description": "user with this nickname already exists",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "delete user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "DeleteUser",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "reason or ticket recorded in history",
+                        "name": "reason",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "user deleted"
+                    },
+                    "400": {
+                        "description": "invalid url",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "user not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/history": {
+            "get": {
+                "description": "getting the history of a user's segments for an arbitrary period, page by page, or all records as a file when format or the Accept header names an export format",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "history"
+                ],
+                "summary": "GetUserHistory",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "start of the period, inclusive: RFC 3339 or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end of the period, exclusive: RFC 3339 or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "segment slug",
+                        "name": "segment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, 100 by default, up to 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv, excel (CSV with BOM and CRLF), ndjson or parquet to download all records as a file",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "column delimiter of csv and excel, ; by default",
+                        "name": "delimiter",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get user history",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserHistoryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "delimiter is invalid. it must be a single character other than a quote or a line break, and only for csv or excel",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/history/snapshot": {
+            "get": {
+                "description": "restoring from history the segments the user had at a moment in the past, with the last change of each membership",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "history"
+                ],
+                "summary": "GetUserSnapshot",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "moment: RFC 3339 or YYYY-MM-DD (midnight UTC), now by default",
+                        "name": "at",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get user snapshot",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserSnapshotResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "at is invalid. format: RFC 3339 or YYYY-MM-DD",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/segments": {
+            "get": {
+                "description": "get user's segment",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "GetUserSegments",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get user's segments",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserSegmentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid url",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "user not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/segments/edit": {
+            "put": {
+                "description": "edit user's segment in one transaction, all unknown slugs are listed in details",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "EditUserSegments",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "form segment",
+                        "name": "segment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FormEditSegments"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "identity of the caller recorded in history",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "request ID recorded in history",
+                        "name": "X-Request-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success edit user's segments",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserSegmentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "segment is both added and removed or added twice",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "404": {
+                        "description": "segment not found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/segments:batchGet": {
+            "post": {
+                "description": "get active segments of many users at once, the users are keyed by ID and missing users are listed in unknownUserIDs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "segment"
+                ],
+                "summary": "GetUsersSegments",
+                "parameters": [
+                    {
+                        "description": "user IDs, up to bulk.batch_get_limit",
+                        "name": "form",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FormUsersSegments"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success get users' segments",
+                        "schema": {
+                            "$ref": "#/definitions/models.UsersSegmentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid form",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    },
+                    "500": {
+                        "description": "internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.JSONError"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "errors.JSONError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "details": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.AddUserToSegment": {
+            "type": "object",
+            "properties": {
+                "segmentSlug": {
+                    "type": "string"
+                },
+                "ttl": {
+                    "type": "string"
+                },
+                "until": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FormEditSegments": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
+                },
+                "segmentsToAdd": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AddUserToSegment"
+                    }
+                },
+                "segmentsToRemove": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "source": {
+                    "type": "string",
+                    "enum": [
+                        "MANUAL",
+                        "IMPORT",
+                        "API"
+                    ]
+                }
+            }
+        },
+        "models.FormLayer": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "exclusive": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "salt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FormReport": {
+            "type": "object"
+        },
+        "models.FormSegment": {
+            "type": "object",
+            "required": [
+                "slug"
+            ],
+            "properties": {
+                "defaultTTL": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "layer": {
+                    "type": "string"
+                },
+                "percent": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
+                },
+                "rule": {
+                    "type": "string"
+                },
+                "salt": {
+                    "type": "string"
+                },
+                "slug": {
+                    "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
+                }
+            }
+        },
+        "models.FormSegmentUsersBulk": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
+                },
+                "source": {
+                    "type": "string",
+                    "enum": [
+                        "MANUAL",
+                        "IMPORT",
+                        "API"
+                    ]
+                },
+                "ttl": {
+                    "type": "string"
+                },
+                "until": {
+                    "type": "string"
+                },
+                "userIDs": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.FormUpdateSegment": {
+            "type": "object",
+            "properties": {
+                "defaultTTL": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "percent": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
+                },
+                "rule": {
+                    "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FormUser": {
+            "type": "object",
+            "required": [
+                "firstName",
+                "lastName",
+                "username"
+            ],
+            "properties": {
+                "attributes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "firstName": {
+                    "type": "string"
+                },
+                "lastName": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FormUsersSegments": {
+            "type": "object",
+            "properties": {
+                "userIDs": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.History": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "datetime": {
+                    "type": "string"
+                },
+                "operation": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "recordID": {
+                    "type": "integer"
+                },
+                "segmentSlug": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "userID": {
+                    "type": "integer"
+                },
+                "variant": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Layer": {
+            "type": "object",
+            "properties": {
+                "exclusive": {
+                    "type": "boolean"
+                },
+                "layerID": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "salt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.LayerResponse": {
+            "type": "object",
+            "properties": {
+                "layer": {
+                    "$ref": "#/definitions/models.Layer"
+                },
+                "segments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Segment"
+                    }
+                }
+            }
+        },
+        "models.Membership": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "changedAt": {
+                    "type": "string"
+                },
+                "lastOperation": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "segmentSlug": {
+                    "type": "string"
+                },
+                "since": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "userID": {
+                    "type": "integer"
+                },
+                "variant": {
+                    "type": "string"
+                }
+            }
         },
-        "models.FormEditSegments": {
+        "models.Report": {
             "type": "object",
             "properties": {
-                "segmentsToAdd": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/models.AddUserToSegment"
-                    }
+                "createdAt": {
+                    "type": "string"
                 },
-                "segmentsToRemove": {
-                    "type": "array",
-                    "items": {
-                        "type": "string"
-                    }
+                "error": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "params": {
+                    "$ref": "#/definitions/models.FormReport"
+                },
+                "reportID": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         },
-        "models.FormSegment": {
+        "models.ReportResponse": {
+            "type": "object",
+            "properties": {
+                "report": {
+                    "$ref": "#/definitions/models.Report"
+                }
+            }
+        },
+        "models.Segment": {
             "type": "object",
-            "required": [
-                "slug"
-            ],
             "properties": {
+                "archivedAt": {
+                    "type": "string"
+                },
+                "defaultTTL": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "layerID": {
+                    "type": "integer"
+                },
+                "layerOffset": {
+                    "type": "integer"
+                },
                 "percent": {
                     "type": "integer"
                 },
+                "rule": {
+                    "type": "string"
+                },
+                "salt": {
+                    "type": "string"
+                },
+                "segmentID": {
+                    "type": "integer"
+                },
                 "slug": {
                     "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
                 }
             }
         },
-        "models.FormUser": {
+        "models.SegmentResponse": {
             "type": "object",
-            "required": [
-                "firstName",
-                "lastName",
-                "username"
-            ],
             "properties": {
-                "firstName": {
+                "segment": {
+                    "$ref": "#/definitions/models.Segment"
+                }
+            }
+        },
+        "models.SegmentSnapshotResponse": {
+            "type": "object",
+            "properties": {
+                "at": {
                     "type": "string"
                 },
-                "lastName": {
+                "count": {
+                    "type": "integer"
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Membership"
+                    }
+                },
+                "nextCursor": {
                     "type": "string"
                 },
-                "username": {
+                "slug": {
                     "type": "string"
                 }
             }
         },
-        "models.Segment": {
+        "models.SegmentSummariesResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "segments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.SegmentSummary"
+                    }
+                }
+            }
+        },
+        "models.SegmentSummary": {
             "type": "object",
             "properties": {
+                "archivedAt": {
+                    "type": "string"
+                },
+                "defaultTTL": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "layerID": {
+                    "type": "integer"
+                },
+                "layerOffset": {
+                    "type": "integer"
+                },
+                "members": {
+                    "type": "integer"
+                },
                 "percent": {
                     "type": "integer"
                 },
+                "rule": {
+                    "type": "string"
+                },
+                "salt": {
+                    "type": "string"
+                },
                 "segmentID": {
                     "type": "integer"
                 },
                 "slug": {
                     "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
                 }
             }
         },
-        "models.SegmentResponse": {
+        "models.SegmentUser": {
             "type": "object",
             "properties": {
-                "segment": {
-                    "$ref": "#/definitions/models.Segment"
+                "addedAt": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "until": {
+                    "type": "string"
+                },
+                "userID": {
+                    "type": "integer"
+                },
+                "variant": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.SegmentUsersBulkResponse": {
+            "type": "object",
+            "properties": {
+                "conflictingUserIDs": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "unknownUserIDs": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
                 }
             }
         },
-        "models.SegmentsResponse": {
+        "models.SegmentUsersResponse": {
             "type": "object",
             "properties": {
                 "count": {
                     "type": "integer"
                 },
-                "segments": {
+                "nextCursor": {
+                    "type": "string"
+                },
+                "users": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/models.Segment"
+                        "$ref": "#/definitions/models.SegmentUser"
                     }
                 }
             }
@@ -643,6 +2173,12 @@ const docTemplate = `{
         "models.User": {
             "type": "object",
             "properties": {
+                "attributes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "firstName": {
                     "type": "string"
                 },
@@ -657,6 +2193,23 @@ const docTemplate = `{
                 }
             }
         },
+        "models.UserHistoryResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
+                "records": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.History"
+                    }
+                }
+            }
+        },
         "models.UserResponse": {
             "type": "object",
             "properties": {
@@ -664,6 +2217,128 @@ const docTemplate = `{
                     "$ref": "#/definitions/models.User"
                 }
             }
+        },
+        "models.UserSegment": {
+            "type": "object",
+            "properties": {
+                "archivedAt": {
+                    "type": "string"
+                },
+                "defaultTTL": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "layerID": {
+                    "type": "integer"
+                },
+                "layerOffset": {
+                    "type": "integer"
+                },
+                "percent": {
+                    "type": "integer"
+                },
+                "rule": {
+                    "type": "string"
+                },
+                "salt": {
+                    "type": "string"
+                },
+                "segmentID": {
+                    "type": "integer"
+                },
+                "slug": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "until": {
+                    "type": "string"
+                },
+                "variant": {
+                    "type": "string"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
+                }
+            }
+        },
+        "models.UserSegmentsResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "segments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.UserSegment"
+                    }
+                }
+            }
+        },
+        "models.UserSnapshotResponse": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "segments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Membership"
+                    }
+                },
+                "userID": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.UsersSegmentsResponse": {
+            "type": "object",
+            "properties": {
+                "unknownUserIDs": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "users": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "$ref": "#/definitions/models.UserSegment"
+                        }
+                    }
+                }
+            }
+        },
+        "models.Variant": {
+            "type": "object",
+            "required": [
+                "name",
+                "weight"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "weight": {
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
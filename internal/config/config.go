@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/pkg/errors"
+	"time"
 )
 
 type Config struct {
@@ -28,6 +29,8 @@ type Config struct {
 		DBSegmentTableName string `yaml:"segment_table_name" env-default:"segments"`
 		DBU2STableName     string `yaml:"u2s_table_name" env-default:"users2segments"`
 		DBHistoryTableName string `yaml:"history_table_name" env-default:"history"`
+		DBLayerTableName   string `yaml:"layer_table_name" env-default:"layers"`
+		DBReportTableName  string `yaml:"report_table_name" env-default:"reports"`
 		//DBTimeFormat       string `yaml:"time_format" env-default:"2006-01-02T15:04:05Z"`
 	} `yaml:"db"`
 
@@ -39,18 +42,74 @@ type Config struct {
 		RouteUser             string `yaml:"route_user" env-default:"/user/{id:[0-9]+}"`
 		RouteUserSegments     string `yaml:"route_user_segments" env-default:"/user/{id:[0-9]+}/segments"`
 		RouteUserEditSegments string `yaml:"route_user_edit_segments" env-default:"/user/{id:[0-9]+}/segments/edit"`
+		RouteUsersSegments    string `yaml:"route_users_segments" env-default:"/users/segments:batchGet"`
 
 		// SegmentRoutes
-		RouteSegmentCreate string `yaml:"route_segment_create" env-default:"/segment/create"`
-		RouteSegment       string `yaml:"route_segment" env-default:"/segment/{slug}"`
+		RouteSegmentCreate  string `yaml:"route_segment_create" env-default:"/segment/create"`
+		RouteSegment        string `yaml:"route_segment" env-default:"/segment/{slug}"`
+		RouteSegmentRestore string `yaml:"route_segment_restore" env-default:"/segment/{slug}/restore"`
+		RouteSegmentPurge   string `yaml:"route_segment_purge" env-default:"/segment/{slug}/purge"`
+		RouteSegmentUsers   string `yaml:"route_segment_users" env-default:"/segment/{slug}/users"`
+		RouteSegments       string `yaml:"route_segments" env-default:"/segments"`
+
+		// LayerRoutes
+		RouteLayerCreate string `yaml:"route_layer_create" env-default:"/layer/create"`
+		RouteLayer       string `yaml:"route_layer" env-default:"/layer/{name}"`
 
 		// History
-		RouteGetHistory string `yaml:"route_history" env-default:"/history"`
+		RouteGetHistory      string `yaml:"route_history" env-default:"/history"`
+		RouteUserHistory     string `yaml:"route_user_history" env-default:"/user/{id:[0-9]+}/history"`
+		RouteUserSnapshot    string `yaml:"route_user_snapshot" env-default:"/user/{id:[0-9]+}/history/snapshot"`
+		RouteSegmentSnapshot string `yaml:"route_segment_snapshot" env-default:"/segment/{slug}/history/snapshot"`
+
+		// ReportRoutes
+		RouteReportCreate string `yaml:"route_report_create" env-default:"/reports"`
+		RouteReport       string `yaml:"route_report" env-default:"/reports/{id:[0-9]+}"`
+		RouteReportFile   string `yaml:"route_report_file" env-default:"/reports/{id:[0-9]+}/file"`
+		RouteFiles        string `yaml:"route_files" env-default:"/files"`
 	} `yaml:"routes"`
 
-	//History struct {
-	//	TimeFormat string `yaml:"time_format" env-default:"2006-01-02T15:04:05.999999Z"`
-	//}
+	Expiry struct {
+		// PollInterval is how often memberships ending before the next poll are looked up and armed with timers.
+		PollInterval time.Duration `yaml:"poll_interval" env-default:"1m"`
+	} `yaml:"expiry"`
+
+	Bulk struct {
+		// BatchSize is how many user IDs of a bulk membership request are applied in one transaction.
+		BatchSize int `yaml:"batch_size" env-default:"1000"`
+		MaxUsers  int `yaml:"max_users" env-default:"500000"`
+		// BatchGetLimit is how many users can be resolved by one batchGet of segments.
+		BatchGetLimit int `yaml:"batch_get_limit" env-default:"1000"`
+	} `yaml:"bulk"`
+
+	Reports struct {
+		Workers   int `yaml:"workers" env-default:"4"`
+		QueueSize int `yaml:"queue_size" env-default:"100"`
+		// Retention is how long a finished report file can be downloaded.
+		Retention time.Duration `yaml:"retention" env-default:"24h"`
+		// Lease is how long a replica holds a running report without renewing it; reports whose lease ran out
+		// are taken over by other replicas.
+		Lease time.Duration `yaml:"lease" env-default:"1m"`
+	} `yaml:"reports"`
+
+	Storage struct {
+		// Backend is local (a directory of this instance) or s3 (a bucket shared by replicas).
+		Backend  string `yaml:"backend" env-default:"local"`
+		LocalDir string `yaml:"local_dir" env-default:"history/"`
+		// URLKey signs download links of the local storage.
+		URLKey      string `env:"STORAGE_URL_KEY"`
+		S3Endpoint  string `yaml:"s3_endpoint"`
+		S3Region    string `yaml:"s3_region" env-default:"us-east-1"`
+		S3Bucket    string `yaml:"s3_bucket"`
+		S3AccessKey string `env:"S3_ACCESS_KEY"`
+		S3SecretKey string `env:"S3_SECRET_KEY"`
+	} `yaml:"storage"`
+
+	History struct {
+		//TimeFormat string `yaml:"time_format" env-default:"2006-01-02T15:04:05.999999Z"`
+		PseudonymizeDeletedUsers bool   `yaml:"pseudonymize_deleted_users" env-default:"false"`
+		PseudonymKey             string `env:"HISTORY_PSEUDONYM_KEY"`
+	} `yaml:"history"`
 }
 
 func Parse(path string) (*Config, error) {
@@ -59,5 +118,10 @@ func Parse(path string) (*Config, error) {
 		return nil, errors.Wrap(err, "parse config")
 	}
 
+	// an HMAC with an empty key is reversed by enumerating user ids
+	if cfg.History.PseudonymizeDeletedUsers && cfg.History.PseudonymKey == "" {
+		return nil, errors.New("parse config: pseudonymize_deleted_users requires HISTORY_PSEUDONYM_KEY")
+	}
+
 	return &cfg, nil
 }
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("error while writing config: %s", err)
+	}
+
+	return path
+}
+
+func TestParse_PseudonymKeyRequired(t *testing.T) {
+	path := writeConfig(t, "logger:\n  logs_use_std_out: true\nhistory:\n  pseudonymize_deleted_users: true\n")
+
+	t.Setenv("HISTORY_PSEUDONYM_KEY", "")
+	if _, err := Parse(path); err == nil {
+		t.Errorf("[TEST] simple: expected error for pseudonymization without a key")
+	}
+
+	t.Setenv("HISTORY_PSEUDONYM_KEY", "secret")
+	if _, err := Parse(path); err != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, err)
+	}
+}
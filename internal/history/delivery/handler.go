@@ -2,6 +2,7 @@ package delivery
 
 import (
 	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
 	pkgErrors "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	historyUC "github.com/vvinokurshin/AvitoInternship/internal/history/usecase"
@@ -14,7 +15,10 @@ import (
 )
 
 type DeliveryI interface {
-	GetHistoryCSV(w http.ResponseWriter, r *http.Request)
+	GetHistory(w http.ResponseWriter, r *http.Request)
+	GetUserHistory(w http.ResponseWriter, r *http.Request)
+	GetUserSnapshot(w http.ResponseWriter, r *http.Request)
+	GetSegmentSnapshot(w http.ResponseWriter, r *http.Request)
 }
 
 type Delivery struct {
@@ -22,23 +26,27 @@ type Delivery struct {
 	uc  historyUC.UseCaseI
 }
 
-// GetHistoryCSV godoc
-// @Summary      GetHistoryCSV
-// @Description  getting the history of adding/removing users in a segment for a specific month
+// GetHistory godoc
+// @Summary      GetHistory
+// @Description  getting the history of adding/removing users in a segment for a specific month, with the actor and reason of each change, as a file: CSV by default, another format is selected by format or the Accept header
 // @Tags     history
 // @Accept	 application/json
-// @Produce  application/json
+// @Produce  text/csv,application/x-ndjson,application/vnd.apache.parquet
 // @Param year query int true "year"
 // @Param month query int true "month"
+// @Param format query string false "csv, excel (CSV with BOM and CRLF), ndjson or parquet"
+// @Param delimiter query string false "column delimiter of csv and excel, ; by default"
 // @Success 200 "downloaded file"
 // @Failure 400 {object} errors.JSONError "year is required"
 // @Failure 400 {object} errors.JSONError "year is invalid"
 // @Failure 400 {object} errors.JSONError "month is required"
 // @Failure 400 {object} errors.JSONError "month is invalid"
 // @Failure 400 {object} errors.JSONError "invalid parameters"
+// @Failure 400 {object} errors.JSONError "format is invalid. supported: csv, excel, ndjson, parquet"
+// @Failure 400 {object} errors.JSONError "delimiter is invalid. it must be a single character other than a quote or a line break, and only for csv or excel"
 // @Failure 500 {object} errors.JSONError "internal server error"
 // @Router   /history [get]
-func (d *Delivery) GetHistoryCSV(w http.ResponseWriter, r *http.Request) {
+func (d *Delivery) GetHistory(w http.ResponseWriter, r *http.Request) {
 	year, err := strconv.Atoi(r.URL.Query().Get("year"))
 	if err != nil {
 		pkg.HandleError(w, r, errors.ErrYearIsRequired)
@@ -67,13 +75,256 @@ func (d *Delivery) GetHistoryCSV(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileName, err := d.uc.GetHistoryCSV(form)
+	form.Format, err = exportFormat(r, models.ExportFormatCSV)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	aw := pkg.NewAttachmentWriter(w, form.FileName(), pkg.ExportContentType(form.Format))
+	err = d.uc.ExportHistory(r.Context(), form, aw)
+	if err != nil {
+		pkg.HandleAttachmentError(aw, r, err)
+	}
+}
+
+// GetUserHistory godoc
+// @Summary      GetUserHistory
+// @Description  getting the history of a user's segments for an arbitrary period, page by page, or all records as a file when format or the Accept header names an export format
+// @Tags     history
+// @Accept	 application/json
+// @Produce  application/json,text/csv,application/x-ndjson,application/vnd.apache.parquet
+// @Param id path int true "id"
+// @Param from query string false "start of the period, inclusive: RFC 3339 or YYYY-MM-DD"
+// @Param to query string false "end of the period, exclusive: RFC 3339 or YYYY-MM-DD"
+// @Param segment query string false "segment slug"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param limit query int false "page size, 100 by default, up to 1000"
+// @Param format query string false "csv, excel (CSV with BOM and CRLF), ndjson or parquet to download all records as a file"
+// @Param delimiter query string false "column delimiter of csv and excel, ; by default"
+// @Success 200 {object} models.UserHistoryResponse "success get user history"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "period is invalid. format: RFC 3339 or YYYY-MM-DD, from before to"
+// @Failure 400 {object} errors.JSONError "cursor is invalid"
+// @Failure 400 {object} errors.JSONError "limit is invalid"
+// @Failure 400 {object} errors.JSONError "format is invalid. supported: csv, excel, ndjson, parquet"
+// @Failure 400 {object} errors.JSONError "delimiter is invalid. it must be a single character other than a quote or a line break, and only for csv or excel"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /user/{id}/history [get]
+func (d *Delivery) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	query := r.URL.Query()
+	form := models.FormUserHistory{
+		UserID:  userID,
+		Segment: query.Get("segment"),
+	}
+
+	if query.Get("from") != "" {
+		from, err := models.ParseHistoryTime(query.Get("from"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrPeriodIsInvalid)
+			return
+		}
+		form.From = &from
+	}
+
+	if query.Get("to") != "" {
+		to, err := models.ParseHistoryTime(query.Get("to"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrPeriodIsInvalid)
+			return
+		}
+		form.To = &to
+	}
+
+	if query.Get("cursor") != "" {
+		form.Cursor, err = strconv.ParseUint(query.Get("cursor"), 10, 64)
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrCursorIsInvalid)
+			return
+		}
+	}
+
+	if query.Get("limit") != "" {
+		form.Limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrLimitIsInvalid)
+			return
+		}
+	}
+
+	err = form.Validate()
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	form.Format, err = exportFormat(r, "")
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	if form.Format.Name != "" {
+		aw := pkg.NewAttachmentWriter(w, form.FileName(), pkg.ExportContentType(form.Format))
+		err = d.uc.ExportUserHistory(r.Context(), form, aw)
+		if err != nil {
+			pkg.HandleAttachmentError(aw, r, err)
+		}
+		return
+	}
+
+	response, err := d.uc.GetUserHistory(form)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
+// GetUserSnapshot godoc
+// @Summary      GetUserSnapshot
+// @Description  restoring from history the segments the user had at a moment in the past, with the last change of each membership
+// @Tags     history
+// @Accept	 application/json
+// @Produce  application/json
+// @Param id path int true "id"
+// @Param at query string false "moment: RFC 3339 or YYYY-MM-DD (midnight UTC), now by default"
+// @Success 200 {object} models.UserSnapshotResponse "success get user snapshot"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "at is invalid. format: RFC 3339 or YYYY-MM-DD"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /user/{id}/history/snapshot [get]
+func (d *Delivery) GetUserSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	at, err := snapshotMoment(r)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.GetUserSnapshot(models.FormSnapshot{UserID: userID, At: at})
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
+// GetSegmentSnapshot godoc
+// @Summary      GetSegmentSnapshot
+// @Description  restoring from history the members of the segment at a moment in the past, page by page ordered by user id; the segment may be deleted since
+// @Tags     history
+// @Accept	 application/json
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param at query string false "moment: RFC 3339 or YYYY-MM-DD (midnight UTC), now by default"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param limit query int false "page size, 100 by default, up to 1000"
+// @Success 200 {object} models.SegmentSnapshotResponse "success get segment snapshot"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "at is invalid. format: RFC 3339 or YYYY-MM-DD"
+// @Failure 400 {object} errors.JSONError "cursor is invalid"
+// @Failure 400 {object} errors.JSONError "limit is invalid"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug}/history/snapshot [get]
+func (d *Delivery) GetSegmentSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	at, err := snapshotMoment(r)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	form := models.FormSnapshot{
+		Slug: slug,
+		At:   at,
+	}
+
+	if query.Get("cursor") != "" {
+		form.Cursor, err = strconv.ParseUint(query.Get("cursor"), 10, 64)
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrCursorIsInvalid)
+			return
+		}
+	}
+
+	if query.Get("limit") != "" {
+		form.Limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrLimitIsInvalid)
+			return
+		}
+	}
+
+	err = form.Validate()
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.GetSegmentSnapshot(form)
 	if err != nil {
 		pkg.HandleError(w, r, err)
 		return
 	}
 
-	pkg.SendFile(w, r, fileName)
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
+// snapshotMoment reads the moment of a snapshot from the at parameter, the current time is used without it.
+func snapshotMoment(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		return time.Now().UTC(), nil
+	}
+
+	at, err := models.ParseHistoryTime(value)
+	if err != nil {
+		return time.Time{}, errors.ErrMomentIsInvalid
+	}
+
+	return at, nil
+}
+
+// exportFormat reads the format of the file from the format parameter or else the Accept header,
+// defaultName is used when the request names neither.
+func exportFormat(r *http.Request, defaultName string) (models.ExportFormat, error) {
+	query := r.URL.Query()
+
+	name := query.Get("format")
+	if name == "" {
+		name = pkg.AcceptedExportFormat(r)
+	}
+	if name == "" {
+		name = defaultName
+	}
+	if name == "" {
+		return models.ExportFormat{}, nil
+	}
+
+	return models.ParseExportFormat(name, query.Get("delimiter"))
 }
 
 func New(cfg *config.Config, uc historyUC.UseCaseI) DeliveryI {
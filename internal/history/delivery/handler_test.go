@@ -2,30 +2,35 @@ package delivery
 
 import (
 	"bytes"
+	"context"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	mockHistoryUC "github.com/vvinokurshin/AvitoInternship/internal/history/usecase/mocks"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func createConfig() *config.Config {
 	return new(config.Config)
 }
 
-func TestDelivery_GetHistoryCSV(t *testing.T) {
-	pkg.HistoryFolderName = "../../../history/"
+func TestDelivery_GetHistory(t *testing.T) {
 	cfg := createConfig()
 
 	fakeForm := models.FormHistory{
-		Year:  2023,
-		Month: 1,
+		Year:   2023,
+		Month:  1,
+		Format: models.ExportFormat{Name: models.ExportFormatCSV, Delimiter: models.DefaultDelimiter},
 	}
-	fakeFilename := "history-2023-1.csv"
 	status := http.StatusOK
 
 	t.Parallel()
@@ -42,10 +47,394 @@ func TestDelivery_GetHistoryCSV(t *testing.T) {
 	r.URL.RawQuery = q.Encode()
 	w := httptest.NewRecorder()
 
-	historyUC.EXPECT().GetHistoryCSV(fakeForm).Return(fakeFilename, nil)
-	historyH.GetHistoryCSV(w, r)
+	historyUC.EXPECT().ExportHistory(gomock.Any(), fakeForm, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, form models.FormHistory, w io.Writer) error {
+			return pkg.NewHistoryCSVWriter(w, form.Format.Delimiter).Flush()
+		})
+	historyH.GetHistory(w, r)
 
 	if w.Code != status {
 		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
 	}
+	require.Equal(t, "attachment; filename=history-2023-1.csv", w.Header().Get("Content-Disposition"))
+}
+
+func TestDelivery_GetHistoryInternalError(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormHistory{
+		Year:   2023,
+		Month:  1,
+		Format: models.ExportFormat{Name: models.ExportFormatCSV, Delimiter: models.DefaultDelimiter},
+	}
+	status := http.StatusInternalServerError
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/history", bytes.NewReader([]byte{}))
+	q := r.URL.Query()
+	q.Set("year", strconv.Itoa(fakeForm.Year))
+	q.Set("month", strconv.Itoa(int(fakeForm.Month)))
+	r.URL.RawQuery = q.Encode()
+	w := httptest.NewRecorder()
+
+	historyUC.EXPECT().ExportHistory(gomock.Any(), fakeForm, gomock.Any()).Return(errors.ErrInternal)
+	historyH.GetHistory(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+	require.Empty(t, w.Header().Get("Content-Disposition"))
+}
+
+func TestDelivery_GetHistoryFormats(t *testing.T) {
+	cfg := createConfig()
+
+	tests := []struct {
+		name        string
+		format      string
+		delimiter   string
+		accept      string
+		expected    models.ExportFormat
+		fileName    string
+		contentType string
+	}{
+		{
+			name:        "excel",
+			format:      models.ExportFormatExcel,
+			delimiter:   ",",
+			expected:    models.ExportFormat{Name: models.ExportFormatExcel, Delimiter: ','},
+			fileName:    "history-2023-1.csv",
+			contentType: pkg.ContentTypeCSV,
+		},
+		{
+			name:        "ndjson",
+			format:      models.ExportFormatNDJSON,
+			expected:    models.ExportFormat{Name: models.ExportFormatNDJSON, Delimiter: models.DefaultDelimiter},
+			fileName:    "history-2023-1.ndjson",
+			contentType: pkg.ContentTypeNDJSON,
+		},
+		{
+			name:        "parquet by accept",
+			accept:      "application/json;q=0.5, application/vnd.apache.parquet",
+			expected:    models.ExportFormat{Name: models.ExportFormatParquet, Delimiter: models.DefaultDelimiter},
+			fileName:    "history-2023-1.parquet",
+			contentType: pkg.ContentTypeParquet,
+		},
+		{
+			name:        "format over accept",
+			format:      models.ExportFormatCSV,
+			accept:      pkg.ContentTypeNDJSON,
+			expected:    models.ExportFormat{Name: models.ExportFormatCSV, Delimiter: models.DefaultDelimiter},
+			fileName:    "history-2023-1.csv",
+			contentType: pkg.ContentTypeCSV,
+		},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/history", bytes.NewReader([]byte{}))
+		q := r.URL.Query()
+		q.Set("year", "2023")
+		q.Set("month", "1")
+		if test.format != "" {
+			q.Set("format", test.format)
+		}
+		if test.delimiter != "" {
+			q.Set("delimiter", test.delimiter)
+		}
+		r.URL.RawQuery = q.Encode()
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+
+		fakeForm := models.FormHistory{Year: 2023, Month: 1, Format: test.expected}
+		historyUC.EXPECT().ExportHistory(gomock.Any(), fakeForm, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, form models.FormHistory, w io.Writer) error {
+				_, err := w.Write([]byte("data"))
+				return err
+			})
+		historyH.GetHistory(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("[TEST] %s: Expected status %d, got %d ", test.name, http.StatusOK, w.Code)
+			continue
+		}
+		require.Equal(t, "attachment; filename="+test.fileName, w.Header().Get("Content-Disposition"))
+		require.Equal(t, test.contentType, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestDelivery_GetHistoryInvalidFormat(t *testing.T) {
+	cfg := createConfig()
+
+	tests := []struct {
+		format    string
+		delimiter string
+		err       error
+	}{
+		{format: "xml", err: errors.ErrFormatIsInvalid},
+		{format: models.ExportFormatCSV, delimiter: "\"", err: errors.ErrDelimiterIsInvalid},
+		{format: models.ExportFormatCSV, delimiter: ";;", err: errors.ErrDelimiterIsInvalid},
+		{format: models.ExportFormatParquet, delimiter: ",", err: errors.ErrDelimiterIsInvalid},
+	}
+	status := http.StatusBadRequest
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/history", bytes.NewReader([]byte{}))
+		q := r.URL.Query()
+		q.Set("year", "2023")
+		q.Set("month", "1")
+		q.Set("format", test.format)
+		q.Set("delimiter", test.delimiter)
+		r.URL.RawQuery = q.Encode()
+		w := httptest.NewRecorder()
+
+		historyH.GetHistory(w, r)
+
+		if w.Code != status {
+			t.Errorf("[TEST] %s: Expected status %d, got %d ", test.format, status, w.Code)
+		}
+		require.Contains(t, w.Body.String(), test.err.Error())
+	}
+}
+
+func TestDelivery_GetUserHistory(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(1)
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 9, 1, 9, 0, 0, 0, time.UTC)
+	fakeForm := models.FormUserHistory{
+		UserID:  userID,
+		Segment: "test",
+		From:    &from,
+		To:      &to,
+		Cursor:  10,
+		Limit:   100,
+	}
+	fakeResponse := &models.UserHistoryResponse{
+		Records: []models.History{},
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/user/{id}/history", bytes.NewReader([]byte{}))
+	q := r.URL.Query()
+	q.Set("from", "2023-08-01")
+	q.Set("to", "2023-09-01T12:00:00+03:00")
+	q.Set("segment", "test")
+	q.Set("cursor", "10")
+	r.URL.RawQuery = q.Encode()
+	r = mux.SetURLVars(r, map[string]string{
+		"id": strconv.FormatUint(userID, 10),
+	})
+	w := httptest.NewRecorder()
+
+	historyUC.EXPECT().GetUserHistory(fakeForm).Return(fakeResponse, nil)
+	historyH.GetUserHistory(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetUserHistoryInvalidPeriod(t *testing.T) {
+	cfg := createConfig()
+
+	status := http.StatusBadRequest
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/user/{id}/history", bytes.NewReader([]byte{}))
+	q := r.URL.Query()
+	q.Set("from", "2023-09-01")
+	q.Set("to", "2023-08-01")
+	r.URL.RawQuery = q.Encode()
+	r = mux.SetURLVars(r, map[string]string{
+		"id": "1",
+	})
+	w := httptest.NewRecorder()
+
+	historyH.GetUserHistory(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetUserHistoryExport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormUserHistory{
+		UserID: 1,
+		Limit:  errors.DefaultHistoryLimit,
+		Format: models.ExportFormat{Name: models.ExportFormatCSV, Delimiter: models.DefaultDelimiter},
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/user/{id}/history", bytes.NewReader([]byte{}))
+	r.Header.Set("Accept", pkg.ContentTypeCSV)
+	r = mux.SetURLVars(r, map[string]string{
+		"id": "1",
+	})
+	w := httptest.NewRecorder()
+
+	historyUC.EXPECT().ExportUserHistory(gomock.Any(), fakeForm, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, form models.FormUserHistory, w io.Writer) error {
+			return pkg.NewHistoryCSVWriter(w, form.Format.Delimiter).Flush()
+		})
+	historyH.GetUserHistory(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+	require.Equal(t, "attachment; filename=history-user-1.csv", w.Header().Get("Content-Disposition"))
+}
+
+func TestDelivery_GetUserSnapshot(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormSnapshot{
+		UserID: 42,
+		At:     time.Date(2023, 8, 15, 11, 0, 0, 0, time.UTC),
+	}
+	fakeResponse := &models.UserSnapshotResponse{
+		UserID: fakeForm.UserID,
+		At:     fakeForm.At,
+		Segments: []models.Membership{
+			{SegmentSlug: "AVITO_VOICE_MESSAGES", Source: models.SourceManual, LastOperation: models.OperationAdd},
+		},
+		Count: 1,
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/user/{id}/history/snapshot", bytes.NewReader([]byte{}))
+	q := r.URL.Query()
+	q.Set("at", "2023-08-15T14:00:00+03:00")
+	r.URL.RawQuery = q.Encode()
+	r = mux.SetURLVars(r, map[string]string{
+		"id": "42",
+	})
+	w := httptest.NewRecorder()
+
+	historyUC.EXPECT().GetUserSnapshot(fakeForm).Return(fakeResponse, nil)
+	historyH.GetUserSnapshot(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetSegmentSnapshot(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormSnapshot{
+		Slug:   "AVITO_VOICE_MESSAGES",
+		At:     time.Date(2023, 8, 15, 0, 0, 0, 0, time.UTC),
+		Cursor: 10,
+		Limit:  errors.DefaultHistoryLimit,
+	}
+	fakeResponse := &models.SegmentSnapshotResponse{
+		Slug: fakeForm.Slug,
+		At:   fakeForm.At,
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/segment/{slug}/history/snapshot", bytes.NewReader([]byte{}))
+	q := r.URL.Query()
+	q.Set("at", "2023-08-15")
+	q.Set("cursor", "10")
+	r.URL.RawQuery = q.Encode()
+	r = mux.SetURLVars(r, map[string]string{
+		"slug": fakeForm.Slug,
+	})
+	w := httptest.NewRecorder()
+
+	historyUC.EXPECT().GetSegmentSnapshot(fakeForm).Return(fakeResponse, nil)
+	historyH.GetSegmentSnapshot(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetSegmentSnapshotInvalidMoment(t *testing.T) {
+	cfg := createConfig()
+
+	status := http.StatusBadRequest
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	historyH := New(cfg, historyUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/segment/{slug}/history/snapshot", bytes.NewReader([]byte{}))
+	q := r.URL.Query()
+	q.Set("at", "15.08.2023")
+	r.URL.RawQuery = q.Encode()
+	r = mux.SetURLVars(r, map[string]string{
+		"slug": "AVITO_VOICE_MESSAGES",
+	})
+	w := httptest.NewRecorder()
+
+	historyH.GetSegmentSnapshot(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+	require.Contains(t, w.Body.String(), errors.ErrMomentIsInvalid.Error())
 }
@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
@@ -35,17 +36,89 @@ func (m *MockRepositoryI) EXPECT() *MockRepositoryIMockRecorder {
 	return m.recorder
 }
 
-// GetRecordsByDate mocks base method.
-func (m *MockRepositoryI) SelectRecordsByDate(year int, month time.Month) ([]models.History, error) {
+// InsertRecords mocks base method.
+func (m *MockRepositoryI) InsertRecords(records []models.HistoryRecord) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectRecordsByDate", year, month)
+	ret := m.ctrl.Call(m, "InsertRecords", records)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertRecords indicates an expected call of InsertRecords.
+func (mr *MockRepositoryIMockRecorder) InsertRecords(records interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertRecords", reflect.TypeOf((*MockRepositoryI)(nil).InsertRecords), records)
+}
+
+// SelectRecords mocks base method.
+func (m *MockRepositoryI) SelectRecords(filter models.HistoryFilter) ([]models.History, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectRecords", filter)
 	ret0, _ := ret[0].([]models.History)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetRecordsByDate indicates an expected call of GetRecordsByDate.
-func (mr *MockRepositoryIMockRecorder) GetRecordsByDate(year, month interface{}) *gomock.Call {
+// SelectRecords indicates an expected call of SelectRecords.
+func (mr *MockRepositoryIMockRecorder) SelectRecords(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectRecords", reflect.TypeOf((*MockRepositoryI)(nil).SelectRecords), filter)
+}
+
+// SelectSegmentSnapshot mocks base method.
+func (m *MockRepositoryI) SelectSegmentSnapshot(slug string, at time.Time, afterUserID uint64, limit int) ([]models.Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentSnapshot", slug, at, afterUserID, limit)
+	ret0, _ := ret[0].([]models.Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentSnapshot indicates an expected call of SelectSegmentSnapshot.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentSnapshot(slug, at, afterUserID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentSnapshot", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentSnapshot), slug, at, afterUserID, limit)
+}
+
+// SelectUserSnapshot mocks base method.
+func (m *MockRepositoryI) SelectUserSnapshot(userID uint64, at time.Time) ([]models.Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserSnapshot", userID, at)
+	ret0, _ := ret[0].([]models.Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserSnapshot indicates an expected call of SelectUserSnapshot.
+func (mr *MockRepositoryIMockRecorder) SelectUserSnapshot(userID, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserSnapshot", reflect.TypeOf((*MockRepositoryI)(nil).SelectUserSnapshot), userID, at)
+}
+
+// StreamRecordsByDate mocks base method.
+func (m *MockRepositoryI) StreamRecordsByDate(ctx context.Context, year int, month time.Month, fn func(models.History) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamRecordsByDate", ctx, year, month, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamRecordsByDate indicates an expected call of StreamRecordsByDate.
+func (mr *MockRepositoryIMockRecorder) StreamRecordsByDate(ctx, year, month, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamRecordsByDate", reflect.TypeOf((*MockRepositoryI)(nil).StreamRecordsByDate), ctx, year, month, fn)
+}
+
+// UpdateUserID mocks base method.
+func (m *MockRepositoryI) UpdateUserID(userID, newUserID uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserID", userID, newUserID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserID indicates an expected call of UpdateUserID.
+func (mr *MockRepositoryIMockRecorder) UpdateUserID(userID, newUserID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectRecordsByDate", reflect.TypeOf((*MockRepositoryI)(nil).SelectRecordsByDate), year, month)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserID", reflect.TypeOf((*MockRepositoryI)(nil).UpdateUserID), userID, newUserID)
 }
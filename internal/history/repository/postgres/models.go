@@ -3,6 +3,7 @@ package postgres
 import (
 	"fmt"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"time"
 )
 
 type History struct {
@@ -10,6 +11,10 @@ type History struct {
 	UserID      uint64
 	SegmentSlug string
 	Operation   string
+	Source      string
+	Variant     string
+	Actor       string
+	Reason      string
 	Datetime    string
 }
 
@@ -19,9 +24,74 @@ func (History) TableName(schemaName, tableName string) string {
 
 func (s *History) ToHistoryModel() *models.History {
 	return &models.History{
+		RecordID:    s.RecordID,
 		UserID:      s.UserID,
 		SegmentSlug: s.SegmentSlug,
 		Operation:   s.Operation,
+		Source:      s.Source,
+		Variant:     s.Variant,
+		Actor:       s.Actor,
+		Reason:      s.Reason,
 		Datetime:    s.Datetime,
 	}
 }
+
+type Record struct {
+	RecordID    uint64 `gorm:"primary_key"`
+	UserID      uint64
+	SegmentSlug string
+	Operation   string
+	Source      string
+	Variant     string
+	Actor       string
+	Reason      string
+	RequestID   string
+	Datetime    time.Time
+}
+
+func (Record) TableName(schemaName, tableName string) string {
+	return fmt.Sprintf("%s.%s", schemaName, tableName)
+}
+
+func (r *Record) FromHistoryRecordModel(record *models.HistoryRecord) {
+	r.UserID = record.UserID
+	r.SegmentSlug = record.SegmentSlug
+	r.Operation = record.Operation
+	r.Source = record.Source
+	r.Variant = record.Variant
+	r.Actor = record.Actor
+	r.Reason = record.Reason
+	r.RequestID = record.RequestID
+	r.Datetime = record.Datetime
+}
+
+type Membership struct {
+	UserID      uint64
+	SegmentSlug string
+	Source      string
+	Variant     string
+	Since       *time.Time
+	Operation   string
+	Datetime    time.Time
+	Actor       string
+	Reason      string
+}
+
+func (m *Membership) ToMembershipModel() *models.Membership {
+	membership := &models.Membership{
+		UserID:        m.UserID,
+		SegmentSlug:   m.SegmentSlug,
+		Source:        m.Source,
+		Variant:       m.Variant,
+		LastOperation: m.Operation,
+		ChangedAt:     m.Datetime.UTC(),
+		Actor:         m.Actor,
+		Reason:        m.Reason,
+	}
+	if m.Since != nil {
+		since := m.Since.UTC()
+		membership.Since = &since
+	}
+
+	return membership
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	pkgErrors "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	"github.com/vvinokurshin/AvitoInternship/internal/history/repository"
@@ -10,6 +11,12 @@ import (
 	"time"
 )
 
+// endingOperations end a membership, after the others the user stays in the segment.
+var endingOperations = []string{models.OperationDel, models.OperationExpire}
+
+// recordsBatchSize keeps a single INSERT below the postgres limit of bind parameters.
+const recordsBatchSize = 1000
+
 type historyRepo struct {
 	cfg *config.Config
 	db  *gorm.DB
@@ -22,12 +29,75 @@ func New(cfg *config.Config, db *gorm.DB) repository.RepositoryI {
 	}
 }
 
-func (repo *historyRepo) SelectRecordsByDate(year int, month time.Month) ([]models.History, error) {
+// NewWriter returns a constructor of repositories bound to a transaction, for the repositories
+// that log their changes in history inside their own transactions.
+func NewWriter(cfg *config.Config) func(tx *gorm.DB) repository.RepositoryI {
+	return func(tx *gorm.DB) repository.RepositoryI {
+		return New(cfg, tx)
+	}
+}
+
+func (repo *historyRepo) StreamRecordsByDate(ctx context.Context, year int, month time.Month,
+	fn func(record models.History) error) error {
+	// a half-open range of the month lets the query use the datetime index
+	from := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	rows, err := repo.db.WithContext(ctx).Model(&History{}).
+		Table(History{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)).Omit("record_id").
+		Where("datetime >= ? AND datetime < ?", from, to).Order("record_id").Rows()
+	if err != nil {
+		return queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbRecord History
+		if err = repo.db.ScanRows(rows, &dbRecord); err != nil {
+			return queryError(ctx, err)
+		}
+
+		if err = fn(*dbRecord.ToHistoryModel()); err != nil {
+			if ctx.Err() != nil {
+				return pkgErrors.WithMessage(errors.ErrRequestIsCanceled, err.Error())
+			}
+
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return queryError(ctx, err)
+	}
+
+	return nil
+}
+
+// queryError tells a query aborted because the request was canceled from a failed one.
+func queryError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return pkgErrors.WithMessage(errors.ErrRequestIsCanceled, err.Error())
+	}
+
+	return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+}
+
+func (repo *historyRepo) SelectRecords(filter models.HistoryFilter) ([]models.History, error) {
 	var dbRecords []History
-	datetime := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
 
-	tx := repo.db.Table(History{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)).Omit("record_id").
-		Where("date_trunc('month', datetime) = ?", datetime).Find(&dbRecords)
+	tx := repo.db.Table(History{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)).
+		Where("user_id = ? AND record_id > ?", filter.UserID, filter.AfterID)
+	if filter.Segment != "" {
+		tx = tx.Where("segment_slug = ?", filter.Segment)
+	}
+	if filter.From != nil {
+		tx = tx.Where("datetime >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		tx = tx.Where("datetime < ?", *filter.To)
+	}
+
+	tx = tx.Order("record_id").Limit(filter.Limit).Find(&dbRecords)
 	if err := tx.Error; err != nil {
 		return []models.History{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
@@ -39,3 +109,86 @@ func (repo *historyRepo) SelectRecordsByDate(year int, month time.Month) ([]mode
 
 	return result, nil
 }
+
+// SelectUserSnapshot keeps the last change of every segment of the user made up to the moment and drops
+// the memberships that ended with it, since is the last time the membership began.
+func (repo *historyRepo) SelectUserSnapshot(userID uint64, at time.Time) ([]models.Membership, error) {
+	var dbMemberships []Membership
+
+	tx := repo.db.Raw(`SELECT segment_slug, source, variant, since, operation, datetime, actor, reason FROM (
+		SELECT DISTINCT ON (segment_slug) segment_slug, source, variant, operation, datetime, actor, reason,
+			max(datetime) FILTER (WHERE operation = ?) OVER (PARTITION BY segment_slug) AS since
+		FROM `+History{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)+`
+		WHERE user_id = ? AND datetime <= ?
+		ORDER BY segment_slug, datetime DESC, record_id DESC
+	) AS last_changes WHERE operation NOT IN ? ORDER BY segment_slug`,
+		models.OperationAdd, userID, at, endingOperations).Scan(&dbMemberships)
+	if err := tx.Error; err != nil {
+		return []models.Membership{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.Membership, len(dbMemberships))
+	for idx, dbMembership := range dbMemberships {
+		result[idx] = *dbMembership.ToMembershipModel()
+	}
+
+	return result, nil
+}
+
+// SelectSegmentSnapshot restores the members of the segment like SelectUserSnapshot does the segments of a user.
+func (repo *historyRepo) SelectSegmentSnapshot(slug string, at time.Time, afterUserID uint64,
+	limit int) ([]models.Membership, error) {
+	var dbMemberships []Membership
+
+	tx := repo.db.Raw(`SELECT user_id, source, variant, since, operation, datetime, actor, reason FROM (
+		SELECT DISTINCT ON (user_id) user_id, source, variant, operation, datetime, actor, reason,
+			max(datetime) FILTER (WHERE operation = ?) OVER (PARTITION BY user_id) AS since
+		FROM `+History{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)+`
+		WHERE segment_slug = ? AND user_id > ? AND datetime <= ?
+		ORDER BY user_id, datetime DESC, record_id DESC
+	) AS last_changes WHERE operation NOT IN ? ORDER BY user_id LIMIT ?`,
+		models.OperationAdd, slug, afterUserID, at, endingOperations, limit).Scan(&dbMemberships)
+	if err := tx.Error; err != nil {
+		return []models.Membership{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.Membership, len(dbMemberships))
+	for idx, dbMembership := range dbMemberships {
+		result[idx] = *dbMembership.ToMembershipModel()
+	}
+
+	return result, nil
+}
+
+func (repo *historyRepo) InsertRecords(records []models.HistoryRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	dbRecords := make([]Record, len(records))
+	for idx := range records {
+		dbRecords[idx].FromHistoryRecordModel(&records[idx])
+		if dbRecords[idx].Datetime.IsZero() {
+			dbRecords[idx].Datetime = now
+		}
+	}
+
+	tx := repo.db.Table(Record{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)).
+		CreateInBatches(&dbRecords, recordsBatchSize)
+	if err := tx.Error; err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
+func (repo *historyRepo) UpdateUserID(userID uint64, newUserID uint64) error {
+	tx := repo.db.Table(History{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBHistoryTableName)).
+		Where("user_id = ?", userID).Update("user_id", newUserID)
+	if err := tx.Error; err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
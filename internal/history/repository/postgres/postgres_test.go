@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/go-faker/faker/v4"
@@ -8,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -52,15 +54,17 @@ func generateFakeData(data any) {
 	faker.FakeData(data)
 }
 
-func TestRepository_SelectRecordsByDate(t *testing.T) {
+func TestRepository_StreamRecordsByDate(t *testing.T) {
 	cfg := createConfig()
 
 	year := 2023
 	month := time.Month(1)
-	datetime := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	from := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
 	var fakeRecords []models.History
 	generateFakeData(&fakeRecords)
 	fakeRecords = fakeRecords[:1]
+	fakeRecords[0].RecordID = 0
 
 	db, gormDB, mock, err := mockDB()
 	if err != nil {
@@ -68,14 +72,19 @@ func TestRepository_SelectRecordsByDate(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"user_id", "segment_slug", "operation", "datetime"}).
-		AddRow(fakeRecords[0].UserID, fakeRecords[0].SegmentSlug, fakeRecords[0].Operation, fakeRecords[0].Datetime)
+	rows := sqlmock.NewRows([]string{"user_id", "segment_slug", "operation", "source", "variant", "actor", "reason", "datetime"}).
+		AddRow(fakeRecords[0].UserID, fakeRecords[0].SegmentSlug, fakeRecords[0].Operation, fakeRecords[0].Source,
+			fakeRecords[0].Variant, fakeRecords[0].Actor, fakeRecords[0].Reason, fakeRecords[0].Datetime)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "history"."user_id","history"."segment_slug","history"."operation","history"."datetime"
-FROM "app"."history" WHERE date_trunc('month', datetime) = $1`)).WithArgs(datetime).WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "history"."user_id","history"."segment_slug","history"."operation","history"."source","history"."variant","history"."actor","history"."reason","history"."datetime"
+FROM "app"."history" WHERE datetime >= $1 AND datetime < $2 ORDER BY record_id`)).WithArgs(from, to).WillReturnRows(rows)
 
 	historyRep := New(cfg, gormDB)
-	response, err := historyRep.SelectRecordsByDate(year, month)
+	var response []models.History
+	err = historyRep.StreamRecordsByDate(context.Background(), year, month, func(record models.History) error {
+		response = append(response, record)
+		return nil
+	})
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -84,3 +93,264 @@ FROM "app"."history" WHERE date_trunc('month', datetime) = $1`)).WithArgs(dateti
 		require.Equal(t, fakeRecords, response)
 	}
 }
+
+func TestRepository_StreamRecordsByDateStopped(t *testing.T) {
+	cfg := createConfig()
+
+	year := 2023
+	month := time.Month(1)
+	writeErr := pkgErr.New("write error")
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id", "segment_slug"}).
+		AddRow(1, "first").
+		AddRow(2, "second")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "app"."history" WHERE datetime >= $1 AND datetime < $2 ORDER BY record_id`)).
+		WillReturnRows(rows)
+
+	historyRep := New(cfg, gormDB)
+	calls := 0
+	err = historyRep.StreamRecordsByDate(context.Background(), year, month, func(record models.History) error {
+		calls++
+		return writeErr
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != writeErr {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", writeErr, causeErr)
+	}
+	require.Equal(t, 1, calls)
+}
+
+func TestRepository_StreamRecordsByDateCanceled(t *testing.T) {
+	cfg := createConfig()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	db, gormDB, _, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	historyRep := New(cfg, gormDB)
+	err = historyRep.StreamRecordsByDate(ctx, 2023, time.January, func(record models.History) error {
+		return nil
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrRequestIsCanceled {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrRequestIsCanceled, causeErr)
+	}
+}
+
+func TestRepository_SelectRecords(t *testing.T) {
+	cfg := createConfig()
+
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+	filter := models.HistoryFilter{
+		UserID:  1,
+		Segment: "test",
+		From:    &from,
+		To:      &to,
+		AfterID: 10,
+		Limit:   2,
+	}
+	fakeRecords := []models.History{
+		{
+			RecordID:    11,
+			UserID:      filter.UserID,
+			SegmentSlug: filter.Segment,
+			Operation:   models.OperationAdd,
+			Source:      models.SourceManual,
+			Actor:       "pm",
+			Datetime:    "2023-08-31T10:00:00Z",
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"record_id", "user_id", "segment_slug", "operation", "source", "variant", "actor", "reason", "datetime"}).
+		AddRow(fakeRecords[0].RecordID, fakeRecords[0].UserID, fakeRecords[0].SegmentSlug, fakeRecords[0].Operation,
+			fakeRecords[0].Source, fakeRecords[0].Variant, fakeRecords[0].Actor, fakeRecords[0].Reason, fakeRecords[0].Datetime)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."history" WHERE (user_id = $1 AND record_id > $2) AND segment_slug = $3
+	AND datetime >= $4 AND datetime < $5 ORDER BY record_id LIMIT 2`)).
+		WithArgs(filter.UserID, filter.AfterID, filter.Segment, from, to).WillReturnRows(rows)
+
+	historyRep := New(cfg, gormDB)
+	response, err := historyRep.SelectRecords(filter)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeRecords, response)
+	}
+}
+
+func TestRepository_SelectUserSnapshot(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(42)
+	at := time.Date(2023, 8, 15, 14, 0, 0, 0, time.UTC)
+	since := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	changedAt := time.Date(2023, 8, 10, 10, 0, 0, 0, time.UTC)
+	fakeMemberships := []models.Membership{
+		{
+			SegmentSlug:   "AVITO_VOICE_MESSAGES",
+			Source:        models.SourceManual,
+			Since:         &since,
+			LastOperation: models.OperationExtend,
+			ChangedAt:     changedAt,
+			Actor:         "pm",
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"segment_slug", "source", "variant", "since", "operation", "datetime", "actor", "reason"}).
+		AddRow(fakeMemberships[0].SegmentSlug, fakeMemberships[0].Source, "", since, models.OperationExtend, changedAt,
+			fakeMemberships[0].Actor, "")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`max(datetime) FILTER (WHERE operation = $1) OVER (PARTITION BY segment_slug) AS since
+		FROM app.history WHERE user_id = $2 AND datetime <= $3
+		ORDER BY segment_slug, datetime DESC, record_id DESC
+	) AS last_changes WHERE operation NOT IN ($4,$5) ORDER BY segment_slug`)).
+		WithArgs(models.OperationAdd, userID, at, models.OperationDel, models.OperationExpire).WillReturnRows(rows)
+
+	historyRep := New(cfg, gormDB)
+	response, err := historyRep.SelectUserSnapshot(userID, at)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeMemberships, response)
+	}
+}
+
+func TestRepository_SelectSegmentSnapshot(t *testing.T) {
+	cfg := createConfig()
+
+	slug := "AVITO_VOICE_MESSAGES"
+	at := time.Date(2023, 8, 15, 14, 0, 0, 0, time.UTC)
+	changedAt := time.Date(2023, 8, 10, 10, 0, 0, 0, time.UTC)
+	fakeMemberships := []models.Membership{
+		{
+			UserID:        11,
+			Source:        models.SourcePercentage,
+			Variant:       "B",
+			LastOperation: models.OperationDeactivate,
+			ChangedAt:     changedAt,
+			Actor:         models.ActorSystem,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id", "source", "variant", "since", "operation", "datetime", "actor", "reason"}).
+		AddRow(fakeMemberships[0].UserID, fakeMemberships[0].Source, fakeMemberships[0].Variant, nil,
+			models.OperationDeactivate, changedAt, models.ActorSystem, "")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM app.history WHERE segment_slug = $2 AND user_id > $3 AND datetime <= $4
+		ORDER BY user_id, datetime DESC, record_id DESC
+	) AS last_changes WHERE operation NOT IN ($5,$6) ORDER BY user_id LIMIT $7`)).
+		WithArgs(models.OperationAdd, slug, 10, at, models.OperationDel, models.OperationExpire, 2).WillReturnRows(rows)
+
+	historyRep := New(cfg, gormDB)
+	response, err := historyRep.SelectSegmentSnapshot(slug, at, 10, 2)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeMemberships, response)
+	}
+}
+
+func TestRepository_UpdateUserID(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(1)
+	newUserID := uint64(1<<62 + 42)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."history" SET "user_id"=$1 WHERE user_id = $2`)).
+		WithArgs(newUserID, userID).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+
+	historyRep := New(cfg, gormDB)
+	err = historyRep.UpdateUserID(userID, newUserID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_InsertRecords(t *testing.T) {
+	cfg := createConfig()
+
+	datetime := time.Date(2023, 8, 31, 10, 0, 0, 0, time.UTC)
+	records := []models.HistoryRecord{
+		{
+			UserID:      1,
+			SegmentSlug: "test",
+			Operation:   models.OperationAdd,
+			Source:      models.SourceManual,
+			Actor:       "pm",
+			Reason:      "support ticket",
+			RequestID:   "request-1",
+			Datetime:    datetime,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(records[0].UserID, records[0].SegmentSlug, records[0].Operation, records[0].Source, records[0].Variant,
+			records[0].Actor, records[0].Reason, records[0].RequestID, datetime).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	historyRep := New(cfg, gormDB)
+	err = historyRep.InsertRecords(records)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
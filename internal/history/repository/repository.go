@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	"time"
 )
@@ -8,5 +9,15 @@ import (
 //go:generate mockgen -destination=./mocks/repository.go -source=./repository.go -package=mocks
 
 type RepositoryI interface {
-	SelectRecordsByDate(year int, month time.Month) ([]models.History, error)
+	// StreamRecordsByDate passes the records of the month to fn one by one as they are read from the database
+	// and stops at the first error of fn or when ctx is canceled.
+	StreamRecordsByDate(ctx context.Context, year int, month time.Month, fn func(record models.History) error) error
+	SelectRecords(filter models.HistoryFilter) ([]models.History, error)
+	// SelectUserSnapshot replays the history of the user up to the moment and returns the memberships it had.
+	SelectUserSnapshot(userID uint64, at time.Time) ([]models.Membership, error)
+	// SelectSegmentSnapshot replays the history of the segment up to the moment and returns a page of its members
+	// with user ids greater than afterUserID.
+	SelectSegmentSnapshot(slug string, at time.Time, afterUserID uint64, limit int) ([]models.Membership, error)
+	InsertRecords(records []models.HistoryRecord) error
+	UpdateUserID(userID uint64, newUserID uint64) error
 }
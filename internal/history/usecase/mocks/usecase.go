@@ -5,6 +5,8 @@
 package mocks
 
 import (
+	context "context"
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,17 +36,75 @@ func (m *MockUseCaseI) EXPECT() *MockUseCaseIMockRecorder {
 	return m.recorder
 }
 
-// GetHistoryCSV mocks base method.
-func (m *MockUseCaseI) GetHistoryCSV(form models.FormHistory) (string, error) {
+// ExportHistory mocks base method.
+func (m *MockUseCaseI) ExportHistory(ctx context.Context, form models.FormHistory, w io.Writer) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetHistoryCSV", form)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "ExportHistory", ctx, form, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportHistory indicates an expected call of ExportHistory.
+func (mr *MockUseCaseIMockRecorder) ExportHistory(ctx, form, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportHistory", reflect.TypeOf((*MockUseCaseI)(nil).ExportHistory), ctx, form, w)
+}
+
+// ExportUserHistory mocks base method.
+func (m *MockUseCaseI) ExportUserHistory(ctx context.Context, form models.FormUserHistory, w io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUserHistory", ctx, form, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportUserHistory indicates an expected call of ExportUserHistory.
+func (mr *MockUseCaseIMockRecorder) ExportUserHistory(ctx, form, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUserHistory", reflect.TypeOf((*MockUseCaseI)(nil).ExportUserHistory), ctx, form, w)
+}
+
+// GetSegmentSnapshot mocks base method.
+func (m *MockUseCaseI) GetSegmentSnapshot(form models.FormSnapshot) (*models.SegmentSnapshotResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSegmentSnapshot", form)
+	ret0, _ := ret[0].(*models.SegmentSnapshotResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSegmentSnapshot indicates an expected call of GetSegmentSnapshot.
+func (mr *MockUseCaseIMockRecorder) GetSegmentSnapshot(form interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegmentSnapshot", reflect.TypeOf((*MockUseCaseI)(nil).GetSegmentSnapshot), form)
+}
+
+// GetUserHistory mocks base method.
+func (m *MockUseCaseI) GetUserHistory(form models.FormUserHistory) (*models.UserHistoryResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserHistory", form)
+	ret0, _ := ret[0].(*models.UserHistoryResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserHistory indicates an expected call of GetUserHistory.
+func (mr *MockUseCaseIMockRecorder) GetUserHistory(form interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserHistory", reflect.TypeOf((*MockUseCaseI)(nil).GetUserHistory), form)
+}
+
+// GetUserSnapshot mocks base method.
+func (m *MockUseCaseI) GetUserSnapshot(form models.FormSnapshot) (*models.UserSnapshotResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserSnapshot", form)
+	ret0, _ := ret[0].(*models.UserSnapshotResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetHistoryCSV indicates an expected call of GetHistoryCSV.
-func (mr *MockUseCaseIMockRecorder) GetHistoryCSV(form interface{}) *gomock.Call {
+// GetUserSnapshot indicates an expected call of GetUserSnapshot.
+func (mr *MockUseCaseIMockRecorder) GetUserSnapshot(form interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistoryCSV", reflect.TypeOf((*MockUseCaseI)(nil).GetHistoryCSV), form)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSnapshot", reflect.TypeOf((*MockUseCaseI)(nil).GetUserSnapshot), form)
 }
@@ -1,18 +1,25 @@
 package usecase
 
 import (
+	"context"
 	pkgErr "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"io"
 	"strconv"
 )
 
 //go:generate mockgen -destination=./mocks/usecase.go -source=./usecase.go -package=mocks
 
 type UseCaseI interface {
-	GetHistoryCSV(form models.FormHistory) (string, error)
+	ExportHistory(ctx context.Context, form models.FormHistory, w io.Writer) error
+	GetUserHistory(form models.FormUserHistory) (*models.UserHistoryResponse, error)
+	ExportUserHistory(ctx context.Context, form models.FormUserHistory, w io.Writer) error
+	GetUserSnapshot(form models.FormSnapshot) (*models.UserSnapshotResponse, error)
+	GetSegmentSnapshot(form models.FormSnapshot) (*models.SegmentSnapshotResponse, error)
 }
 
 type UseCase struct {
@@ -27,17 +34,118 @@ func New(cfg *config.Config, historyRepo historyRepository.RepositoryI) UseCaseI
 	}
 }
 
-func (uc *UseCase) GetHistoryCSV(form models.FormHistory) (string, error) {
-	records, err := uc.historyRepo.SelectRecordsByDate(form.Year, form.Month)
+// ExportHistory streams the records of the month from the database into w in the format of the form
+// without collecting them.
+func (uc *UseCase) ExportHistory(ctx context.Context, form models.FormHistory, w io.Writer) error {
+	writer, err := pkg.NewHistoryWriter(w, form.Format)
 	if err != nil {
-		return "", pkgErr.Wrap(err, "delete segments from user")
+		return pkgErr.Wrap(err, "create history writer")
 	}
 
-	fileName := "history-" + strconv.Itoa(form.Year) + "-" + strconv.Itoa(int(form.Month)) + ".csv"
-	err = pkg.WriteCSV(records, fileName)
+	err = uc.historyRepo.StreamRecordsByDate(ctx, form.Year, form.Month, writer.Write)
 	if err != nil {
-		return "", pkgErr.Wrap(err, "write csv")
+		return pkgErr.Wrap(err, "stream records by date")
 	}
 
-	return fileName, nil
+	err = writer.Flush()
+	if err != nil {
+		return pkgErr.Wrap(err, "write history")
+	}
+
+	return nil
+}
+
+func (uc *UseCase) GetUserHistory(form models.FormUserHistory) (*models.UserHistoryResponse, error) {
+	filter := form.Filter()
+	filter.Limit++
+
+	records, err := uc.historyRepo.SelectRecords(filter)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select user history")
+	}
+
+	response := &models.UserHistoryResponse{
+		Records: records,
+	}
+	if len(records) > form.Limit {
+		response.Records = records[:form.Limit]
+		response.NextCursor = strconv.FormatUint(response.Records[form.Limit-1].RecordID, 10)
+	}
+	response.Count = len(response.Records)
+
+	return response, nil
+}
+
+// ExportUserHistory writes the user history into w page by page, so only one page is kept in memory.
+func (uc *UseCase) ExportUserHistory(ctx context.Context, form models.FormUserHistory, w io.Writer) error {
+	filter := form.Filter()
+	filter.Limit = errors.MaxHistoryLimit
+
+	writer, err := pkg.NewHistoryWriter(w, form.Format)
+	if err != nil {
+		return pkgErr.Wrap(err, "create history writer")
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return pkgErr.WithMessage(errors.ErrRequestIsCanceled, err.Error())
+		}
+
+		page, err := uc.historyRepo.SelectRecords(filter)
+		if err != nil {
+			return pkgErr.Wrap(err, "select user history")
+		}
+
+		for _, record := range page {
+			if err = writer.Write(record); err != nil {
+				return pkgErr.Wrap(err, "write history")
+			}
+		}
+
+		if len(page) < filter.Limit {
+			break
+		}
+		filter.AfterID = page[len(page)-1].RecordID
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return pkgErr.Wrap(err, "write history")
+	}
+
+	return nil
+}
+
+func (uc *UseCase) GetUserSnapshot(form models.FormSnapshot) (*models.UserSnapshotResponse, error) {
+	memberships, err := uc.historyRepo.SelectUserSnapshot(form.UserID, form.At)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select user snapshot")
+	}
+
+	return &models.UserSnapshotResponse{
+		UserID:   form.UserID,
+		At:       form.At,
+		Segments: memberships,
+		Count:    len(memberships),
+	}, nil
+}
+
+func (uc *UseCase) GetSegmentSnapshot(form models.FormSnapshot) (*models.SegmentSnapshotResponse, error) {
+	members, err := uc.historyRepo.SelectSegmentSnapshot(form.Slug, form.At, form.Cursor, form.Limit+1)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segment snapshot")
+	}
+
+	response := &models.SegmentSnapshotResponse{
+		Slug:    form.Slug,
+		At:      form.At,
+		Members: members,
+	}
+	if len(members) > form.Limit {
+		response.Members = members[:form.Limit]
+		response.NextCursor = strconv.FormatUint(response.Members[form.Limit-1].UserID, 10)
+	}
+	response.Count = len(response.Members)
+
+	return response, nil
 }
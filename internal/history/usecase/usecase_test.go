@@ -1,6 +1,8 @@
 package usecase
 
 import (
+	"bytes"
+	"context"
 	"github.com/go-faker/faker/v4"
 	"github.com/golang/mock/gomock"
 	pkgErr "github.com/pkg/errors"
@@ -8,8 +10,10 @@ import (
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	mockHistoryRepo "github.com/vvinokurshin/AvitoInternship/internal/history/repository/mocks"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
-	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func createConfig() *config.Config {
@@ -24,8 +28,7 @@ func generateFakeData(data any) {
 	faker.FakeData(data)
 }
 
-func TestUseCase_GetHistoryCSV(t *testing.T) {
-	pkg.HistoryFolderName = "../../../history/"
+func TestUseCase_ExportHistory(t *testing.T) {
 	cfg := createConfig()
 
 	fakeForm := models.FormHistory{
@@ -42,13 +45,203 @@ func TestUseCase_GetHistoryCSV(t *testing.T) {
 	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
 	historyUC := New(cfg, historyRepo)
 
-	historyRepo.EXPECT().GetRecordsByDate(fakeForm.Year, fakeForm.Month).Return(fakeHistoryResponse, nil)
-	response, err := historyUC.GetHistoryCSV(fakeForm)
+	historyRepo.EXPECT().StreamRecordsByDate(gomock.Any(), fakeForm.Year, fakeForm.Month, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, year int, month time.Month, fn func(record models.History) error) error {
+			for _, record := range fakeHistoryResponse {
+				if err := fn(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	var response bytes.Buffer
+	err := historyUC.ExportHistory(context.Background(), fakeForm, &response)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
 		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
 	} else {
-		require.Equal(t, "history-2023-1.csv", response)
+		require.Equal(t, len(fakeHistoryResponse)+1, strings.Count(response.String(), "\n"))
+	}
+}
+
+func TestUseCase_GetUserHistory(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormUserHistory{
+		UserID:  1,
+		Segment: "test",
+		Cursor:  10,
+		Limit:   2,
+	}
+	fakeRecords := []models.History{
+		{RecordID: 11, UserID: 1, SegmentSlug: "test", Operation: models.OperationAdd},
+		{RecordID: 15, UserID: 1, SegmentSlug: "test", Operation: models.OperationExtend},
+		{RecordID: 20, UserID: 1, SegmentSlug: "test", Operation: models.OperationExpire},
+	}
+	fakeFilter := models.HistoryFilter{
+		UserID:  fakeForm.UserID,
+		Segment: fakeForm.Segment,
+		AfterID: fakeForm.Cursor,
+		Limit:   fakeForm.Limit + 1,
+	}
+	fakeResponse := &models.UserHistoryResponse{
+		Records:    fakeRecords[:2],
+		Count:      2,
+		NextCursor: "15",
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	historyUC := New(cfg, historyRepo)
+
+	historyRepo.EXPECT().SelectRecords(fakeFilter).Return(fakeRecords, nil)
+	response, err := historyUC.GetUserHistory(fakeForm)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeResponse, response)
+	}
+}
+
+func TestUseCase_ExportUserHistory(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormUserHistory{
+		UserID: 1,
+		Limit:  errors.DefaultHistoryLimit,
+	}
+	fakePage := make([]models.History, errors.MaxHistoryLimit)
+	for idx := range fakePage {
+		fakePage[idx] = models.History{RecordID: uint64(idx + 1), UserID: fakeForm.UserID}
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	historyUC := New(cfg, historyRepo)
+
+	historyRepo.EXPECT().SelectRecords(models.HistoryFilter{UserID: fakeForm.UserID, Limit: errors.MaxHistoryLimit}).
+		Return(fakePage, nil)
+	historyRepo.EXPECT().SelectRecords(models.HistoryFilter{UserID: fakeForm.UserID, AfterID: uint64(errors.MaxHistoryLimit),
+		Limit: errors.MaxHistoryLimit}).Return([]models.History{}, nil)
+	var response bytes.Buffer
+	err := historyUC.ExportUserHistory(context.Background(), fakeForm, &response)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, len(fakePage)+1, strings.Count(response.String(), "\n"))
+	}
+}
+
+func TestUseCase_ExportUserHistoryCanceled(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormUserHistory{
+		UserID: 1,
+		Limit:  errors.DefaultHistoryLimit,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	historyUC := New(cfg, historyRepo)
+
+	var response bytes.Buffer
+	err := historyUC.ExportUserHistory(ctx, fakeForm, &response)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrRequestIsCanceled {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrRequestIsCanceled, causeErr)
+	}
+}
+
+func TestUseCase_GetUserSnapshot(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormSnapshot{
+		UserID: 42,
+		At:     time.Date(2023, 8, 15, 14, 0, 0, 0, time.UTC),
+	}
+	fakeMemberships := []models.Membership{
+		{SegmentSlug: "AVITO_VOICE_MESSAGES", Source: models.SourceManual, LastOperation: models.OperationAdd},
+		{SegmentSlug: "AVITO_DISCOUNT_30", Source: models.SourceManual, LastOperation: models.OperationExtend},
+	}
+	fakeResponse := &models.UserSnapshotResponse{
+		UserID:   fakeForm.UserID,
+		At:       fakeForm.At,
+		Segments: fakeMemberships,
+		Count:    2,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	historyUC := New(cfg, historyRepo)
+
+	historyRepo.EXPECT().SelectUserSnapshot(fakeForm.UserID, fakeForm.At).Return(fakeMemberships, nil)
+	response, err := historyUC.GetUserSnapshot(fakeForm)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeResponse, response)
+	}
+}
+
+func TestUseCase_GetSegmentSnapshot(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormSnapshot{
+		Slug:   "AVITO_VOICE_MESSAGES",
+		At:     time.Date(2023, 8, 15, 14, 0, 0, 0, time.UTC),
+		Cursor: 10,
+		Limit:  2,
+	}
+	fakeMembers := []models.Membership{
+		{UserID: 11, Source: models.SourceManual, LastOperation: models.OperationAdd},
+		{UserID: 15, Source: models.SourcePercentage, LastOperation: models.OperationActivate},
+		{UserID: 20, Source: models.SourceManual, LastOperation: models.OperationAdd},
+	}
+	fakeResponse := &models.SegmentSnapshotResponse{
+		Slug:       fakeForm.Slug,
+		At:         fakeForm.At,
+		Members:    fakeMembers[:2],
+		Count:      2,
+		NextCursor: "15",
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	historyUC := New(cfg, historyRepo)
+
+	historyRepo.EXPECT().SelectSegmentSnapshot(fakeForm.Slug, fakeForm.At, fakeForm.Cursor, fakeForm.Limit+1).
+		Return(fakeMembers, nil)
+	response, err := historyUC.GetSegmentSnapshot(fakeForm)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeResponse, response)
 	}
 }
@@ -0,0 +1,100 @@
+package delivery
+
+import (
+	"encoding/json"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	layerUC "github.com/vvinokurshin/AvitoInternship/internal/layer/usecase"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"net/http"
+)
+
+type DeliveryI interface {
+	CreateLayer(w http.ResponseWriter, r *http.Request)
+	GetLayer(w http.ResponseWriter, r *http.Request)
+}
+
+type Delivery struct {
+	cfg *config.Config
+	uc  layerUC.UseCaseI
+}
+
+func New(cfg *config.Config, uc layerUC.UseCaseI) DeliveryI {
+	return &Delivery{
+		cfg: cfg,
+		uc:  uc,
+	}
+}
+
+// CreateLayer godoc
+// @Summary      CreateLayer
+// @Description  create layer of mutually exclusive segments
+// @Tags     layer
+// @Accept	 application/json
+// @Produce  application/json
+// @Param    layer body models.FormLayer true "form layer"
+// @Success 200 {object} models.LayerResponse "layer created"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 409 {object} errors.JSONError "layer with this name already exists"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /layer/create [post]
+func (d *Delivery) CreateLayer(w http.ResponseWriter, r *http.Request) {
+	form := models.FormLayer{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(form); err != nil {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	response, err := d.uc.CreateLayer(form)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, models.LayerResponse{
+		Layer:    *response,
+		Segments: []models.Segment{},
+	})
+}
+
+// GetLayer godoc
+// @Summary      GetLayer
+// @Description  get layer with its segments
+// @Tags     layer
+// @Accept	 application/json
+// @Produce  application/json
+// @Param name path string true "name"
+// @Success 200 {object} models.LayerResponse "success get layer info"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 404 {object} errors.JSONError "layer not found"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /layer/{name} [get]
+func (d *Delivery) GetLayer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name, ok := vars["name"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	layer, segments, err := d.uc.GetLayerByName(name)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, models.LayerResponse{
+		Layer:    *layer,
+		Segments: segments,
+	})
+}
@@ -0,0 +1,94 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-faker/faker/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	mockLayerUC "github.com/vvinokurshin/AvitoInternship/internal/layer/usecase/mocks"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func createConfig() *config.Config {
+	return new(config.Config)
+}
+
+func generateFakeData(data any) {
+	faker.SetRandomMapAndSliceMaxSize(10)
+	faker.SetRandomMapAndSliceMinSize(1)
+	faker.SetRandomStringLength(30)
+
+	faker.FakeData(data)
+}
+
+func TestDelivery_CreateLayer(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeForm models.FormLayer
+	status := http.StatusOK
+	generateFakeData(&fakeForm)
+	fakeLayerResponse := &models.Layer{
+		LayerID: 1,
+		Name:    fakeForm.Name,
+		Salt:    fakeForm.Name,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	layerUC := mockLayerUC.NewMockUseCaseI(ctrl)
+	layerH := New(cfg, layerUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/layer/create", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	layerUC.EXPECT().CreateLayer(fakeForm).Return(fakeLayerResponse, nil)
+	layerH.CreateLayer(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetLayer(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeLayer *models.Layer
+	var fakeSegments []models.Segment
+	status := http.StatusOK
+	generateFakeData(&fakeLayer)
+	generateFakeData(&fakeSegments)
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	layerUC := mockLayerUC.NewMockUseCaseI(ctrl)
+	layerH := New(cfg, layerUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/layer/", nil)
+	vars := map[string]string{
+		"name": fakeLayer.Name,
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	layerUC.EXPECT().GetLayerByName(fakeLayer.Name).Return(fakeLayer, fakeSegments, nil)
+	layerH.GetLayer(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
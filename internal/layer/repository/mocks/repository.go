@@ -0,0 +1,95 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./repository.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/vvinokurshin/AvitoInternship/internal/models"
+)
+
+// MockRepositoryI is a mock of RepositoryI interface.
+type MockRepositoryI struct {
+	ctrl     *gomock.Controller
+	recorder *MockRepositoryIMockRecorder
+}
+
+// MockRepositoryIMockRecorder is the mock recorder for MockRepositoryI.
+type MockRepositoryIMockRecorder struct {
+	mock *MockRepositoryI
+}
+
+// NewMockRepositoryI creates a new mock instance.
+func NewMockRepositoryI(ctrl *gomock.Controller) *MockRepositoryI {
+	mock := &MockRepositoryI{ctrl: ctrl}
+	mock.recorder = &MockRepositoryIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRepositoryI) EXPECT() *MockRepositoryIMockRecorder {
+	return m.recorder
+}
+
+// InsertLayer mocks base method.
+func (m *MockRepositoryI) InsertLayer(layer *models.Layer) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertLayer", layer)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertLayer indicates an expected call of InsertLayer.
+func (mr *MockRepositoryIMockRecorder) InsertLayer(layer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertLayer", reflect.TypeOf((*MockRepositoryI)(nil).InsertLayer), layer)
+}
+
+// SelectLayerByID mocks base method.
+func (m *MockRepositoryI) SelectLayerByID(layerID uint64) (*models.Layer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectLayerByID", layerID)
+	ret0, _ := ret[0].(*models.Layer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectLayerByID indicates an expected call of SelectLayerByID.
+func (mr *MockRepositoryIMockRecorder) SelectLayerByID(layerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectLayerByID", reflect.TypeOf((*MockRepositoryI)(nil).SelectLayerByID), layerID)
+}
+
+// SelectLayerByName mocks base method.
+func (m *MockRepositoryI) SelectLayerByName(name string) (*models.Layer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectLayerByName", name)
+	ret0, _ := ret[0].(*models.Layer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectLayerByName indicates an expected call of SelectLayerByName.
+func (mr *MockRepositoryIMockRecorder) SelectLayerByName(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectLayerByName", reflect.TypeOf((*MockRepositoryI)(nil).SelectLayerByName), name)
+}
+
+// SelectLayerForUpdate mocks base method.
+func (m *MockRepositoryI) SelectLayerForUpdate(layerID uint64) (*models.Layer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectLayerForUpdate", layerID)
+	ret0, _ := ret[0].(*models.Layer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectLayerForUpdate indicates an expected call of SelectLayerForUpdate.
+func (mr *MockRepositoryIMockRecorder) SelectLayerForUpdate(layerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectLayerForUpdate", reflect.TypeOf((*MockRepositoryI)(nil).SelectLayerForUpdate), layerID)
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"fmt"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+)
+
+type Layer struct {
+	LayerID   uint64 `gorm:"primary_key"`
+	Name      string
+	Salt      string
+	Exclusive bool
+}
+
+func (Layer) TableName(schemaName, tableName string) string {
+	return fmt.Sprintf("%s.%s", schemaName, tableName)
+}
+
+func (l *Layer) FromLayerModel(layer *models.Layer) {
+	l.LayerID = layer.LayerID
+	l.Name = layer.Name
+	l.Salt = layer.Salt
+	l.Exclusive = layer.Exclusive
+}
+
+func (l *Layer) ToLayerModel() *models.Layer {
+	return &models.Layer{
+		LayerID:   l.LayerID,
+		Name:      l.Name,
+		Salt:      l.Salt,
+		Exclusive: l.Exclusive,
+	}
+}
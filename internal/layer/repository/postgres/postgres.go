@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"github.com/vvinokurshin/AvitoInternship/internal/layer/repository"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type layerRepo struct {
+	cfg *config.Config
+	db  *gorm.DB
+}
+
+func New(cfg *config.Config, db *gorm.DB) repository.RepositoryI {
+	return &layerRepo{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+func (repo *layerRepo) InsertLayer(layer *models.Layer) (uint64, error) {
+	var dbLayer Layer
+	dbLayer.FromLayerModel(layer)
+
+	tx := repo.db.Table(Layer{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBLayerTableName)).Create(&dbLayer)
+	if err := tx.Error; err != nil {
+		return 0, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbLayer.LayerID, nil
+}
+
+func (repo *layerRepo) SelectLayerByName(name string) (*models.Layer, error) {
+	var dbLayer Layer
+
+	tx := repo.db.Table(Layer{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBLayerTableName)).
+		Where("name = ?", name).Take(&dbLayer)
+	if err := tx.Error; err != nil {
+		if pkgErrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrLayerNotFound
+		}
+
+		return nil, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbLayer.ToLayerModel(), nil
+}
+
+func (repo *layerRepo) SelectLayerByID(layerID uint64) (*models.Layer, error) {
+	var dbLayer Layer
+
+	tx := repo.db.Table(Layer{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBLayerTableName)).
+		Where("layer_id = ?", layerID).Take(&dbLayer)
+	if err := tx.Error; err != nil {
+		if pkgErrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrLayerNotFound
+		}
+
+		return nil, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbLayer.ToLayerModel(), nil
+}
+
+func (repo *layerRepo) SelectLayerForUpdate(layerID uint64) (*models.Layer, error) {
+	var dbLayer Layer
+
+	tx := repo.db.Table(Layer{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBLayerTableName)).
+		Clauses(clause.Locking{Strength: "UPDATE"}).Where("layer_id = ?", layerID).Take(&dbLayer)
+	if err := tx.Error; err != nil {
+		if pkgErrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrLayerNotFound
+		}
+
+		return nil, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbLayer.ToLayerModel(), nil
+}
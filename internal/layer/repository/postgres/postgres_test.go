@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/go-faker/faker/v4"
+	pkgErr "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"regexp"
+	"testing"
+)
+
+func createConfig() *config.Config {
+	cfg := new(config.Config)
+	cfg.DB.DBSchemaName = "app"
+	cfg.DB.DBLayerTableName = "layers"
+
+	return cfg
+}
+
+func mockDB() (*sql.DB, *gorm.DB, sqlmock.Sqlmock, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("mocking database error: %s", err)
+	}
+
+	dialector := postgres.New(postgres.Config{
+		DSN:                  "sqlmock_db_0",
+		DriverName:           "postgres",
+		Conn:                 db,
+		PreferSimpleProtocol: true,
+	})
+	gormDB, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("opening gorm error: %s", err)
+	}
+
+	return db, gormDB, mock, nil
+}
+
+func generateFakeData(data any) {
+	faker.SetRandomMapAndSliceMaxSize(10)
+	faker.SetRandomMapAndSliceMinSize(1)
+	faker.SetRandomStringLength(30)
+
+	faker.FakeData(data)
+}
+
+func TestRepository_InsertLayer(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeLayer *models.Layer
+	generateFakeData(&fakeLayer)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	createLayerRow := sqlmock.NewRows([]string{"layer_id"}).
+		AddRow(fakeLayer.LayerID)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."layers" ("name","salt","exclusive","layer_id")
+	VALUES ($1,$2,$3,$4) RETURNING "layer_id"`)).WithArgs(fakeLayer.Name, fakeLayer.Salt, fakeLayer.Exclusive, fakeLayer.LayerID).
+		WillReturnRows(createLayerRow)
+	mock.ExpectCommit()
+
+	layerRep := New(cfg, gormDB)
+	layerID, err := layerRep.InsertLayer(fakeLayer)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeLayer.LayerID, layerID)
+	}
+}
+
+func TestRepository_SelectLayerByName(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeLayer *models.Layer
+	generateFakeData(&fakeLayer)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"layer_id", "name", "salt", "exclusive"}).
+		AddRow(fakeLayer.LayerID, fakeLayer.Name, fakeLayer.Salt, fakeLayer.Exclusive)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."layers" WHERE name = $1 LIMIT 1`)).
+		WithArgs(fakeLayer.Name).WillReturnRows(rows)
+
+	layerRep := New(cfg, gormDB)
+	response, err := layerRep.SelectLayerByName(fakeLayer.Name)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeLayer, response)
+	}
+}
+
+func TestRepository_SelectLayerByID(t *testing.T) {
+	cfg := createConfig()
+
+	layerID := uint64(1)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."layers" WHERE layer_id = $1 LIMIT 1`)).
+		WithArgs(layerID).WillReturnError(gorm.ErrRecordNotFound)
+
+	layerRep := New(cfg, gormDB)
+	_, err = layerRep.SelectLayerByID(layerID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrLayerNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrLayerNotFound, causeErr)
+	}
+}
+
+func TestRepository_SelectLayerForUpdate(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeLayer *models.Layer
+	generateFakeData(&fakeLayer)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"layer_id", "name", "salt", "exclusive"}).
+		AddRow(fakeLayer.LayerID, fakeLayer.Name, fakeLayer.Salt, fakeLayer.Exclusive)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."layers" WHERE layer_id = $1 LIMIT 1 FOR UPDATE`)).
+		WithArgs(fakeLayer.LayerID).WillReturnRows(rows)
+
+	layerRep := New(cfg, gormDB)
+	response, err := layerRep.SelectLayerForUpdate(fakeLayer.LayerID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeLayer, response)
+	}
+}
@@ -0,0 +1,14 @@
+package repository
+
+import "github.com/vvinokurshin/AvitoInternship/internal/models"
+
+//go:generate mockgen -destination=./mocks/repository.go -source=./repository.go -package=mocks
+
+type RepositoryI interface {
+	InsertLayer(layer *models.Layer) (uint64, error)
+	SelectLayerByName(name string) (*models.Layer, error)
+	SelectLayerByID(layerID uint64) (*models.Layer, error)
+	// SelectLayerForUpdate locks the layer row until the end of the transaction, so slices of the layer
+	// are allocated to one segment at a time.
+	SelectLayerForUpdate(layerID uint64) (*models.Layer, error)
+}
@@ -0,0 +1,66 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./usecase.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/vvinokurshin/AvitoInternship/internal/models"
+)
+
+// MockUseCaseI is a mock of UseCaseI interface.
+type MockUseCaseI struct {
+	ctrl     *gomock.Controller
+	recorder *MockUseCaseIMockRecorder
+}
+
+// MockUseCaseIMockRecorder is the mock recorder for MockUseCaseI.
+type MockUseCaseIMockRecorder struct {
+	mock *MockUseCaseI
+}
+
+// NewMockUseCaseI creates a new mock instance.
+func NewMockUseCaseI(ctrl *gomock.Controller) *MockUseCaseI {
+	mock := &MockUseCaseI{ctrl: ctrl}
+	mock.recorder = &MockUseCaseIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUseCaseI) EXPECT() *MockUseCaseIMockRecorder {
+	return m.recorder
+}
+
+// CreateLayer mocks base method.
+func (m *MockUseCaseI) CreateLayer(form models.FormLayer) (*models.Layer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLayer", form)
+	ret0, _ := ret[0].(*models.Layer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLayer indicates an expected call of CreateLayer.
+func (mr *MockUseCaseIMockRecorder) CreateLayer(form interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLayer", reflect.TypeOf((*MockUseCaseI)(nil).CreateLayer), form)
+}
+
+// GetLayerByName mocks base method.
+func (m *MockUseCaseI) GetLayerByName(name string) (*models.Layer, []models.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLayerByName", name)
+	ret0, _ := ret[0].(*models.Layer)
+	ret1, _ := ret[1].([]models.Segment)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetLayerByName indicates an expected call of GetLayerByName.
+func (mr *MockUseCaseIMockRecorder) GetLayerByName(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLayerByName", reflect.TypeOf((*MockUseCaseI)(nil).GetLayerByName), name)
+}
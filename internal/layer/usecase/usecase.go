@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	pkgErr "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	layerRepository "github.com/vvinokurshin/AvitoInternship/internal/layer/repository"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+)
+
+//go:generate mockgen -destination=./mocks/usecase.go -source=./usecase.go -package=mocks
+
+type UseCaseI interface {
+	CreateLayer(form models.FormLayer) (*models.Layer, error)
+	GetLayerByName(name string) (*models.Layer, []models.Segment, error)
+}
+
+type UseCase struct {
+	cfg         *config.Config
+	layerRepo   layerRepository.RepositoryI
+	segmentRepo segmentRepository.RepositoryI
+}
+
+func New(cfg *config.Config, layerRepo layerRepository.RepositoryI, segmentRepo segmentRepository.RepositoryI) UseCaseI {
+	return &UseCase{
+		cfg:         cfg,
+		layerRepo:   layerRepo,
+		segmentRepo: segmentRepo,
+	}
+}
+
+func (uc *UseCase) CreateLayer(form models.FormLayer) (*models.Layer, error) {
+	_, err := uc.layerRepo.SelectLayerByName(form.Name)
+	if err != errors.ErrLayerNotFound {
+		return nil, errors.ErrLayerExists
+	}
+
+	layer := &models.Layer{
+		Name:      form.Name,
+		Salt:      form.Name,
+		Exclusive: true,
+	}
+	if form.Salt != nil {
+		layer.Salt = *form.Salt
+	}
+	if form.Exclusive != nil {
+		layer.Exclusive = *form.Exclusive
+	}
+
+	layerID, err := uc.layerRepo.InsertLayer(layer)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "insert layer")
+	}
+
+	layer.LayerID = layerID
+	return layer, nil
+}
+
+func (uc *UseCase) GetLayerByName(name string) (*models.Layer, []models.Segment, error) {
+	layer, err := uc.layerRepo.SelectLayerByName(name)
+	if err != nil {
+		return nil, nil, pkgErr.Wrap(err, "select layer by name")
+	}
+
+	segments, err := uc.segmentRepo.SelectSegmentsByLayer(layer.LayerID)
+	if err != nil {
+		return nil, nil, pkgErr.Wrap(err, "select segments by layer")
+	}
+
+	return layer, segments, nil
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"github.com/go-faker/faker/v4"
+	"github.com/golang/mock/gomock"
+	pkgErr "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	mockLayerRepo "github.com/vvinokurshin/AvitoInternship/internal/layer/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	mockSegmentRepo "github.com/vvinokurshin/AvitoInternship/internal/segment/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"testing"
+)
+
+func createConfig() *config.Config {
+	return new(config.Config)
+}
+
+func generateFakeData(data any) {
+	faker.SetRandomMapAndSliceMaxSize(10)
+	faker.SetRandomMapAndSliceMinSize(1)
+	faker.SetRandomStringLength(30)
+
+	faker.FakeData(data)
+}
+
+func TestUseCase_CreateLayer(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeForm models.FormLayer
+	generateFakeData(&fakeForm)
+	fakeForm.Salt = nil
+	fakeForm.Exclusive = nil
+	fakeLayer := &models.Layer{
+		Name:      fakeForm.Name,
+		Salt:      fakeForm.Name,
+		Exclusive: true,
+	}
+	fakeLayerResponse := &models.Layer{
+		LayerID:   1,
+		Name:      fakeForm.Name,
+		Salt:      fakeForm.Name,
+		Exclusive: true,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	layerUC := New(cfg, layerRepo, segmentRepo)
+
+	layerRepo.EXPECT().SelectLayerByName(fakeForm.Name).Return(nil, errors.ErrLayerNotFound)
+	layerRepo.EXPECT().InsertLayer(fakeLayer).Return(uint64(1), nil)
+	response, err := layerUC.CreateLayer(fakeForm)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeLayerResponse, response)
+	}
+}
+
+func TestUseCase_GetLayerByName(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeLayer *models.Layer
+	var fakeSegments []models.Segment
+	generateFakeData(&fakeLayer)
+	generateFakeData(&fakeSegments)
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	layerUC := New(cfg, layerRepo, segmentRepo)
+
+	layerRepo.EXPECT().SelectLayerByName(fakeLayer.Name).Return(fakeLayer, nil)
+	segmentRepo.EXPECT().SelectSegmentsByLayer(fakeLayer.LayerID).Return(fakeSegments, nil)
+	layer, segments, err := layerUC.GetLayerByName(fakeLayer.Name)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeLayer, layer)
+		require.Equal(t, fakeSegments, segments)
+	}
+}
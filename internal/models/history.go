@@ -2,19 +2,262 @@ package models
 
 import (
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"strconv"
 	"time"
+	"unicode/utf8"
 )
 
+const (
+	OperationAdd        = "ADD"
+	OperationDel        = "DEL"
+	OperationActivate   = "ACTIVATE"
+	OperationDeactivate = "DEACTIVATE"
+	OperationExpire     = "EXPIRE"
+	OperationExtend     = "EXTEND"
+)
+
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatExcel   = "excel"
+	ExportFormatNDJSON  = "ndjson"
+	ExportFormatParquet = "parquet"
+)
+
+// DefaultDelimiter separates the columns of CSV exports unless another one is requested.
+const DefaultDelimiter = ';'
+
+// ActorSystem marks changes made by background jobs rather than API clients.
+const ActorSystem = "system"
+
 type History struct {
+	RecordID    uint64 `json:"recordID"`
 	UserID      uint64 `json:"userID"`
 	SegmentSlug string `json:"segmentSlug"`
 	Operation   string `json:"operation"`
+	Source      string `json:"source"`
+	Variant     string `json:"variant"`
+	Actor       string `json:"actor"`
+	Reason      string `json:"reason"`
 	Datetime    string `json:"datetime"`
 }
 
+// HistoryRecord is an append-only entry of the membership log: records are inserted and never updated.
+type HistoryRecord struct {
+	UserID      uint64
+	SegmentSlug string
+	Operation   string
+	Source      string
+	Variant     string
+	Actor       string
+	Reason      string
+	RequestID   string
+	Datetime    time.Time
+}
+
+// Change describes who made a membership change, why and within which request.
+type Change struct {
+	Actor     string
+	Reason    string
+	RequestID string
+}
+
+// WithReason overrides the reason when the given one is not empty.
+func (c Change) WithReason(reason string) Change {
+	if reason != "" {
+		c.Reason = reason
+	}
+
+	return c
+}
+
+// Record builds a history record of the change for a single membership.
+func (c Change) Record(userID uint64, segmentSlug, operation, source, variant string, datetime time.Time) HistoryRecord {
+	return HistoryRecord{
+		UserID:      userID,
+		SegmentSlug: segmentSlug,
+		Operation:   operation,
+		Source:      source,
+		Variant:     variant,
+		Actor:       c.Actor,
+		Reason:      c.Reason,
+		RequestID:   c.RequestID,
+		Datetime:    datetime,
+	}
+}
+
 type FormHistory struct {
-	Year  int        `json:"year"`
-	Month time.Month `json:"month"`
+	Year   int          `json:"year"`
+	Month  time.Month   `json:"month"`
+	Format ExportFormat `json:"-"`
+}
+
+// ExportFormat describes the file the history is exported to, the zero value is CSV separated by DefaultDelimiter.
+type ExportFormat struct {
+	Name      string
+	Delimiter rune
+}
+
+// HistoryDateLayout is accepted in history periods along with RFC 3339.
+const HistoryDateLayout = "2006-01-02"
+
+type FormUserHistory struct {
+	UserID  uint64
+	Segment string
+	From    *time.Time
+	To      *time.Time
+	Cursor  uint64
+	Limit   int
+	Format  ExportFormat
+}
+
+// HistoryFilter selects a page of records: records are append-only, so record_id grows with insertion time
+// and keyset pagination by it is stable while new records are written.
+type HistoryFilter struct {
+	UserID  uint64
+	Segment string
+	From    *time.Time
+	To      *time.Time
+	AfterID uint64
+	Limit   int
+}
+
+type UserHistoryResponse struct {
+	Records    []History `json:"records"`
+	Count      int       `json:"count"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// FormSnapshot asks for the memberships of a user or the members of a segment at a moment in the past.
+// Members of a segment are returned page by page ordered by user id.
+type FormSnapshot struct {
+	UserID uint64
+	Slug   string
+	At     time.Time
+	Cursor uint64
+	Limit  int
+}
+
+// Membership is restored from history: it is the state left by the last change made before the moment.
+type Membership struct {
+	UserID        uint64     `json:"userID,omitempty"`
+	SegmentSlug   string     `json:"segmentSlug,omitempty"`
+	Source        string     `json:"source"`
+	Variant       string     `json:"variant,omitempty"`
+	Since         *time.Time `json:"since,omitempty"`
+	LastOperation string     `json:"lastOperation"`
+	ChangedAt     time.Time  `json:"changedAt"`
+	Actor         string     `json:"actor,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+}
+
+type UserSnapshotResponse struct {
+	UserID   uint64       `json:"userID"`
+	At       time.Time    `json:"at"`
+	Segments []Membership `json:"segments"`
+	Count    int          `json:"count"`
+}
+
+type SegmentSnapshotResponse struct {
+	Slug       string       `json:"slug"`
+	At         time.Time    `json:"at"`
+	Members    []Membership `json:"members"`
+	Count      int          `json:"count"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// ParseHistoryTime parses a bound of a history period in UTC: RFC 3339 or a date, which is taken as midnight.
+func ParseHistoryTime(value string) (time.Time, error) {
+	if datetime, err := time.Parse(time.RFC3339, value); err == nil {
+		return datetime.UTC(), nil
+	}
+
+	return time.Parse(HistoryDateLayout, value)
+}
+
+// ParseExportFormat checks the format name and the delimiter, which can be set only for CSV formats.
+func ParseExportFormat(name, delimiter string) (ExportFormat, error) {
+	switch name {
+	case ExportFormatCSV, ExportFormatExcel, ExportFormatNDJSON, ExportFormatParquet:
+	default:
+		return ExportFormat{}, errors.ErrFormatIsInvalid
+	}
+
+	format := ExportFormat{
+		Name:      name,
+		Delimiter: DefaultDelimiter,
+	}
+	if delimiter == "" {
+		return format, nil
+	}
+
+	if name != ExportFormatCSV && name != ExportFormatExcel {
+		return ExportFormat{}, errors.ErrDelimiterIsInvalid
+	}
+
+	// the same characters are rejected by encoding/csv
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == 0 || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return ExportFormat{}, errors.ErrDelimiterIsInvalid
+	}
+	format.Delimiter = r
+
+	return format, nil
+}
+
+func (format ExportFormat) Extension() string {
+	switch format.Name {
+	case ExportFormatNDJSON:
+		return ".ndjson"
+	case ExportFormatParquet:
+		return ".parquet"
+	default:
+		return ".csv"
+	}
+}
+
+func (form *FormUserHistory) Validate() error {
+	if form.From != nil && form.To != nil && !form.From.Before(*form.To) {
+		return errors.ErrPeriodIsInvalid
+	}
+
+	if form.Limit == 0 {
+		form.Limit = errors.DefaultHistoryLimit
+	}
+	if form.Limit < 0 || form.Limit > errors.MaxHistoryLimit {
+		return errors.ErrLimitIsInvalid
+	}
+
+	return nil
+}
+
+func (form *FormSnapshot) Validate() error {
+	if form.Limit == 0 {
+		form.Limit = errors.DefaultHistoryLimit
+	}
+	if form.Limit < 0 || form.Limit > errors.MaxHistoryLimit {
+		return errors.ErrLimitIsInvalid
+	}
+
+	return nil
+}
+
+func (form *FormUserHistory) FileName() string {
+	return "history-user-" + strconv.FormatUint(form.UserID, 10) + form.Format.Extension()
+}
+
+func (form *FormUserHistory) Filter() HistoryFilter {
+	return HistoryFilter{
+		UserID:  form.UserID,
+		Segment: form.Segment,
+		From:    form.From,
+		To:      form.To,
+		AfterID: form.Cursor,
+		Limit:   form.Limit,
+	}
+}
+
+func (form *FormHistory) FileName() string {
+	return "history-" + strconv.Itoa(form.Year) + "-" + strconv.Itoa(int(form.Month)) + form.Format.Extension()
 }
 
 func (form *FormHistory) Validate() error {
@@ -0,0 +1,19 @@
+package models
+
+type Layer struct {
+	LayerID   uint64 `json:"layerID"`
+	Name      string `json:"name"`
+	Salt      string `json:"salt"`
+	Exclusive bool   `json:"exclusive"`
+}
+
+type FormLayer struct {
+	Name      string  `json:"name" validate:"required"`
+	Salt      *string `json:"salt"`
+	Exclusive *bool   `json:"exclusive"`
+}
+
+type LayerResponse struct {
+	Layer    Layer     `json:"layer"`
+	Segments []Segment `json:"segments"`
+}
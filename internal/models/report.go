@@ -0,0 +1,97 @@
+package models
+
+import (
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"time"
+)
+
+const (
+	ReportTypeHistory     = "history"
+	ReportTypeUserHistory = "userHistory"
+)
+
+const (
+	ReportStatusPending = "PENDING"
+	ReportStatusRunning = "RUNNING"
+	ReportStatusDone    = "DONE"
+	ReportStatusFailed  = "FAILED"
+	ReportStatusExpired = "EXPIRED"
+)
+
+type Report struct {
+	ReportID   uint64     `json:"reportID"`
+	Params     FormReport `json:"params"`
+	Status     string     `json:"status"`
+	FileName   string     `json:"-"`
+	URL        string     `json:"url,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// FormReport describes the report to build: the monthly history of all users (year, month)
+// or the history of a single user (userID, segment, from, to).
+type FormReport struct {
+	Type    string     `json:"type" validate:"required,oneof=history userHistory"`
+	Year    int        `json:"year,omitempty"`
+	Month   time.Month `json:"month,omitempty"`
+	UserID  uint64     `json:"userID,omitempty"`
+	Segment string     `json:"segment,omitempty"`
+	From    string     `json:"from,omitempty"`
+	To      string     `json:"to,omitempty"`
+}
+
+type ReportResponse struct {
+	Report Report `json:"report"`
+}
+
+func (form *FormReport) Validate() error {
+	if form.Type == ReportTypeHistory {
+		history := form.History()
+		return history.Validate()
+	}
+
+	_, err := form.UserHistory()
+	return err
+}
+
+func (form *FormReport) History() FormHistory {
+	return FormHistory{
+		Year:  form.Year,
+		Month: form.Month,
+	}
+}
+
+func (form *FormReport) UserHistory() (FormUserHistory, error) {
+	userHistory := FormUserHistory{
+		UserID:  form.UserID,
+		Segment: form.Segment,
+	}
+	if form.UserID == 0 {
+		return FormUserHistory{}, errors.ErrInvalidForm
+	}
+
+	if form.From != "" {
+		from, err := ParseHistoryTime(form.From)
+		if err != nil {
+			return FormUserHistory{}, errors.ErrPeriodIsInvalid
+		}
+		userHistory.From = &from
+	}
+
+	if form.To != "" {
+		to, err := ParseHistoryTime(form.To)
+		if err != nil {
+			return FormUserHistory{}, errors.ErrPeriodIsInvalid
+		}
+		userHistory.To = &to
+	}
+
+	err := userHistory.Validate()
+	if err != nil {
+		return FormUserHistory{}, err
+	}
+
+	return userHistory, nil
+}
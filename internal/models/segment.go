@@ -1,19 +1,52 @@
 package models
 
 import (
+	pkgErr "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/pkg/rules"
 	"time"
 )
 
+type Variant struct {
+	Name   string `json:"name" validate:"required"`
+	Weight int    `json:"weight" validate:"required"`
+}
+
 type Segment struct {
-	SegmentID uint64 `json:"segmentID"`
-	Slug      string `json:"slug"`
-	Percent   *int   `json:"percent"`
+	SegmentID   uint64     `json:"segmentID"`
+	Slug        string     `json:"slug"`
+	Percent     *int       `json:"percent"`
+	Salt        string     `json:"salt"`
+	Variants    []Variant  `json:"variants"`
+	LayerID     *uint64    `json:"layerID"`
+	LayerOffset int        `json:"layerOffset"`
+	Rule        *string    `json:"rule"`
+	StartsAt    *time.Time `json:"startsAt"`
+	EndsAt      *time.Time `json:"endsAt"`
+	DefaultTTL  *string    `json:"defaultTTL"`
+	ArchivedAt  *time.Time `json:"archivedAt"`
+}
+
+// IsActive reports whether the moment falls into the segment's [startsAt, endsAt) window.
+func (s *Segment) IsActive(moment time.Time) bool {
+	if s.StartsAt != nil && moment.Before(*s.StartsAt) {
+		return false
+	}
+
+	return s.EndsAt == nil || moment.Before(*s.EndsAt)
 }
 
 type FormSegment struct {
-	Slug    string `json:"slug" validate:"required"`
-	Percent *int   `json:"percent"`
+	Slug       string     `json:"slug" validate:"required"`
+	Percent    *int       `json:"percent"`
+	Salt       *string    `json:"salt"`
+	Variants   []Variant  `json:"variants" validate:"dive"`
+	Layer      *string    `json:"layer"`
+	Rule       *string    `json:"rule"`
+	StartsAt   *time.Time `json:"startsAt"`
+	EndsAt     *time.Time `json:"endsAt"`
+	DefaultTTL *string    `json:"defaultTTL"`
+	Reason     string     `json:"reason" validate:"max=500"`
 }
 
 func (form *FormSegment) Validate() error {
@@ -23,6 +56,71 @@ func (form *FormSegment) Validate() error {
 		}
 	}
 
+	names := make(map[string]struct{}, len(form.Variants))
+	for _, variant := range form.Variants {
+		if _, ok := names[variant.Name]; ok || variant.Weight < errors.MinWeight {
+			return errors.ErrVariantsAreInvalid
+		}
+		names[variant.Name] = struct{}{}
+	}
+
+	if form.Rule != nil {
+		if _, err := rules.Parse(*form.Rule); err != nil {
+			return pkgErr.Wrap(errors.ErrRuleIsInvalid, err.Error())
+		}
+	}
+
+	if form.StartsAt != nil && form.EndsAt != nil && !form.StartsAt.Before(*form.EndsAt) {
+		return errors.ErrScheduleIsInvalid
+	}
+
+	if form.DefaultTTL != nil {
+		if _, err := ParseTTL(*form.DefaultTTL); err != nil {
+			return errors.ErrTTLIsInvalid
+		}
+	}
+
+	return nil
+}
+
+// FormUpdateSegment changes the rollout; an empty rule removes targeting from the segment
+// and an empty default TTL makes memberships permanent by default.
+type FormUpdateSegment struct {
+	Percent    *int       `json:"percent"`
+	Rule       *string    `json:"rule"`
+	StartsAt   *time.Time `json:"startsAt"`
+	EndsAt     *time.Time `json:"endsAt"`
+	DefaultTTL *string    `json:"defaultTTL"`
+	Reason     string     `json:"reason" validate:"max=500"`
+}
+
+func (form *FormUpdateSegment) Validate() error {
+	if form.Percent == nil && form.Rule == nil && form.StartsAt == nil && form.EndsAt == nil && form.DefaultTTL == nil {
+		return errors.ErrInvalidForm
+	}
+
+	if form.Percent != nil {
+		if *form.Percent < errors.MinPercent || *form.Percent > errors.MaxPercent {
+			return errors.ErrPercentIsInvalid
+		}
+	}
+
+	if form.Rule != nil && *form.Rule != "" {
+		if _, err := rules.Parse(*form.Rule); err != nil {
+			return pkgErr.Wrap(errors.ErrRuleIsInvalid, err.Error())
+		}
+	}
+
+	if form.StartsAt != nil && form.EndsAt != nil && !form.StartsAt.Before(*form.EndsAt) {
+		return errors.ErrScheduleIsInvalid
+	}
+
+	if form.DefaultTTL != nil && *form.DefaultTTL != "" {
+		if _, err := ParseTTL(*form.DefaultTTL); err != nil {
+			return errors.ErrTTLIsInvalid
+		}
+	}
+
 	return nil
 }
 
@@ -35,26 +133,253 @@ type SegmentsResponse struct {
 	Count    int       `json:"count"`
 }
 
+type UserSegment struct {
+	Segment
+	Source  string  `json:"source"`
+	Variant string  `json:"variant,omitempty"`
+	Until   *string `json:"until"`
+}
+
+type UserSegmentsResponse struct {
+	Segments []UserSegment `json:"segments"`
+	Count    int           `json:"count"`
+}
+
+type FormUsersSegments struct {
+	UserIDs []uint64 `json:"userIDs"`
+}
+
+// UsersSegmentsResponse maps user IDs to their active segments, IDs of missing users are listed apart.
+type UsersSegmentsResponse struct {
+	Users   map[uint64][]UserSegment `json:"users"`
+	Unknown []uint64                 `json:"unknownUserIDs"`
+}
+
+// SegmentSummary is a segment with the number of its current members, members of rule segments are
+// matched on read and not counted, so it is null for them.
+type SegmentSummary struct {
+	Segment
+	Members *int64 `json:"members"`
+}
+
+type SegmentSummariesResponse struct {
+	Segments []SegmentSummary `json:"segments"`
+	Count    int              `json:"count"`
+}
+
+type SegmentUser struct {
+	UserID  uint64    `json:"userID"`
+	Source  string    `json:"source"`
+	Variant string    `json:"variant,omitempty"`
+	Until   *string   `json:"until"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// SegmentUsersResponse holds a page of members, count is the number of all members matching the filters.
+type SegmentUsersResponse struct {
+	Users      []SegmentUser `json:"users"`
+	Count      int64         `json:"count"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+type FormSegmentUsers struct {
+	Slug           string
+	Source         string
+	ExpiringBefore *time.Time
+	AddedAfter     *time.Time
+	Cursor         uint64
+	Limit          int
+}
+
+// SegmentUsersFilter selects a page of members ordered by user id, the page bounds are ignored by counting.
+type SegmentUsersFilter struct {
+	Source         string
+	ExpiringBefore *time.Time
+	AddedAfter     *time.Time
+	AfterUserID    uint64
+	Limit          int
+}
+
+func (form *FormSegmentUsers) Validate() error {
+	switch form.Source {
+	case "", SourceManual, SourcePercentage, SourceImport, SourceAPI:
+	case SourceRule:
+		return errors.ErrRuleSegmentMembers
+	default:
+		return errors.ErrSourceIsInvalid
+	}
+
+	if form.Limit == 0 {
+		form.Limit = errors.DefaultSegmentUsersLimit
+	}
+	if form.Limit < 0 || form.Limit > errors.MaxSegmentUsersLimit {
+		return errors.ErrLimitIsInvalid
+	}
+
+	return nil
+}
+
+func (form *FormSegmentUsers) Filter() SegmentUsersFilter {
+	return SegmentUsersFilter{
+		Source:         form.Source,
+		ExpiringBefore: form.ExpiringBefore,
+		AddedAfter:     form.AddedAfter,
+		AfterUserID:    form.Cursor,
+		Limit:          form.Limit,
+	}
+}
+
+const (
+	SourceManual     = "MANUAL"
+	SourcePercentage = "PERCENTAGE"
+	SourceRule       = "RULE"
+	SourceImport     = "IMPORT"
+	SourceAPI        = "API"
+)
+
+// AddUserToSegment limits the membership either by an absolute until or by a ttl relative to the request;
+// without both the segment's default TTL applies.
 type AddUserToSegment struct {
 	SegmentSlug string  `json:"segmentSlug"`
 	SegmentID   uint64  `json:"-"`
 	Until       *string `json:"until"`
+	TTL         *string `json:"ttl"`
+	Source      string  `json:"-"`
+	Variant     string  `json:"-"`
+}
+
+// UntilLegacyLayout is the zone-less format of until accepted for compatibility; it is read in Moscow time
+// as it always was.
+const UntilLegacyLayout = "2006-01-02 15:04"
+
+// untilLegacyZone is Moscow time, which has stayed UTC+3 since 2014; a fixed zone does not depend on tzdata.
+var untilLegacyZone = time.FixedZone("MSK", 3*60*60)
+
+// ParseUntil reads an RFC 3339 timestamp or a timestamp in UntilLegacyLayout.
+func ParseUntil(value string) (time.Time, error) {
+	until, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return until, nil
+	}
+
+	return time.ParseInLocation(UntilLegacyLayout, value, untilLegacyZone)
+}
+
+// ParseTTL reads a positive Go duration such as "48h" or "90m".
+func ParseTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, errors.ErrTTLIsInvalid
+	}
+
+	return ttl, nil
+}
+
+// FormatUntil is the form in which until is stored and returned: RFC 3339 in UTC.
+func FormatUntil(until time.Time) string {
+	return until.UTC().Format(time.RFC3339)
+}
+
+type SegmentMember struct {
+	UserID  uint64
+	Variant string
+}
+
+// FormSegmentUsersBulk adds or removes many users at once, until, ttl and source apply to all of them on adding.
+type FormSegmentUsersBulk struct {
+	UserIDs []uint64 `json:"userIDs"`
+	Until   *string  `json:"until"`
+	TTL     *string  `json:"ttl"`
+	Source  string   `json:"source" validate:"omitempty,oneof=MANUAL IMPORT API"`
+	Reason  string   `json:"reason" validate:"max=500"`
+}
+
+func (form *FormSegmentUsersBulk) Validate() error {
+	if len(form.UserIDs) == 0 {
+		return pkgErr.Wrap(errors.ErrUserIDsAreInvalid, "no user IDs")
+	}
+
+	if form.Source == "" {
+		form.Source = SourceImport
+	}
+
+	if form.Until != nil && form.TTL != nil {
+		return pkgErr.Wrap(errors.ErrInvalidForm, "until and ttl are mutually exclusive")
+	}
+
+	if form.Until != nil {
+		until, err := ParseUntil(*form.Until)
+		if err != nil {
+			return errors.ErrUntilIsInvalid
+		}
+
+		formatted := FormatUntil(until)
+		form.Until = &formatted
+	}
+
+	if form.TTL != nil {
+		ttl, err := ParseTTL(*form.TTL)
+		if err != nil {
+			return errors.ErrTTLIsInvalid
+		}
+
+		formatted := FormatUntil(time.Now().Add(ttl))
+		form.Until = &formatted
+		form.TTL = nil
+	}
+
+	return nil
+}
+
+// SegmentUsersBulkResponse reports how many users were added or removed and which IDs were skipped:
+// unknown users do not exist, conflicting ones already belong to another segment of the exclusive layer.
+type SegmentUsersBulkResponse struct {
+	Processed   int      `json:"processed"`
+	Unknown     []uint64 `json:"unknownUserIDs"`
+	Conflicting []uint64 `json:"conflictingUserIDs"`
 }
 
 type FormEditSegments struct {
 	SegmentsToAdd    []AddUserToSegment `json:"segmentsToAdd"`
 	SegmentsToRemove []string           `json:"segmentsToRemove"`
+	Source           string             `json:"source" validate:"omitempty,oneof=MANUAL IMPORT API"`
+	Reason           string             `json:"reason" validate:"max=500"`
 }
 
 func (form *FormEditSegments) Validate() error {
+	if form.Source == "" {
+		form.Source = SourceManual
+	}
+
+	now := time.Now()
 	for idx, segment := range form.SegmentsToAdd {
+		form.SegmentsToAdd[idx].Source = form.Source
+
+		if segment.Until != nil && segment.TTL != nil {
+			return pkgErr.Wrap(errors.ErrInvalidForm, "until and ttl are mutually exclusive")
+		}
+
 		if segment.Until != nil {
-			timeValue, err := time.Parse("2006-01-02 15:04", *segment.Until)
+			until, err := ParseUntil(*segment.Until)
 			if err != nil {
 				return errors.ErrUntilIsInvalid
 			}
-			subtractedTime := timeValue.Add(-3 * time.Hour).Format("2006-01-02 15:04")
-			form.SegmentsToAdd[idx].Until = &subtractedTime
+
+			formatted := FormatUntil(until)
+			form.SegmentsToAdd[idx].Until = &formatted
+		}
+
+		if segment.TTL != nil {
+			ttl, err := ParseTTL(*segment.TTL)
+			if err != nil {
+				return errors.ErrTTLIsInvalid
+			}
+
+			formatted := FormatUntil(now.Add(ttl))
+			form.SegmentsToAdd[idx].Until = &formatted
 		}
 	}
 
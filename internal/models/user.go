@@ -1,16 +1,18 @@
 package models
 
 type User struct {
-	UserID    uint64 `json:"userID"`
-	Username  string `json:"username"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	UserID     uint64            `json:"userID"`
+	Username   string            `json:"username"`
+	FirstName  string            `json:"firstName"`
+	LastName   string            `json:"lastName"`
+	Attributes map[string]string `json:"attributes"`
 }
 
 type FormUser struct {
-	Username  string `json:"username" validate:"required"`
-	FirstName string `json:"firstName" validate:"required"`
-	LastName  string `json:"lastName" validate:"required"`
+	Username   string            `json:"username" validate:"required"`
+	FirstName  string            `json:"firstName" validate:"required"`
+	LastName   string            `json:"lastName" validate:"required"`
+	Attributes map[string]string `json:"attributes"`
 }
 
 type UserResponse struct {
@@ -0,0 +1,136 @@
+package delivery
+
+import (
+	"encoding/json"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	reportUC "github.com/vvinokurshin/AvitoInternship/internal/report/usecase"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type DeliveryI interface {
+	CreateReport(w http.ResponseWriter, r *http.Request)
+	GetReport(w http.ResponseWriter, r *http.Request)
+	DownloadReport(w http.ResponseWriter, r *http.Request)
+}
+
+type Delivery struct {
+	cfg *config.Config
+	uc  reportUC.UseCaseI
+}
+
+func New(cfg *config.Config, uc reportUC.UseCaseI) DeliveryI {
+	return &Delivery{
+		cfg: cfg,
+		uc:  uc,
+	}
+}
+
+// CreateReport godoc
+// @Summary      CreateReport
+// @Description  queue a history report: the monthly history of all users (type history) or the history of a user (type userHistory)
+// @Tags     report
+// @Accept	 application/json
+// @Produce  application/json
+// @Param    report body models.FormReport true "form report"
+// @Success 202 {object} models.ReportResponse "report queued"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 400 {object} errors.JSONError "year is invalid"
+// @Failure 400 {object} errors.JSONError "month is required"
+// @Failure 400 {object} errors.JSONError "period is invalid. format: RFC 3339 or YYYY-MM-DD, from before to"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Failure 503 {object} errors.JSONError "report queue is full, try again later"
+// @Router   /reports [post]
+func (d *Delivery) CreateReport(w http.ResponseWriter, r *http.Request) {
+	form := models.FormReport{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(form); err != nil {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.CreateReport(form)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusAccepted, models.ReportResponse{Report: *response})
+}
+
+// GetReport godoc
+// @Summary      GetReport
+// @Description  get status of a report and a signed url to download it when it is done
+// @Tags     report
+// @Accept	 application/json
+// @Produce  application/json
+// @Param id path int true "id"
+// @Success 200 {object} models.ReportResponse "success get report"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 404 {object} errors.JSONError "report not found"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /reports/{id} [get]
+func (d *Delivery) GetReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	reportID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	response, err := d.uc.GetReport(reportID)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, models.ReportResponse{Report: *response})
+}
+
+// DownloadReport godoc
+// @Summary      DownloadReport
+// @Description  redirect to a fresh signed url of the file of a finished report
+// @Tags     report
+// @Accept	 application/json
+// @Produce  application/json
+// @Param id path int true "id"
+// @Success 302 "redirect to the file"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 404 {object} errors.JSONError "report not found"
+// @Failure 409 {object} errors.JSONError "report is not ready"
+// @Failure 410 {object} errors.JSONError "report has expired"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /reports/{id}/file [get]
+func (d *Delivery) DownloadReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	reportID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	url, err := d.uc.GetReportURL(reportID)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
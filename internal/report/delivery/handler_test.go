@@ -0,0 +1,180 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	mockReportUC "github.com/vvinokurshin/AvitoInternship/internal/report/usecase/mocks"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func createConfig() *config.Config {
+	return new(config.Config)
+}
+
+func TestDelivery_CreateReport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormReport{
+		Type:  models.ReportTypeHistory,
+		Year:  2023,
+		Month: 8,
+	}
+	fakeReportResponse := &models.Report{
+		ReportID: 1,
+		Params:   fakeForm,
+		Status:   models.ReportStatusPending,
+	}
+	status := http.StatusAccepted
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportUC := mockReportUC.NewMockUseCaseI(ctrl)
+	reportH := New(cfg, reportUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/reports", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	reportUC.EXPECT().CreateReport(fakeForm).Return(fakeReportResponse, nil)
+	reportH.CreateReport(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_CreateReportInvalidType(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormReport{
+		Type: "segments",
+	}
+	status := http.StatusBadRequest
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportUC := mockReportUC.NewMockUseCaseI(ctrl)
+	reportH := New(cfg, reportUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/reports", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	reportH.CreateReport(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetReport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReportResponse := &models.Report{
+		ReportID: 1,
+		Status:   models.ReportStatusDone,
+		FileName: "history-2023-8-20230901T100000-0a1b2c3d.csv",
+		URL:      "/api/v1/files/history-2023-8-20230901T100000-0a1b2c3d.csv?expires=1693566000&signature=abc",
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportUC := mockReportUC.NewMockUseCaseI(ctrl)
+	reportH := New(cfg, reportUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/reports/", nil)
+	r = mux.SetURLVars(r, map[string]string{
+		"id": "1",
+	})
+	w := httptest.NewRecorder()
+
+	reportUC.EXPECT().GetReport(uint64(1)).Return(fakeReportResponse, nil)
+	reportH.GetReport(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+
+	var response models.ReportResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("error while unmarshaling from json: %v", err)
+	}
+	require.Equal(t, fakeReportResponse.URL, response.Report.URL)
+}
+
+func TestDelivery_DownloadReport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeURL := "/api/v1/files/history-2023-8-20230901T100000-0a1b2c3d.csv?expires=1693566000&signature=abc"
+	status := http.StatusFound
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportUC := mockReportUC.NewMockUseCaseI(ctrl)
+	reportH := New(cfg, reportUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/reports/", nil)
+	r = mux.SetURLVars(r, map[string]string{
+		"id": "1",
+	})
+	w := httptest.NewRecorder()
+
+	reportUC.EXPECT().GetReportURL(uint64(1)).Return(fakeURL, nil)
+	reportH.DownloadReport(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+	require.Equal(t, fakeURL, w.Header().Get("Location"))
+}
+
+func TestDelivery_DownloadReportNotReady(t *testing.T) {
+	cfg := createConfig()
+
+	status := http.StatusConflict
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportUC := mockReportUC.NewMockUseCaseI(ctrl)
+	reportH := New(cfg, reportUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/reports/", nil)
+	r = mux.SetURLVars(r, map[string]string{
+		"id": "1",
+	})
+	w := httptest.NewRecorder()
+
+	reportUC.EXPECT().GetReportURL(uint64(1)).Return("", errors.ErrReportNotReady)
+	reportH.DownloadReport(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
@@ -0,0 +1,154 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./repository.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/vvinokurshin/AvitoInternship/internal/models"
+)
+
+// MockRepositoryI is a mock of RepositoryI interface.
+type MockRepositoryI struct {
+	ctrl     *gomock.Controller
+	recorder *MockRepositoryIMockRecorder
+}
+
+// MockRepositoryIMockRecorder is the mock recorder for MockRepositoryI.
+type MockRepositoryIMockRecorder struct {
+	mock *MockRepositoryI
+}
+
+// NewMockRepositoryI creates a new mock instance.
+func NewMockRepositoryI(ctrl *gomock.Controller) *MockRepositoryI {
+	mock := &MockRepositoryI{ctrl: ctrl}
+	mock.recorder = &MockRepositoryIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRepositoryI) EXPECT() *MockRepositoryIMockRecorder {
+	return m.recorder
+}
+
+// ClaimReport mocks base method.
+func (m *MockRepositoryI) ClaimReport(reportID uint64, owner string, leaseUntil time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimReport", reportID, owner, leaseUntil)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimReport indicates an expected call of ClaimReport.
+func (mr *MockRepositoryIMockRecorder) ClaimReport(reportID, owner, leaseUntil interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimReport", reflect.TypeOf((*MockRepositoryI)(nil).ClaimReport), reportID, owner, leaseUntil)
+}
+
+// FinishReport mocks base method.
+func (m *MockRepositoryI) FinishReport(report *models.Report, owner string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishReport", report, owner)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FinishReport indicates an expected call of FinishReport.
+func (mr *MockRepositoryIMockRecorder) FinishReport(report, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishReport", reflect.TypeOf((*MockRepositoryI)(nil).FinishReport), report, owner)
+}
+
+// InsertReport mocks base method.
+func (m *MockRepositoryI) InsertReport(report *models.Report) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertReport", report)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertReport indicates an expected call of InsertReport.
+func (mr *MockRepositoryIMockRecorder) InsertReport(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertReport", reflect.TypeOf((*MockRepositoryI)(nil).InsertReport), report)
+}
+
+// RenewLease mocks base method.
+func (m *MockRepositoryI) RenewLease(reportID uint64, owner string, leaseUntil time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewLease", reportID, owner, leaseUntil)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenewLease indicates an expected call of RenewLease.
+func (mr *MockRepositoryIMockRecorder) RenewLease(reportID, owner, leaseUntil interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewLease", reflect.TypeOf((*MockRepositoryI)(nil).RenewLease), reportID, owner, leaseUntil)
+}
+
+// SelectExpiredReports mocks base method.
+func (m *MockRepositoryI) SelectExpiredReports(moment time.Time) ([]models.Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectExpiredReports", moment)
+	ret0, _ := ret[0].([]models.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectExpiredReports indicates an expected call of SelectExpiredReports.
+func (mr *MockRepositoryIMockRecorder) SelectExpiredReports(moment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectExpiredReports", reflect.TypeOf((*MockRepositoryI)(nil).SelectExpiredReports), moment)
+}
+
+// SelectReportByID mocks base method.
+func (m *MockRepositoryI) SelectReportByID(reportID uint64) (*models.Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectReportByID", reportID)
+	ret0, _ := ret[0].(*models.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectReportByID indicates an expected call of SelectReportByID.
+func (mr *MockRepositoryIMockRecorder) SelectReportByID(reportID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectReportByID", reflect.TypeOf((*MockRepositoryI)(nil).SelectReportByID), reportID)
+}
+
+// SelectUnclaimedReports mocks base method.
+func (m *MockRepositoryI) SelectUnclaimedReports(moment time.Time) ([]models.Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUnclaimedReports", moment)
+	ret0, _ := ret[0].([]models.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUnclaimedReports indicates an expected call of SelectUnclaimedReports.
+func (mr *MockRepositoryIMockRecorder) SelectUnclaimedReports(moment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUnclaimedReports", reflect.TypeOf((*MockRepositoryI)(nil).SelectUnclaimedReports), moment)
+}
+
+// UpdateReport mocks base method.
+func (m *MockRepositoryI) UpdateReport(report *models.Report) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateReport", report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateReport indicates an expected call of UpdateReport.
+func (mr *MockRepositoryIMockRecorder) UpdateReport(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateReport", reflect.TypeOf((*MockRepositoryI)(nil).UpdateReport), report)
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"fmt"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"time"
+)
+
+type Report struct {
+	ReportID   uint64            `gorm:"primary_key"`
+	Params     models.FormReport `gorm:"serializer:json"`
+	Status     string
+	FileName   string
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time `gorm:"null"`
+	ExpiresAt  *time.Time `gorm:"null"`
+}
+
+func (Report) TableName(schemaName, tableName string) string {
+	return fmt.Sprintf("%s.%s", schemaName, tableName)
+}
+
+func (r *Report) FromReportModel(report *models.Report) {
+	r.ReportID = report.ReportID
+	r.Params = report.Params
+	r.Status = report.Status
+	r.FileName = report.FileName
+	r.Error = report.Error
+	r.CreatedAt = report.CreatedAt
+	r.FinishedAt = report.FinishedAt
+	r.ExpiresAt = report.ExpiresAt
+}
+
+func (r *Report) ToReportModel() *models.Report {
+	return &models.Report{
+		ReportID:   r.ReportID,
+		Params:     r.Params,
+		Status:     r.Status,
+		FileName:   r.FileName,
+		Error:      r.Error,
+		CreatedAt:  r.CreatedAt,
+		FinishedAt: r.FinishedAt,
+		ExpiresAt:  r.ExpiresAt,
+	}
+}
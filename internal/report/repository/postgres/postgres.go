@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/internal/report/repository"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type reportRepo struct {
+	cfg *config.Config
+	db  *gorm.DB
+}
+
+func New(cfg *config.Config, db *gorm.DB) repository.RepositoryI {
+	return &reportRepo{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+func (repo *reportRepo) InsertReport(report *models.Report) (uint64, error) {
+	var dbReport Report
+	dbReport.FromReportModel(report)
+
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).Create(&dbReport)
+	if err := tx.Error; err != nil {
+		return 0, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbReport.ReportID, nil
+}
+
+func (repo *reportRepo) UpdateReport(report *models.Report) error {
+	var dbReport Report
+	dbReport.FromReportModel(report)
+
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Select("status", "file_name", "error", "finished_at", "expires_at").Updates(&dbReport)
+	if err := tx.Error; err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
+func (repo *reportRepo) SelectReportByID(reportID uint64) (*models.Report, error) {
+	var dbReport Report
+
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Where("report_id = ?", reportID).Take(&dbReport)
+	if err := tx.Error; err != nil {
+		if pkgErrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrReportNotFound
+		}
+
+		return nil, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbReport.ToReportModel(), nil
+}
+
+func (repo *reportRepo) ClaimReport(reportID uint64, owner string, leaseUntil time.Time) (bool, error) {
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Where("report_id = ? AND (status = ? OR (status = ? AND lease_until < current_timestamp))", reportID,
+			models.ReportStatusPending, models.ReportStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      models.ReportStatusRunning,
+			"owner":       owner,
+			"lease_until": leaseUntil,
+		})
+	if err := tx.Error; err != nil {
+		return false, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+func (repo *reportRepo) RenewLease(reportID uint64, owner string, leaseUntil time.Time) error {
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Where("report_id = ? AND owner = ? AND status = ?", reportID, owner, models.ReportStatusRunning).
+		Update("lease_until", leaseUntil)
+	if err := tx.Error; err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	if tx.RowsAffected == 0 {
+		return errors.ErrReportLeaseLost
+	}
+
+	return nil
+}
+
+func (repo *reportRepo) FinishReport(report *models.Report, owner string) (bool, error) {
+	var dbReport Report
+	dbReport.FromReportModel(report)
+
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Where("report_id = ? AND owner = ? AND status = ?", report.ReportID, owner, models.ReportStatusRunning).
+		Select("status", "file_name", "error", "finished_at", "expires_at").Updates(&dbReport)
+	if err := tx.Error; err != nil {
+		return false, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+func (repo *reportRepo) SelectUnclaimedReports(moment time.Time) ([]models.Report, error) {
+	var dbReports []Report
+
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Where("status = ? OR (status = ? AND (lease_until IS NULL OR lease_until < ?))", models.ReportStatusPending,
+			models.ReportStatusRunning, moment).Order("report_id").Find(&dbReports)
+	if err := tx.Error; err != nil {
+		return []models.Report{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.Report, len(dbReports))
+	for idx, dbReport := range dbReports {
+		result[idx] = *dbReport.ToReportModel()
+	}
+
+	return result, nil
+}
+
+func (repo *reportRepo) SelectExpiredReports(moment time.Time) ([]models.Report, error) {
+	var dbReports []Report
+
+	tx := repo.db.Table(Report{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBReportTableName)).
+		Where("status = ? AND expires_at <= ?", models.ReportStatusDone, moment).Find(&dbReports)
+	if err := tx.Error; err != nil {
+		return []models.Report{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.Report, len(dbReports))
+	for idx, dbReport := range dbReports {
+		result[idx] = *dbReport.ToReportModel()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,379 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	pkgErr "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func createConfig() *config.Config {
+	cfg := new(config.Config)
+	cfg.DB.DBSchemaName = "app"
+	cfg.DB.DBReportTableName = "reports"
+
+	return cfg
+}
+
+func mockDB() (*sql.DB, *gorm.DB, sqlmock.Sqlmock, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("mocking database error: %s", err)
+	}
+
+	dialector := postgres.New(postgres.Config{
+		DSN:                  "sqlmock_db_0",
+		DriverName:           "postgres",
+		Conn:                 db,
+		PreferSimpleProtocol: true,
+	})
+	gormDB, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("opening gorm error: %s", err)
+	}
+
+	return db, gormDB, mock, nil
+}
+
+func TestRepository_InsertReport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReport := &models.Report{
+		Params: models.FormReport{
+			Type:  models.ReportTypeHistory,
+			Year:  2023,
+			Month: 8,
+		},
+		Status:    models.ReportStatusPending,
+		CreatedAt: time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC),
+	}
+	params, err := json.Marshal(fakeReport.Params)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."reports" ("params","status","file_name","error","created_at","finished_at","expires_at")
+	VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "report_id"`)).
+		WithArgs(string(params), fakeReport.Status, "", "", fakeReport.CreatedAt, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"report_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	reportRep := New(cfg, gormDB)
+	reportID, err := reportRep.InsertReport(fakeReport)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, uint64(1), reportID)
+	}
+}
+
+func TestRepository_UpdateReport(t *testing.T) {
+	cfg := createConfig()
+
+	finishedAt := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	expiresAt := finishedAt.Add(24 * time.Hour)
+	fakeReport := &models.Report{
+		ReportID:   1,
+		Status:     models.ReportStatusDone,
+		FileName:   "report-1-history-2023-8.csv",
+		FinishedAt: &finishedAt,
+		ExpiresAt:  &expiresAt,
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."reports" SET "status"=$1,"file_name"=$2,"error"=$3,"finished_at"=$4,"expires_at"=$5
+	WHERE "report_id" = $6`)).
+		WithArgs(fakeReport.Status, fakeReport.FileName, "", finishedAt, expiresAt, fakeReport.ReportID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reportRep := New(cfg, gormDB)
+	err = reportRep.UpdateReport(fakeReport)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_SelectReportByID(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReport := &models.Report{
+		ReportID: 1,
+		Params: models.FormReport{
+			Type:   models.ReportTypeUserHistory,
+			UserID: 1,
+			From:   "2023-08-01",
+		},
+		Status:    models.ReportStatusPending,
+		CreatedAt: time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC),
+	}
+	params, err := json.Marshal(fakeReport.Params)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"report_id", "params", "status", "file_name", "error", "created_at"}).
+		AddRow(fakeReport.ReportID, params, fakeReport.Status, "", "", fakeReport.CreatedAt)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."reports" WHERE report_id = $1 LIMIT 1`)).
+		WithArgs(fakeReport.ReportID).WillReturnRows(rows)
+
+	reportRep := New(cfg, gormDB)
+	response, err := reportRep.SelectReportByID(fakeReport.ReportID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeReport, response)
+	}
+}
+
+func TestRepository_SelectReportByIDNotFound(t *testing.T) {
+	cfg := createConfig()
+
+	reportID := uint64(1)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."reports" WHERE report_id = $1 LIMIT 1`)).
+		WithArgs(reportID).WillReturnError(gorm.ErrRecordNotFound)
+
+	reportRep := New(cfg, gormDB)
+	_, err = reportRep.SelectReportByID(reportID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrReportNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrReportNotFound, causeErr)
+	}
+}
+
+func TestRepository_SelectExpiredReports(t *testing.T) {
+	cfg := createConfig()
+
+	moment := time.Date(2023, 9, 2, 10, 0, 0, 0, time.UTC)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"report_id", "params", "status", "file_name"}).
+		AddRow(1, []byte(`{"type":"history","year":2023,"month":8}`), models.ReportStatusDone, "report-1-history-2023-8.csv")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."reports" WHERE status = $1 AND expires_at <= $2`)).
+		WithArgs(models.ReportStatusDone, moment).WillReturnRows(rows)
+
+	reportRep := New(cfg, gormDB)
+	response, err := reportRep.SelectExpiredReports(moment)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Len(t, response, 1)
+		require.Equal(t, "report-1-history-2023-8.csv", response[0].FileName)
+		require.Equal(t, models.FormReport{Type: models.ReportTypeHistory, Year: 2023, Month: 8}, response[0].Params)
+	}
+}
+
+func TestRepository_ClaimReport(t *testing.T) {
+	cfg := createConfig()
+
+	leaseUntil := time.Date(2023, 9, 1, 10, 1, 0, 0, time.UTC)
+	tests := []struct {
+		affected int64
+		claimed  bool
+	}{
+		{affected: 1, claimed: true},
+		{affected: 0, claimed: false},
+	}
+
+	for _, test := range tests {
+		db, gormDB, mock, err := mockDB()
+		if err != nil {
+			t.Fatalf("error while mocking database: %s", err)
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."reports" SET "lease_until"=$1,"owner"=$2,"status"=$3
+		WHERE report_id = $4 AND (status = $5 OR (status = $6 AND lease_until < current_timestamp))`)).
+			WithArgs(leaseUntil, "replica", models.ReportStatusRunning, 1, models.ReportStatusPending,
+				models.ReportStatusRunning).
+			WillReturnResult(sqlmock.NewResult(0, test.affected))
+		mock.ExpectCommit()
+
+		reportRep := New(cfg, gormDB)
+		claimed, err := reportRep.ClaimReport(1, "replica", leaseUntil)
+		causeErr := pkgErr.Cause(err)
+
+		if causeErr != nil {
+			t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+		} else {
+			require.Equal(t, test.claimed, claimed)
+		}
+		db.Close()
+	}
+}
+
+func TestRepository_RenewLease(t *testing.T) {
+	cfg := createConfig()
+
+	leaseUntil := time.Date(2023, 9, 1, 10, 1, 0, 0, time.UTC)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."reports" SET "lease_until"=$1
+	WHERE report_id = $2 AND owner = $3 AND status = $4`)).
+		WithArgs(leaseUntil, 1, "replica", models.ReportStatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reportRep := New(cfg, gormDB)
+	err = reportRep.RenewLease(1, "replica", leaseUntil)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_RenewLeaseLost(t *testing.T) {
+	cfg := createConfig()
+
+	leaseUntil := time.Date(2023, 9, 1, 10, 1, 0, 0, time.UTC)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."reports" SET "lease_until"=$1
+	WHERE report_id = $2 AND owner = $3 AND status = $4`)).
+		WithArgs(leaseUntil, 1, "replica", models.ReportStatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	reportRep := New(cfg, gormDB)
+	err = reportRep.RenewLease(1, "replica", leaseUntil)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrReportLeaseLost {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrReportLeaseLost, causeErr)
+	}
+}
+
+func TestRepository_FinishReport(t *testing.T) {
+	cfg := createConfig()
+
+	finishedAt := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	expiresAt := finishedAt.Add(24 * time.Hour)
+	fakeReport := &models.Report{
+		ReportID:   1,
+		Status:     models.ReportStatusDone,
+		FileName:   "report-1-history-2023-8.csv",
+		FinishedAt: &finishedAt,
+		ExpiresAt:  &expiresAt,
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."reports" SET "status"=$1,"file_name"=$2,"error"=$3,"finished_at"=$4,"expires_at"=$5
+	WHERE (report_id = $6 AND owner = $7 AND status = $8) AND "report_id" = $9`)).
+		WithArgs(fakeReport.Status, fakeReport.FileName, "", finishedAt, expiresAt, fakeReport.ReportID, "replica",
+			models.ReportStatusRunning, fakeReport.ReportID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	reportRep := New(cfg, gormDB)
+	finished, err := reportRep.FinishReport(fakeReport, "replica")
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.False(t, finished)
+	}
+}
+
+func TestRepository_SelectUnclaimedReports(t *testing.T) {
+	cfg := createConfig()
+
+	moment := time.Date(2023, 9, 2, 10, 0, 0, 0, time.UTC)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"report_id", "params", "status"}).
+		AddRow(1, []byte(`{"type":"history","year":2023,"month":8}`), models.ReportStatusPending).
+		AddRow(2, []byte(`{"type":"user_history","user_id":1}`), models.ReportStatusRunning)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."reports"
+	WHERE status = $1 OR (status = $2 AND (lease_until IS NULL OR lease_until < $3)) ORDER BY report_id`)).
+		WithArgs(models.ReportStatusPending, models.ReportStatusRunning, moment).WillReturnRows(rows)
+
+	reportRep := New(cfg, gormDB)
+	response, err := reportRep.SelectUnclaimedReports(moment)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Len(t, response, 2)
+		require.Equal(t, uint64(1), response[0].ReportID)
+		require.Equal(t, models.ReportStatusRunning, response[1].Status)
+	}
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"time"
+)
+
+//go:generate mockgen -destination=./mocks/repository.go -source=./repository.go -package=mocks
+
+type RepositoryI interface {
+	InsertReport(report *models.Report) (uint64, error)
+	UpdateReport(report *models.Report) error
+	SelectReportByID(reportID uint64) (*models.Report, error)
+	// ClaimReport marks the report as running by owner until leaseUntil. It reports false when the report is not
+	// pending and another owner holds a lease on it that has not run out, so only one replica builds a report.
+	ClaimReport(reportID uint64, owner string, leaseUntil time.Time) (bool, error)
+	// RenewLease extends the lease of the running report held by owner, it returns ErrReportLeaseLost when the report
+	// is no longer running under owner.
+	RenewLease(reportID uint64, owner string, leaseUntil time.Time) error
+	// FinishReport writes the outcome of the report only while it is running under owner and reports whether it did,
+	// so a replica that lost the lease cannot overwrite the result of the one that took the report over.
+	FinishReport(report *models.Report, owner string) (bool, error)
+	// SelectUnclaimedReports returns the pending reports and the running ones whose lease ran out by the moment.
+	SelectUnclaimedReports(moment time.Time) ([]models.Report, error)
+	SelectExpiredReports(moment time.Time) ([]models.Report, error)
+}
@@ -0,0 +1,80 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./usecase.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/vvinokurshin/AvitoInternship/internal/models"
+)
+
+// MockUseCaseI is a mock of UseCaseI interface.
+type MockUseCaseI struct {
+	ctrl     *gomock.Controller
+	recorder *MockUseCaseIMockRecorder
+}
+
+// MockUseCaseIMockRecorder is the mock recorder for MockUseCaseI.
+type MockUseCaseIMockRecorder struct {
+	mock *MockUseCaseI
+}
+
+// NewMockUseCaseI creates a new mock instance.
+func NewMockUseCaseI(ctrl *gomock.Controller) *MockUseCaseI {
+	mock := &MockUseCaseI{ctrl: ctrl}
+	mock.recorder = &MockUseCaseIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUseCaseI) EXPECT() *MockUseCaseIMockRecorder {
+	return m.recorder
+}
+
+// CreateReport mocks base method.
+func (m *MockUseCaseI) CreateReport(form models.FormReport) (*models.Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReport", form)
+	ret0, _ := ret[0].(*models.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReport indicates an expected call of CreateReport.
+func (mr *MockUseCaseIMockRecorder) CreateReport(form interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReport", reflect.TypeOf((*MockUseCaseI)(nil).CreateReport), form)
+}
+
+// GetReport mocks base method.
+func (m *MockUseCaseI) GetReport(reportID uint64) (*models.Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReport", reportID)
+	ret0, _ := ret[0].(*models.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReport indicates an expected call of GetReport.
+func (mr *MockUseCaseIMockRecorder) GetReport(reportID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReport", reflect.TypeOf((*MockUseCaseI)(nil).GetReport), reportID)
+}
+
+// GetReportURL mocks base method.
+func (m *MockUseCaseI) GetReportURL(reportID uint64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReportURL", reportID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReportURL indicates an expected call of GetReportURL.
+func (mr *MockUseCaseIMockRecorder) GetReportURL(reportID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReportURL", reflect.TypeOf((*MockUseCaseI)(nil).GetReportURL), reportID)
+}
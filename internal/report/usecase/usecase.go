@@ -0,0 +1,365 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	pkgErr "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	historyUseCase "github.com/vvinokurshin/AvitoInternship/internal/history/usecase"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	reportRepository "github.com/vvinokurshin/AvitoInternship/internal/report/repository"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/pkg/storage"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -destination=./mocks/usecase.go -source=./usecase.go -package=mocks
+
+const (
+	defaultWorkers   = 4
+	defaultRetention = 24 * time.Hour
+	defaultLease     = time.Minute
+)
+
+type UseCaseI interface {
+	CreateReport(form models.FormReport) (*models.Report, error)
+	GetReport(reportID uint64) (*models.Report, error)
+	GetReportURL(reportID uint64) (string, error)
+}
+
+type UseCase struct {
+	cfg        *config.Config
+	reportRepo reportRepository.RepositoryI
+	historyUC  historyUseCase.UseCaseI
+	storage    storage.Storage
+	workers    *pkg.WorkerPool
+	retention  time.Duration
+	// owner identifies this replica in the leases of the reports it builds.
+	owner  string
+	lease  time.Duration
+	queued sync.Map
+}
+
+func New(cfg *config.Config, reportRepo reportRepository.RepositoryI, historyUC historyUseCase.UseCaseI,
+	store storage.Storage) (UseCaseI, error) {
+	uc := &UseCase{
+		cfg:        cfg,
+		reportRepo: reportRepo,
+		historyUC:  historyUC,
+		storage:    store,
+		retention:  cfg.Reports.Retention,
+		owner:      newOwner(),
+		lease:      cfg.Reports.Lease,
+	}
+	if uc.retention <= 0 {
+		uc.retention = defaultRetention
+	}
+	if uc.lease <= 0 {
+		uc.lease = defaultLease
+	}
+
+	workers := cfg.Reports.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	uc.workers = pkg.NewWorkerPool(workers, cfg.Reports.QueueSize)
+
+	// reports left by a stopped replica are taken over at startup and then whenever their lease runs out
+	err := uc.ResumeReports()
+	if err != nil {
+		return nil, err
+	}
+
+	err = pkg.CronInit("@every "+uc.lease.String(), func() {
+		if err := uc.ResumeReports(); err != nil {
+			log.Error(err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = pkg.CronInit("@every 10m", uc.ClearExpiredReports)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc, nil
+}
+
+func (uc *UseCase) CreateReport(form models.FormReport) (*models.Report, error) {
+	report := &models.Report{
+		Params:    form,
+		Status:    models.ReportStatusPending,
+		CreatedAt: time.Now(),
+	}
+
+	reportID, err := uc.reportRepo.InsertReport(report)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "insert report")
+	}
+	report.ReportID = reportID
+
+	if !uc.enqueueReport(*report) {
+		return nil, errors.ErrReportQueueIsFull
+	}
+
+	return report, nil
+}
+
+func (uc *UseCase) GetReport(reportID uint64) (*models.Report, error) {
+	report, err := uc.reportRepo.SelectReportByID(reportID)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select report by id")
+	}
+
+	// the file is kept until the next sweep, but the report is expired and no link is signed for it
+	if report.Status == models.ReportStatusDone && report.ExpiresAt != nil && !report.ExpiresAt.After(time.Now()) {
+		report.Status = models.ReportStatusExpired
+	}
+
+	if report.Status == models.ReportStatusDone {
+		report.URL, err = uc.storage.URL(report.FileName, time.Until(*report.ExpiresAt))
+		if err != nil {
+			return nil, pkgErr.WithMessage(errors.ErrInternal, err.Error())
+		}
+	}
+
+	return report, nil
+}
+
+func (uc *UseCase) GetReportURL(reportID uint64) (string, error) {
+	report, err := uc.GetReport(reportID)
+	if err != nil {
+		return "", err
+	}
+
+	switch report.Status {
+	case models.ReportStatusDone:
+		return report.URL, nil
+	case models.ReportStatusExpired:
+		return "", errors.ErrReportExpired
+	default:
+		return "", errors.ErrReportNotReady
+	}
+}
+
+func newOwner() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return hostname + "-" + strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(suffix)
+}
+
+// ResumeReports queues the reports nobody builds: pending ones and running ones whose lease ran out.
+// Another replica may queue the same report, the one that claims it first builds it.
+func (uc *UseCase) ResumeReports() error {
+	reports, err := uc.reportRepo.SelectUnclaimedReports(time.Now())
+	if err != nil {
+		return pkgErr.Wrap(err, "select unclaimed reports")
+	}
+
+	for _, report := range reports {
+		if _, ok := uc.queued.LoadOrStore(report.ReportID, struct{}{}); ok {
+			continue
+		}
+
+		// a full queue leaves the report to other replicas or to the next resume
+		report := report
+		if !uc.workers.Submit(func() { uc.runReport(report) }) {
+			uc.queued.Delete(report.ReportID)
+		}
+	}
+
+	return nil
+}
+
+// enqueueReport hands the report to the workers, a report rejected by the full queue is marked as failed.
+func (uc *UseCase) enqueueReport(report models.Report) bool {
+	uc.queued.Store(report.ReportID, struct{}{})
+	if uc.workers.Submit(func() { uc.runReport(report) }) {
+		return true
+	}
+
+	uc.queued.Delete(report.ReportID)
+	uc.finishReport(&report, "", errors.ErrReportQueueIsFull)
+	return false
+}
+
+func (uc *UseCase) runReport(report models.Report) {
+	defer uc.queued.Delete(report.ReportID)
+
+	claimed, err := uc.reportRepo.ClaimReport(report.ReportID, uc.owner, time.Now().Add(uc.lease))
+	if err != nil {
+		log.Error(pkgErr.Wrap(err, "claim report"))
+		return
+	}
+	if !claimed {
+		return
+	}
+	report.Status = models.ReportStatusRunning
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := uc.renewLease(report.ReportID, cancel)
+	fileName, err := uc.buildReport(ctx, report)
+	stop()
+	cancel()
+
+	settleReport(&report, fileName, err, uc.retention)
+
+	finished, err := uc.reportRepo.FinishReport(&report, uc.owner)
+	if err != nil {
+		log.Error(pkgErr.Wrap(err, "finish report"))
+		return
+	}
+
+	// another replica has taken the report over, its result stays and the file of this build is not linked anywhere
+	if !finished {
+		log.Warn(pkgErr.Wrapf(errors.ErrReportLeaseLost, "finish report %d", report.ReportID))
+		if fileName != "" {
+			uc.removeFile(fileName)
+		}
+	}
+}
+
+// renewLease keeps the lease of a report being built until the returned function is called.
+// Once the lease is lost the build is canceled through cancel.
+func (uc *UseCase) renewLease(reportID uint64, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(uc.lease / 3)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := uc.reportRepo.RenewLease(reportID, uc.owner, time.Now().Add(uc.lease))
+				if pkgErr.Cause(err) == errors.ErrReportLeaseLost {
+					log.Warn(pkgErr.Wrapf(err, "renew lease of report %d", reportID))
+					cancel()
+					return
+				}
+				if err != nil {
+					log.Error(pkgErr.Wrapf(err, "renew lease of report %d", reportID))
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// buildReport writes the report to storage under a unique name and returns the name.
+func (uc *UseCase) buildReport(ctx context.Context, report models.Report) (string, error) {
+	var fileName string
+	var write func(w io.Writer) error
+
+	switch report.Params.Type {
+	case models.ReportTypeHistory:
+		form := report.Params.History()
+		fileName = form.FileName()
+		write = func(w io.Writer) error {
+			return uc.historyUC.ExportHistory(ctx, form, w)
+		}
+	case models.ReportTypeUserHistory:
+		form, err := report.Params.UserHistory()
+		if err != nil {
+			return "", err
+		}
+		fileName = form.FileName()
+		write = func(w io.Writer) error {
+			return uc.historyUC.ExportUserHistory(ctx, form, w)
+		}
+	default:
+		return "", errors.ErrInvalidForm
+	}
+
+	name := storage.UniqueName(fileName)
+	file, err := uc.storage.Create(name)
+	if err != nil {
+		return "", pkgErr.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	err = write(file)
+	if err != nil {
+		file.Close()
+		uc.removeFile(name)
+		return "", pkgErr.Wrap(err, "build report")
+	}
+
+	err = file.Close()
+	if err != nil {
+		uc.removeFile(name)
+		return "", pkgErr.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return name, nil
+}
+
+func (uc *UseCase) removeFile(name string) {
+	err := uc.storage.Remove(name)
+	if err != nil {
+		log.Error(pkgErr.Wrapf(err, "remove file %s", name))
+	}
+}
+
+// finishReport stores the outcome of a report that was never claimed.
+func (uc *UseCase) finishReport(report *models.Report, fileName string, err error) {
+	settleReport(report, fileName, err, uc.retention)
+
+	err = uc.reportRepo.UpdateReport(report)
+	if err != nil {
+		log.Error(pkgErr.Wrap(err, "update report"))
+	}
+}
+
+// settleReport fills in the outcome of the build: the file kept for retention or the error.
+func settleReport(report *models.Report, fileName string, err error, retention time.Duration) {
+	finishedAt := time.Now()
+	report.FinishedAt = &finishedAt
+
+	if err != nil {
+		log.Error(pkgErr.Wrapf(err, "build report %d", report.ReportID))
+		report.Status = models.ReportStatusFailed
+		report.Error = pkgErr.Cause(err).Error()
+	} else {
+		expiresAt := finishedAt.Add(retention)
+		report.Status = models.ReportStatusDone
+		report.FileName = fileName
+		report.ExpiresAt = &expiresAt
+	}
+}
+
+// ClearExpiredReports removes the files of reports whose retention has passed.
+func (uc *UseCase) ClearExpiredReports() {
+	reports, err := uc.reportRepo.SelectExpiredReports(time.Now())
+	if err != nil {
+		log.Error(pkgErr.Wrap(err, "select expired reports"))
+		return
+	}
+
+	for idx := range reports {
+		err = uc.storage.Remove(reports[idx].FileName)
+		if err != nil {
+			log.Error(pkgErr.Wrapf(err, "remove file of report %d", reports[idx].ReportID))
+			continue
+		}
+
+		reports[idx].Status = models.ReportStatusExpired
+		reports[idx].FileName = ""
+		err = uc.reportRepo.UpdateReport(&reports[idx])
+		if err != nil {
+			log.Error(pkgErr.Wrap(err, "update report"))
+		}
+	}
+}
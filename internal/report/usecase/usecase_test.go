@@ -0,0 +1,420 @@
+package usecase
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	pkgErr "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	mockHistoryUC "github.com/vvinokurshin/AvitoInternship/internal/history/usecase/mocks"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	mockReportRepo "github.com/vvinokurshin/AvitoInternship/internal/report/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/pkg/storage"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createConfig() *config.Config {
+	return new(config.Config)
+}
+
+// newUseCase creates the use case with a pool without workers, so queued reports are not built in background.
+func newUseCase(t *testing.T, cfg *config.Config, reportRepo *mockReportRepo.MockRepositoryI,
+	historyUC *mockHistoryUC.MockUseCaseI, queueSize int) *UseCase {
+	store, err := storage.NewLocal(t.TempDir(), "/api/v1/files", "secret")
+	if err != nil {
+		t.Fatalf("error while creating storage: %v", err)
+	}
+
+	return &UseCase{
+		cfg:        cfg,
+		reportRepo: reportRepo,
+		historyUC:  historyUC,
+		storage:    store,
+		workers:    pkg.NewWorkerPool(0, queueSize),
+		retention:  time.Hour,
+		owner:      "test",
+		lease:      time.Minute,
+	}
+}
+
+func TestUseCase_CreateReport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormReport{
+		Type:  models.ReportTypeHistory,
+		Year:  2023,
+		Month: 8,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	reportRepo.EXPECT().InsertReport(gomock.Any()).Return(uint64(1), nil)
+	response, err := reportUC.CreateReport(fakeForm)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, uint64(1), response.ReportID)
+		require.Equal(t, models.ReportStatusPending, response.Status)
+		require.Equal(t, fakeForm, response.Params)
+	}
+}
+
+func TestUseCase_CreateReportQueueIsFull(t *testing.T) {
+	cfg := createConfig()
+
+	fakeForm := models.FormReport{
+		Type:  models.ReportTypeHistory,
+		Year:  2023,
+		Month: 8,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 0)
+
+	var failed *models.Report
+	reportRepo.EXPECT().InsertReport(gomock.Any()).Return(uint64(1), nil)
+	reportRepo.EXPECT().UpdateReport(gomock.Any()).DoAndReturn(func(report *models.Report) error {
+		failed = report
+		return nil
+	})
+	_, err := reportUC.CreateReport(fakeForm)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrReportQueueIsFull {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrReportQueueIsFull, causeErr)
+	} else {
+		require.Equal(t, models.ReportStatusFailed, failed.Status)
+		require.Equal(t, errors.ErrReportQueueIsFull.Error(), failed.Error)
+	}
+}
+
+func TestUseCase_RunReport(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReport := models.Report{
+		ReportID: 7,
+		Params: models.FormReport{
+			Type:  models.ReportTypeHistory,
+			Year:  2023,
+			Month: 8,
+		},
+		Status: models.ReportStatusPending,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	var finished models.Report
+	reportRepo.EXPECT().ClaimReport(fakeReport.ReportID, "test", gomock.Any()).Return(true, nil)
+	reportRepo.EXPECT().FinishReport(gomock.Any(), "test").DoAndReturn(func(report *models.Report, owner string) (bool, error) {
+		finished = *report
+		return true, nil
+	})
+	historyUC.EXPECT().ExportHistory(gomock.Any(), fakeReport.Params.History(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, form models.FormHistory, w io.Writer) error {
+			_, err := w.Write([]byte("report"))
+			return err
+		})
+	reportUC.runReport(fakeReport)
+
+	require.Equal(t, models.ReportStatusDone, finished.Status)
+	require.True(t, strings.HasPrefix(finished.FileName, "history-2023-8-"))
+	require.True(t, strings.HasSuffix(finished.FileName, ".csv"))
+	require.NotNil(t, finished.ExpiresAt)
+	require.Equal(t, finished.FinishedAt.Add(time.Hour), *finished.ExpiresAt)
+
+	file, err := reportUC.storage.Open(finished.FileName)
+	if err != nil {
+		t.Fatalf("[TEST] simple: expected report file, got \"%v\"", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.Equal(t, "report", string(content))
+}
+
+func TestUseCase_RunReportFailed(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReport := models.Report{
+		ReportID: 1,
+		Params: models.FormReport{
+			Type:   models.ReportTypeUserHistory,
+			UserID: 1,
+		},
+		Status: models.ReportStatusPending,
+	}
+	fakeForm := models.FormUserHistory{
+		UserID: 1,
+		Limit:  errors.DefaultHistoryLimit,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	var finished models.Report
+	reportRepo.EXPECT().ClaimReport(fakeReport.ReportID, "test", gomock.Any()).Return(true, nil)
+	reportRepo.EXPECT().FinishReport(gomock.Any(), "test").DoAndReturn(func(report *models.Report, owner string) (bool, error) {
+		finished = *report
+		return true, nil
+	})
+	historyUC.EXPECT().ExportUserHistory(gomock.Any(), fakeForm, gomock.Any()).Return(errors.ErrInternal)
+	reportUC.runReport(fakeReport)
+
+	require.Equal(t, models.ReportStatusFailed, finished.Status)
+	require.Equal(t, errors.ErrInternal.Error(), finished.Error)
+	require.Nil(t, finished.ExpiresAt)
+}
+
+func TestUseCase_RunReportLeaseLost(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReport := models.Report{
+		ReportID: 7,
+		Params: models.FormReport{
+			Type:  models.ReportTypeHistory,
+			Year:  2023,
+			Month: 8,
+		},
+		Status: models.ReportStatusPending,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	var finished models.Report
+	reportRepo.EXPECT().ClaimReport(fakeReport.ReportID, "test", gomock.Any()).Return(true, nil)
+	reportRepo.EXPECT().FinishReport(gomock.Any(), "test").DoAndReturn(func(report *models.Report, owner string) (bool, error) {
+		finished = *report
+		return false, nil
+	})
+	historyUC.EXPECT().ExportHistory(gomock.Any(), fakeReport.Params.History(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, form models.FormHistory, w io.Writer) error {
+			_, err := w.Write([]byte("report"))
+			return err
+		})
+	reportUC.runReport(fakeReport)
+
+	_, err := reportUC.storage.Open(finished.FileName)
+	if err == nil {
+		t.Errorf("[TEST] simple: expected the file of the lost report to be removed")
+	}
+}
+
+func TestUseCase_RenewLeaseLost(t *testing.T) {
+	cfg := createConfig()
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+	reportUC.lease = 30 * time.Millisecond
+
+	reportRepo.EXPECT().RenewLease(uint64(1), "test", gomock.Any()).Return(errors.ErrReportLeaseLost)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := reportUC.renewLease(1, cancel)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("[TEST] simple: expected the build to be canceled after the lease is lost")
+	}
+}
+
+func TestUseCase_RunReportClaimedByOther(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReport := models.Report{
+		ReportID: 7,
+		Params: models.FormReport{
+			Type:  models.ReportTypeHistory,
+			Year:  2023,
+			Month: 8,
+		},
+		Status: models.ReportStatusPending,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	reportRepo.EXPECT().ClaimReport(fakeReport.ReportID, "test", gomock.Any()).Return(false, nil)
+	reportUC.runReport(fakeReport)
+}
+
+func TestUseCase_ResumeReports(t *testing.T) {
+	cfg := createConfig()
+
+	fakeReports := []models.Report{
+		{ReportID: 1, Status: models.ReportStatusPending},
+		{ReportID: 2, Status: models.ReportStatusRunning},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 3)
+
+	reportRepo.EXPECT().SelectUnclaimedReports(gomock.Any()).Return(fakeReports, nil).Times(2)
+	err := reportUC.ResumeReports()
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+
+	// reports already in the queue are not queued twice
+	err = reportUC.ResumeReports()
+	causeErr = pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+	require.True(t, reportUC.workers.Submit(func() {}))
+}
+
+func TestUseCase_GetReportURL(t *testing.T) {
+	cfg := createConfig()
+
+	expiresAt := time.Now().Add(time.Hour)
+	tests := []struct {
+		status   string
+		fileName string
+		err      error
+	}{
+		{status: models.ReportStatusDone, fileName: "history-2023-8-20230901T100000-0a1b2c3d.csv"},
+		{status: models.ReportStatusRunning, err: errors.ErrReportNotReady},
+		{status: models.ReportStatusExpired, err: errors.ErrReportExpired},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	for _, test := range tests {
+		reportRepo.EXPECT().SelectReportByID(uint64(1)).
+			Return(&models.Report{ReportID: 1, Status: test.status, FileName: test.fileName, ExpiresAt: &expiresAt}, nil)
+		response, err := reportUC.GetReportURL(1)
+		causeErr := pkgErr.Cause(err)
+
+		if causeErr != test.err {
+			t.Errorf("[TEST] %s: expected err \"%v\", got \"%v\"", test.status, test.err, causeErr)
+		} else if test.err == nil {
+			require.True(t, strings.HasPrefix(response, "/api/v1/files/"+test.fileName+"?expires="))
+		}
+	}
+}
+
+func TestUseCase_GetReportURLAfterExpiry(t *testing.T) {
+	cfg := createConfig()
+
+	expiresAt := time.Now().Add(-time.Minute)
+	fakeReport := &models.Report{
+		ReportID:  1,
+		Status:    models.ReportStatusDone,
+		FileName:  "history-2023-8-20230901T100000-0a1b2c3d.csv",
+		ExpiresAt: &expiresAt,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	reportRepo.EXPECT().SelectReportByID(fakeReport.ReportID).Return(fakeReport, nil)
+	_, err := reportUC.GetReportURL(fakeReport.ReportID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrReportExpired {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrReportExpired, causeErr)
+	} else {
+		require.Empty(t, fakeReport.URL)
+	}
+}
+
+func TestUseCase_ClearExpiredReports(t *testing.T) {
+	cfg := createConfig()
+
+	fakeFilename := "history-2023-7-20230801T100000-0a1b2c3d.csv"
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reportRepo := mockReportRepo.NewMockRepositoryI(ctrl)
+	historyUC := mockHistoryUC.NewMockUseCaseI(ctrl)
+	reportUC := newUseCase(t, cfg, reportRepo, historyUC, 1)
+
+	file, err := reportUC.storage.Create(fakeFilename)
+	if err != nil {
+		t.Fatalf("error while creating file: %v", err)
+	}
+	file.Close()
+
+	var expired *models.Report
+	reportRepo.EXPECT().SelectExpiredReports(gomock.Any()).
+		Return([]models.Report{{ReportID: 2, Status: models.ReportStatusDone, FileName: fakeFilename}}, nil)
+	reportRepo.EXPECT().UpdateReport(gomock.Any()).DoAndReturn(func(report *models.Report) error {
+		expired = report
+		return nil
+	})
+	reportUC.ClearExpiredReports()
+
+	require.Equal(t, models.ReportStatusExpired, expired.Status)
+	require.Empty(t, expired.FileName)
+	if _, err := reportUC.storage.Open(fakeFilename); err != storage.ErrNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", storage.ErrNotFound, err)
+	}
+}
@@ -10,15 +10,32 @@ import (
 	segmentUC "github.com/vvinokurshin/AvitoInternship/internal/segment/usecase"
 	"github.com/vvinokurshin/AvitoInternship/pkg"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 )
 
+const (
+	// bulkBytesPerUserID covers the longest user ID with its separator and the spaces around it.
+	bulkBytesPerUserID = 32
+	// bulkFormBytes covers the rest of a bulk form: the reason, the CSV header and the multipart headers.
+	bulkFormBytes = 64 << 10
+)
+
 type DeliveryI interface {
 	CreateSegment(w http.ResponseWriter, r *http.Request)
+	UpdateSegment(w http.ResponseWriter, r *http.Request)
 	DeleteSegment(w http.ResponseWriter, r *http.Request)
+	RestoreSegment(w http.ResponseWriter, r *http.Request)
+	PurgeSegment(w http.ResponseWriter, r *http.Request)
 	GetSegment(w http.ResponseWriter, r *http.Request)
+	GetSegments(w http.ResponseWriter, r *http.Request)
+	GetSegmentUsers(w http.ResponseWriter, r *http.Request)
+	AddSegmentUsers(w http.ResponseWriter, r *http.Request)
+	RemoveSegmentUsers(w http.ResponseWriter, r *http.Request)
 	GetUserSegments(w http.ResponseWriter, r *http.Request)
+	GetUsersSegments(w http.ResponseWriter, r *http.Request)
 	EditUserSegments(w http.ResponseWriter, r *http.Request)
 }
 
@@ -41,9 +58,14 @@ func New(cfg *config.Config, uc segmentUC.UseCaseI) DeliveryI {
 // @Accept	 application/json
 // @Produce  application/json
 // @Param    segment body models.FormSegment true "form segment"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
 // @Success 200 {object} models.SegmentResponse "segment created"
 // @Failure 400 {object} errors.JSONError "invalid form"
 // @Failure 400 {object} errors.JSONError "percent is invalid"
+// @Failure 400 {object} errors.JSONError "rule is invalid"
+// @Failure 400 {object} errors.JSONError "ttl is invalid. format: positive duration like 48h or 90m"
+// @Failure 400 {object} errors.JSONError "startsAt must be before endsAt"
 // @Failure 409 {object} errors.JSONError "segment with this slug already exists"
 // @Failure 500 {object} errors.JSONError "internal server error"
 // @Router   /segment/create [post]
@@ -66,7 +88,64 @@ func (d *Delivery) CreateSegment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := d.uc.CreateSegment(form)
+	response, err := d.uc.CreateSegment(form, pkg.RequestChange(r).WithReason(form.Reason))
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, models.SegmentResponse{
+		Segment: *response,
+	})
+}
+
+// UpdateSegment godoc
+// @Summary      UpdateSegment
+// @Description  change segment's rollout percent or targeting rule
+// @Tags     segment
+// @Accept	 application/json
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param    segment body models.FormUpdateSegment true "form update segment"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
+// @Success 200 {object} models.SegmentResponse "segment updated"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 400 {object} errors.JSONError "percent is invalid"
+// @Failure 400 {object} errors.JSONError "rule is invalid"
+// @Failure 400 {object} errors.JSONError "ttl is invalid. format: positive duration like 48h or 90m"
+// @Failure 400 {object} errors.JSONError "startsAt must be before endsAt"
+// @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug} [put]
+func (d *Delivery) UpdateSegment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	form := models.FormUpdateSegment{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(form); err != nil {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.UpdateSegment(slug, form, pkg.RequestChange(r).WithReason(form.Reason))
 	if err != nil {
 		pkg.HandleError(w, r, err)
 		return
@@ -79,14 +158,18 @@ func (d *Delivery) CreateSegment(w http.ResponseWriter, r *http.Request) {
 
 // DeleteSegment godoc
 // @Summary      DeleteSegment
-// @Description  delete segment
+// @Description  archive segment: it is hidden from users, its slug stays reserved and history is kept
 // @Tags     segment
 // @Accept	 application/json
 // @Produce  application/json
 // @Param slug path string true "slug"
-// @Success 200 "segment deleted"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
+// @Param reason query string false "reason or ticket recorded in history"
+// @Success 200 "segment archived"
 // @Failure 400 {object} errors.JSONError "invalid url"
 // @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 409 {object} errors.JSONError "segment is archived"
 // @Failure 500 {object} errors.JSONError "internal server error"
 // @Router   /segment/{slug} [delete]
 func (d *Delivery) DeleteSegment(w http.ResponseWriter, r *http.Request) {
@@ -97,7 +180,74 @@ func (d *Delivery) DeleteSegment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := d.uc.DeleteSegment(slug)
+	err := d.uc.DeleteSegment(slug, pkg.RequestChange(r))
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RestoreSegment godoc
+// @Summary      RestoreSegment
+// @Description  restore archived segment
+// @Tags     segment
+// @Accept	 application/json
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
+// @Param reason query string false "reason or ticket recorded in history"
+// @Success 200 {object} models.SegmentResponse "segment restored"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 409 {object} errors.JSONError "layer has no free traffic for this percent"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug}/restore [post]
+func (d *Delivery) RestoreSegment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	response, err := d.uc.RestoreSegment(slug, pkg.RequestChange(r))
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, models.SegmentResponse{
+		Segment: *response,
+	})
+}
+
+// PurgeSegment godoc
+// @Summary      PurgeSegment
+// @Description  irreversibly delete archived segment, history is kept
+// @Tags     segment
+// @Accept	 application/json
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param confirm query string true "segment slug repeated as confirmation"
+// @Success 200 "segment purged"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "purge must be confirmed with the segment slug"
+// @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 409 {object} errors.JSONError "segment must be archived before purge"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug}/purge [delete]
+func (d *Delivery) PurgeSegment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	err := d.uc.PurgeSegment(slug, r.URL.Query().Get("confirm"))
 	if err != nil {
 		pkg.HandleError(w, r, err)
 		return
@@ -137,6 +287,290 @@ func (d *Delivery) GetSegment(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetSegments godoc
+// @Summary      GetSegments
+// @Description  get all segments, archived included, with the number of members whose membership has not expired, null for rule segments
+// @Tags     segment
+// @Accept	 application/json
+// @Produce  application/json
+// @Success 200 {object} models.SegmentSummariesResponse "success get segments"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segments [get]
+func (d *Delivery) GetSegments(w http.ResponseWriter, r *http.Request) {
+	segments, err := d.uc.GetSegments()
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, models.SegmentSummariesResponse{
+		Segments: segments,
+		Count:    len(segments),
+	})
+}
+
+// GetSegmentUsers godoc
+// @Summary      GetSegmentUsers
+// @Description  get members of the segment page by page ordered by user id, count is the number of all members matching the filters. members of rule segments are matched on read and cannot be listed
+// @Tags     segment
+// @Accept	 application/json
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param source query string false "MANUAL, PERCENTAGE, IMPORT or API"
+// @Param expiringBefore query string false "only memberships with until before the moment: RFC 3339 or YYYY-MM-DD"
+// @Param addedAfter query string false "only memberships added after the moment: RFC 3339 or YYYY-MM-DD"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param limit query int false "page size, 100 by default, up to 1000"
+// @Success 200 {object} models.SegmentUsersResponse "success get segment users"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "source is invalid. supported: MANUAL, PERCENTAGE, RULE, IMPORT, API"
+// @Failure 400 {object} errors.JSONError "date is invalid. format: RFC 3339 or YYYY-MM-DD"
+// @Failure 400 {object} errors.JSONError "cursor is invalid"
+// @Failure 400 {object} errors.JSONError "limit is invalid"
+// @Failure 400 {object} errors.JSONError "members of rule segments are matched on read and not stored, so they cannot be listed"
+// @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug}/users [get]
+func (d *Delivery) GetSegmentUsers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	query := r.URL.Query()
+	form := models.FormSegmentUsers{
+		Slug:   slug,
+		Source: query.Get("source"),
+	}
+
+	if query.Get("expiringBefore") != "" {
+		expiringBefore, err := models.ParseHistoryTime(query.Get("expiringBefore"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrDateIsInvalid)
+			return
+		}
+		form.ExpiringBefore = &expiringBefore
+	}
+
+	if query.Get("addedAfter") != "" {
+		addedAfter, err := models.ParseHistoryTime(query.Get("addedAfter"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrDateIsInvalid)
+			return
+		}
+		form.AddedAfter = &addedAfter
+	}
+
+	var err error
+	if query.Get("cursor") != "" {
+		form.Cursor, err = strconv.ParseUint(query.Get("cursor"), 10, 64)
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrCursorIsInvalid)
+			return
+		}
+	}
+
+	if query.Get("limit") != "" {
+		form.Limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			pkg.HandleError(w, r, errors.ErrLimitIsInvalid)
+			return
+		}
+	}
+
+	err = form.Validate()
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.GetSegmentUsers(form)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
+// AddSegmentUsers godoc
+// @Summary      AddSegmentUsers
+// @Description  add many users to the segment in batches, one transaction per batch; unknown users and users of another segment of the exclusive layer are skipped and reported
+// @Description  the body is a JSON form or a CSV with one user ID per line, sent as text/csv or as the file field of multipart/form-data; with a CSV until, ttl, source and reason are query parameters
+// @Tags     segment
+// @Accept	 application/json
+// @Accept	 text/csv
+// @Accept	 multipart/form-data
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param form body models.FormSegmentUsersBulk false "user IDs with until or ttl, source (IMPORT by default) and reason"
+// @Param file formData file false "CSV with one user ID per line"
+// @Param until query string false "until for a CSV"
+// @Param ttl query string false "ttl for a CSV"
+// @Param source query string false "source for a CSV: MANUAL, IMPORT or API"
+// @Success 200 {object} models.SegmentUsersBulkResponse "success add users to segment"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 400 {object} errors.JSONError "user IDs are invalid. send a JSON array userIDs or a CSV with one ID per line"
+// @Failure 400 {object} errors.JSONError "field until is invalid. format: RFC 3339 or YYYY-MM-DD HH:MM in Moscow time"
+// @Failure 400 {object} errors.JSONError "ttl is invalid. format: positive duration like 48h or 90m"
+// @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 409 {object} errors.JSONError "segment is archived"
+// @Failure 413 {object} errors.JSONError "too many user IDs"
+// @Failure 413 {object} errors.JSONError "request body is too large"
+// @Failure 415 {object} errors.JSONError "content type is not supported. use application/json, text/csv or multipart/form-data"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug}/users [post]
+func (d *Delivery) AddSegmentUsers(w http.ResponseWriter, r *http.Request) {
+	pkg.LiftDeadlines(w)
+
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	form, err := d.segmentUsersBulkForm(w, r)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.AddSegmentUsers(slug, form, pkg.RequestChange(r).WithReason(form.Reason))
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
+// RemoveSegmentUsers godoc
+// @Summary      RemoveSegmentUsers
+// @Description  remove many users from the segment in batches, one transaction per batch; unknown users are skipped and reported
+// @Description  the body is a JSON form or a CSV with one user ID per line as for adding, until, ttl and source are ignored
+// @Tags     segment
+// @Accept	 application/json
+// @Accept	 text/csv
+// @Accept	 multipart/form-data
+// @Produce  application/json
+// @Param slug path string true "slug"
+// @Param form body models.FormSegmentUsersBulk false "user IDs and reason"
+// @Param file formData file false "CSV with one user ID per line"
+// @Success 200 {object} models.SegmentUsersBulkResponse "success remove users from segment"
+// @Failure 400 {object} errors.JSONError "invalid url"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 400 {object} errors.JSONError "user IDs are invalid. send a JSON array userIDs or a CSV with one ID per line"
+// @Failure 404 {object} errors.JSONError "segment not found"
+// @Failure 409 {object} errors.JSONError "segment is archived"
+// @Failure 413 {object} errors.JSONError "too many user IDs"
+// @Failure 413 {object} errors.JSONError "request body is too large"
+// @Failure 415 {object} errors.JSONError "content type is not supported. use application/json, text/csv or multipart/form-data"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /segment/{slug}/users [delete]
+func (d *Delivery) RemoveSegmentUsers(w http.ResponseWriter, r *http.Request) {
+	pkg.LiftDeadlines(w)
+
+	vars := mux.Vars(r)
+	slug, ok := vars["slug"]
+	if !ok {
+		pkg.HandleError(w, r, errors.ErrInvalidURL)
+		return
+	}
+
+	form, err := d.segmentUsersBulkForm(w, r)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	response, err := d.uc.RemoveSegmentUsers(slug, form.UserIDs, pkg.RequestChange(r).WithReason(form.Reason))
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
+// segmentUsersBulkForm reads a JSON form or user IDs from a CSV sent as the body or as the file field of
+// a multipart form; for a CSV the rest of the form is taken from the query.
+// The body is limited by the size of bulk.max_users IDs, because the read deadline is lifted for bulk requests.
+func (d *Delivery) segmentUsersBulkForm(w http.ResponseWriter, r *http.Request) (models.FormSegmentUsersBulk, error) {
+	form := models.FormSegmentUsersBulk{}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return form, errors.ErrBodyTypeIsInvalid
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(d.cfg.Bulk.MaxUsers)*bulkBytesPerUserID+bulkFormBytes)
+
+	switch mediaType {
+	case pkg.ContentTypeJSON:
+		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+			if bodyIsTooLarge(err) {
+				return form, errors.ErrBodyIsTooLarge
+			}
+			return form, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error())
+		}
+
+		if len(form.UserIDs) > d.cfg.Bulk.MaxUsers {
+			return form, errors.ErrTooManyUserIDs
+		}
+	case pkg.ContentTypeCSV, pkg.ContentTypeMultipart:
+		var body io.Reader = r.Body
+		if mediaType == pkg.ContentTypeMultipart {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				if bodyIsTooLarge(err) {
+					return form, errors.ErrBodyIsTooLarge
+				}
+				return form, pkgErrors.Wrap(errors.ErrUserIDsAreInvalid, err.Error())
+			}
+			defer file.Close()
+
+			body = file
+		}
+
+		form.UserIDs, err = pkg.ReadUserIDs(body, d.cfg.Bulk.MaxUsers)
+		if bodyIsTooLarge(err) {
+			return form, errors.ErrBodyIsTooLarge
+		}
+		if err != nil {
+			return form, err
+		}
+
+		query := r.URL.Query()
+		if query.Has("until") {
+			until := query.Get("until")
+			form.Until = &until
+		}
+		if query.Has("ttl") {
+			ttl := query.Get("ttl")
+			form.TTL = &ttl
+		}
+		form.Source = query.Get("source")
+	default:
+		return form, errors.ErrBodyTypeIsInvalid
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(form); err != nil {
+		return form, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error())
+	}
+
+	return form, form.Validate()
+}
+
+func bodyIsTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return pkgErrors.As(err, &maxBytesErr)
+}
+
 // GetUserSegments godoc
 // @Summary      GetUserSegments
 // @Description  get user's segment
@@ -144,7 +578,7 @@ func (d *Delivery) GetSegment(w http.ResponseWriter, r *http.Request) {
 // @Accept	 application/json
 // @Produce  application/json
 // @Param id path int true "id"
-// @Success 200 {object} models.SegmentsResponse "success get user's segments"
+// @Success 200 {object} models.UserSegmentsResponse "success get user's segments"
 // @Failure 400 {object} errors.JSONError "invalid url"
 // @Failure 404 {object} errors.JSONError "user not found"
 // @Failure 500 {object} errors.JSONError "internal server error"
@@ -163,23 +597,74 @@ func (d *Delivery) GetUserSegments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pkg.SendJSON(w, r, http.StatusOK, models.SegmentsResponse{
+	pkg.SendJSON(w, r, http.StatusOK, models.UserSegmentsResponse{
 		Segments: segments,
 		Count:    len(segments),
 	})
 }
 
+// GetUsersSegments godoc
+// @Summary      GetUsersSegments
+// @Description  get active segments of many users at once, the users are keyed by ID and missing users are listed in unknownUserIDs
+// @Tags     segment
+// @Accept	 application/json
+// @Produce  application/json
+// @Param form body models.FormUsersSegments true "user IDs, up to bulk.batch_get_limit"
+// @Success 200 {object} models.UsersSegmentsResponse "success get users' segments"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 413 {object} errors.JSONError "too many user IDs"
+// @Failure 413 {object} errors.JSONError "request body is too large"
+// @Failure 500 {object} errors.JSONError "internal server error"
+// @Router   /users/segments:batchGet [post]
+func (d *Delivery) GetUsersSegments(w http.ResponseWriter, r *http.Request) {
+	// the body is limited by the size of bulk.batch_get_limit IDs as bulk forms are by bulk.max_users
+	r.Body = http.MaxBytesReader(w, r.Body, int64(d.cfg.Bulk.BatchGetLimit)*bulkBytesPerUserID+bulkFormBytes)
+
+	form := models.FormUsersSegments{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		if bodyIsTooLarge(err) {
+			pkg.HandleError(w, r, errors.ErrBodyIsTooLarge)
+			return
+		}
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, err.Error()))
+		return
+	}
+
+	if len(form.UserIDs) == 0 {
+		pkg.HandleError(w, r, pkgErrors.Wrap(errors.ErrInvalidForm, "no user IDs"))
+		return
+	}
+
+	if len(form.UserIDs) > d.cfg.Bulk.BatchGetLimit {
+		pkg.HandleError(w, r, errors.ErrTooManyUserIDs)
+		return
+	}
+
+	response, err := d.uc.GetUsersSegments(form.UserIDs)
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	pkg.SendJSON(w, r, http.StatusOK, response)
+}
+
 // EditUserSegments godoc
 // @Summary      EditUserSegments
-// @Description  edit user's segment
+// @Description  edit user's segment in one transaction, all unknown slugs are listed in details
 // @Tags     segment
 // @Accept	 application/json
 // @Produce  application/json
 // @Param id path int true "id"
 // @Param    segment body models.FormEditSegments true "form segment"
-// @Success 200 {object} models.SegmentsResponse "success edit user's segments"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
+// @Success 200 {object} models.UserSegmentsResponse "success edit user's segments"
 // @Failure 400 {object} errors.JSONError "invalid url"
-// @Failure 400 {object} errors.JSONError  "field until is invalid. format: YYYY-MM-DD HH:MM"
+// @Failure 400 {object} errors.JSONError "invalid form"
+// @Failure 400 {object} errors.JSONError "field until is invalid. format: RFC 3339 or YYYY-MM-DD HH:MM in Moscow time"
+// @Failure 400 {object} errors.JSONError "ttl is invalid. format: positive duration like 48h or 90m"
+// @Failure 400 {object} errors.JSONError "segment is both added and removed or added twice"
 // @Failure 404 {object} errors.JSONError "user not found"
 // @Failure 404 {object} errors.JSONError "segment not found"
 // @Failure 500 {object} errors.JSONError "internal server error"
@@ -210,13 +695,14 @@ func (d *Delivery) EditUserSegments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	segments, err := d.uc.EditUserSegments(userID, form.SegmentsToAdd, form.SegmentsToRemove)
+	segments, err := d.uc.EditUserSegments(userID, form.SegmentsToAdd, form.SegmentsToRemove,
+		pkg.RequestChange(r).WithReason(form.Reason))
 	if err != nil {
 		pkg.HandleError(w, r, err)
 		return
 	}
 
-	pkg.SendJSON(w, r, http.StatusOK, models.SegmentsResponse{
+	pkg.SendJSON(w, r, http.StatusOK, models.UserSegmentsResponse{
 		Segments: segments,
 		Count:    len(segments),
 	})
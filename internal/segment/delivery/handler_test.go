@@ -9,10 +9,16 @@ import (
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	mockSegmentUC "github.com/vvinokurshin/AvitoInternship/internal/segment/usecase/mocks"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func createConfig() *config.Config {
@@ -34,6 +40,20 @@ func TestDelivery_CreateSegment(t *testing.T) {
 	status := http.StatusOK
 	generateFakeData(&fakeForm)
 	fakeForm.Percent = nil
+	fakeForm.Rule = nil
+	fakeForm.StartsAt = nil
+	fakeForm.EndsAt = nil
+	fakeForm.DefaultTTL = nil
+	fakeForm.Variants = []models.Variant{
+		{
+			Name:   "A",
+			Weight: 1,
+		},
+		{
+			Name:   "B",
+			Weight: 1,
+		},
+	}
 	fakeUserResponse := &models.Segment{
 		Slug: fakeForm.Slug,
 	}
@@ -53,7 +73,7 @@ func TestDelivery_CreateSegment(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/segment/create", bytes.NewReader(body))
 	w := httptest.NewRecorder()
 
-	segmentUC.EXPECT().CreateSegment(fakeForm).Return(fakeUserResponse, nil)
+	segmentUC.EXPECT().CreateSegment(fakeForm, models.Change{Reason: fakeForm.Reason}).Return(fakeUserResponse, nil)
 	segmentH.CreateSegment(w, r)
 
 	if w.Code != status {
@@ -61,6 +81,49 @@ func TestDelivery_CreateSegment(t *testing.T) {
 	}
 }
 
+func TestDelivery_UpdateSegment(t *testing.T) {
+	cfg := createConfig()
+
+	slug := "test"
+	percent := 10
+	fakeForm := models.FormUpdateSegment{
+		Percent: &percent,
+	}
+	fakeSegmentResponse := &models.Segment{
+		SegmentID: 1,
+		Slug:      slug,
+		Percent:   &percent,
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPut, "/segment/", bytes.NewReader(body))
+	vars := map[string]string{
+		"slug": slug,
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().UpdateSegment(slug, fakeForm, models.Change{Reason: fakeForm.Reason}).Return(fakeSegmentResponse, nil)
+	segmentH.UpdateSegment(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
 func TestDelivery_DeleteSegment(t *testing.T) {
 	cfg := createConfig()
 
@@ -74,7 +137,8 @@ func TestDelivery_DeleteSegment(t *testing.T) {
 	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
 	segmentH := New(cfg, segmentUC)
 
-	r := httptest.NewRequest(http.MethodDelete, "/segment/", bytes.NewReader([]byte{}))
+	r := httptest.NewRequest(http.MethodDelete, "/segment/?reason=TICKET-42", bytes.NewReader([]byte{}))
+	r.Header.Set(pkg.HeaderActor, "pm@example.com")
 	vars := map[string]string{
 		"slug": slug,
 	}
@@ -82,7 +146,7 @@ func TestDelivery_DeleteSegment(t *testing.T) {
 	r = mux.SetURLVars(r, vars)
 	w := httptest.NewRecorder()
 
-	segmentUC.EXPECT().DeleteSegment(slug).Return(nil)
+	segmentUC.EXPECT().DeleteSegment(slug, models.Change{Actor: "pm@example.com", Reason: "TICKET-42"}).Return(nil)
 	segmentH.DeleteSegment(w, r)
 
 	if w.Code != status {
@@ -90,6 +154,65 @@ func TestDelivery_DeleteSegment(t *testing.T) {
 	}
 }
 
+func TestDelivery_RestoreSegment(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeSegmentResponse *models.Segment
+	generateFakeData(&fakeSegmentResponse)
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	r := httptest.NewRequest(http.MethodPost, "/segment/restore", bytes.NewReader([]byte{}))
+	vars := map[string]string{
+		"slug": fakeSegmentResponse.Slug,
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().RestoreSegment(fakeSegmentResponse.Slug, models.Change{}).Return(fakeSegmentResponse, nil)
+	segmentH.RestoreSegment(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_PurgeSegment(t *testing.T) {
+	cfg := createConfig()
+
+	slug := "test"
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	r := httptest.NewRequest(http.MethodDelete, "/segment/purge?confirm="+slug, bytes.NewReader([]byte{}))
+	vars := map[string]string{
+		"slug": slug,
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().PurgeSegment(slug, slug).Return(nil)
+	segmentH.PurgeSegment(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
 func TestDelivery_GetSegment(t *testing.T) {
 	cfg := createConfig()
 
@@ -124,7 +247,7 @@ func TestDelivery_GetUserSegments(t *testing.T) {
 	cfg := createConfig()
 
 	userID := uint64(1)
-	var fakeUserSegmentsResponse []models.Segment
+	var fakeUserSegmentsResponse []models.UserSegment
 	generateFakeData(&fakeUserSegmentsResponse)
 	status := http.StatusOK
 
@@ -156,15 +279,19 @@ func TestDelivery_EditUserSegments(t *testing.T) {
 
 	userID := uint64(1)
 	var fakeForm models.FormEditSegments
-	var fakeUserSegmentsResponse []models.Segment
+	var fakeUserSegmentsResponse []models.UserSegment
 	generateFakeData(&fakeForm)
 	generateFakeData(&fakeUserSegmentsResponse)
 	status := http.StatusOK
 
 	for idx, _ := range fakeForm.SegmentsToAdd {
 		fakeForm.SegmentsToAdd[idx].Until = nil
+		fakeForm.SegmentsToAdd[idx].TTL = nil
 		fakeForm.SegmentsToAdd[idx].SegmentID = 0
+		fakeForm.SegmentsToAdd[idx].Source = models.SourceManual
+		fakeForm.SegmentsToAdd[idx].Variant = ""
 	}
+	fakeForm.Source = ""
 
 	t.Parallel()
 	ctrl := gomock.NewController(t)
@@ -179,6 +306,114 @@ func TestDelivery_EditUserSegments(t *testing.T) {
 	}
 
 	r := httptest.NewRequest(http.MethodGet, "/user/{id}/segments", bytes.NewReader(body))
+	r.Header.Set(pkg.HeaderActor, "pm@example.com")
+	r.Header.Set(pkg.HeaderRequestID, "request-1")
+	vars := map[string]string{
+		"id": strconv.FormatUint(userID, 10),
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().EditUserSegments(userID, fakeForm.SegmentsToAdd, fakeForm.SegmentsToRemove,
+		models.Change{Actor: "pm@example.com", Reason: fakeForm.Reason, RequestID: "request-1"}).Return(fakeUserSegmentsResponse, nil)
+	segmentH.EditUserSegments(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_EditUserSegmentsUntilMoscow(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(1)
+	offsetUntil, legacyUntil := "2023-09-01T12:00:00+03:00", "2023-09-01 12:00"
+	fakeForm := models.FormEditSegments{
+		SegmentsToAdd: []models.AddUserToSegment{
+			{
+				SegmentSlug: "offset",
+				Until:       &offsetUntil,
+			},
+			{
+				SegmentSlug: "legacy",
+				Until:       &legacyUntil,
+			},
+		},
+	}
+	expectedOffset, expectedLegacy := "2023-09-01T09:00:00Z", "2023-09-01T09:00:00Z"
+	expectedSegmentsToAdd := []models.AddUserToSegment{
+		{
+			SegmentSlug: "offset",
+			Until:       &expectedOffset,
+			Source:      models.SourceManual,
+		},
+		{
+			SegmentSlug: "legacy",
+			Until:       &expectedLegacy,
+			Source:      models.SourceManual,
+		},
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/user/{id}/segments", bytes.NewReader(body))
+	vars := map[string]string{
+		"id": strconv.FormatUint(userID, 10),
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().EditUserSegments(userID, expectedSegmentsToAdd, []string(nil), models.Change{}).
+		Return([]models.UserSegment{}, nil)
+	segmentH.EditUserSegments(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_EditUserSegmentsUntilAndTTL(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(1)
+	until, ttl := "2023-09-01T12:00:00Z", "48h"
+	fakeForm := models.FormEditSegments{
+		SegmentsToAdd: []models.AddUserToSegment{
+			{
+				SegmentSlug: "test",
+				Until:       &until,
+				TTL:         &ttl,
+			},
+		},
+	}
+	status := http.StatusBadRequest
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/user/{id}/segments", bytes.NewReader(body))
 	vars := map[string]string{
 		"id": strconv.FormatUint(userID, 10),
 	}
@@ -186,10 +421,416 @@ func TestDelivery_EditUserSegments(t *testing.T) {
 	r = mux.SetURLVars(r, vars)
 	w := httptest.NewRecorder()
 
-	segmentUC.EXPECT().EditUserSegments(userID, fakeForm.SegmentsToAdd, fakeForm.SegmentsToRemove).Return(fakeUserSegmentsResponse, nil)
 	segmentH.EditUserSegments(w, r)
 
 	if w.Code != status {
 		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
 	}
 }
+
+func TestDelivery_GetSegments(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeSegments []models.SegmentSummary
+	generateFakeData(&fakeSegments)
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/segments", bytes.NewReader([]byte{}))
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().GetSegments().Return(fakeSegments, nil)
+	segmentH.GetSegments(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+
+	var response models.SegmentSummariesResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("error while unmarshaling response: %v", err)
+	}
+	if response.Count != len(fakeSegments) {
+		t.Errorf("[TEST] simple: Expected count %d, got %d ", len(fakeSegments), response.Count)
+	}
+}
+
+func TestDelivery_GetSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+
+	addedAfter := time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC)
+	form := models.FormSegmentUsers{
+		Slug:       "test",
+		Source:     models.SourceManual,
+		AddedAfter: &addedAfter,
+		Cursor:     10,
+		Limit:      errors.DefaultSegmentUsersLimit,
+	}
+	fakeResponse := &models.SegmentUsersResponse{
+		Users: []models.SegmentUser{{UserID: 11, Source: models.SourceManual}},
+		Count: 1,
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	r := httptest.NewRequest(http.MethodGet, "/segment/test/users?source=MANUAL&addedAfter=2023-08-01&cursor=10", nil)
+	vars := map[string]string{
+		"slug": form.Slug,
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().GetSegmentUsers(form).Return(fakeResponse, nil)
+	segmentH.GetSegmentUsers(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_GetSegmentUsersInvalidQuery(t *testing.T) {
+	cfg := createConfig()
+
+	queries := []string{
+		"source=UNKNOWN",
+		"source=RULE",
+		"expiringBefore=tomorrow",
+		"addedAfter=2023-13-01",
+		"cursor=abc",
+		"limit=100000",
+	}
+	status := http.StatusBadRequest
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	for _, query := range queries {
+		r := httptest.NewRequest(http.MethodGet, "/segment/test/users?"+query, nil)
+		vars := map[string]string{
+			"slug": "test",
+		}
+
+		r = mux.SetURLVars(r, vars)
+		w := httptest.NewRecorder()
+
+		segmentH.GetSegmentUsers(w, r)
+
+		if w.Code != status {
+			t.Errorf("[TEST] %s: Expected status %d, got %d ", query, status, w.Code)
+		}
+	}
+}
+
+func TestDelivery_AddSegmentUsersJSON(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.MaxUsers = 10
+
+	fakeForm := models.FormSegmentUsersBulk{
+		UserIDs: []uint64{1, 2},
+		Reason:  "import",
+	}
+	fakeResponse := &models.SegmentUsersBulkResponse{
+		Processed:   1,
+		Unknown:     []uint64{2},
+		Conflicting: []uint64{},
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/segment/test/users", bytes.NewReader(body))
+	r.Header.Set("Content-Type", pkg.ContentTypeJSON)
+	vars := map[string]string{
+		"slug": "test",
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	expectedForm := fakeForm
+	expectedForm.Source = models.SourceImport
+	segmentUC.EXPECT().AddSegmentUsers("test", expectedForm, models.Change{Reason: "import"}).Return(fakeResponse, nil)
+	segmentH.AddSegmentUsers(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_AddSegmentUsersCSV(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.MaxUsers = 10
+
+	until := "2023-09-01T09:00:00Z"
+	expectedForm := models.FormSegmentUsersBulk{
+		UserIDs: []uint64{1, 2, 3},
+		Until:   &until,
+		Source:  models.SourceAPI,
+	}
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	r := httptest.NewRequest(http.MethodPost, "/segment/test/users?until=2023-09-01T12:00:00%2B03:00&source=API",
+		bytes.NewReader([]byte("user_id\n1\n2\n3\n")))
+	r.Header.Set("Content-Type", pkg.ContentTypeCSV)
+	vars := map[string]string{
+		"slug": "test",
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().AddSegmentUsers("test", expectedForm, models.Change{}).
+		Return(&models.SegmentUsersBulkResponse{Processed: 3}, nil)
+	segmentH.AddSegmentUsers(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_RemoveSegmentUsersMultipart(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.MaxUsers = 10
+
+	status := http.StatusOK
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	file, err := writer.CreateFormFile("file", "users.csv")
+	if err != nil {
+		t.Fatalf("error while creating form file: %v", err)
+	}
+	file.Write([]byte("4\n5\n"))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodDelete, "/segment/test/users?reason=cleanup", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	vars := map[string]string{
+		"slug": "test",
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().RemoveSegmentUsers("test", []uint64{4, 5}, models.Change{Reason: "cleanup"}).
+		Return(&models.SegmentUsersBulkResponse{Processed: 2}, nil)
+	segmentH.RemoveSegmentUsers(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_RemoveSegmentUsersMultipartTooLarge(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.MaxUsers = 10
+
+	status := http.StatusRequestEntityTooLarge
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	file, err := writer.CreateFormFile("file", "users.csv")
+	if err != nil {
+		t.Fatalf("error while creating form file: %v", err)
+	}
+	file.Write([]byte("4\n" + strings.Repeat(" ", 1<<17) + "\n5\n"))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodDelete, "/segment/test/users", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	vars := map[string]string{
+		"slug": "test",
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentH.RemoveSegmentUsers(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+}
+
+func TestDelivery_AddSegmentUsersInvalidBody(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.MaxUsers = 2
+
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{contentType: "text/plain", body: "1\n2\n", status: http.StatusUnsupportedMediaType},
+		{contentType: pkg.ContentTypeJSON, body: `{"userIDs": []}`, status: http.StatusBadRequest},
+		{contentType: pkg.ContentTypeJSON, body: `{"userIDs": [1, 2, 3]}`, status: http.StatusRequestEntityTooLarge},
+		{contentType: pkg.ContentTypeCSV, body: "1\n2\n3\n", status: http.StatusRequestEntityTooLarge},
+		{contentType: pkg.ContentTypeCSV, body: "1\nabc\n", status: http.StatusBadRequest},
+		{contentType: pkg.ContentTypeJSON, body: `{"userIDs": [1], "until": "2023-09-01T12:00:00Z", "ttl": "1h"}`,
+			status: http.StatusBadRequest},
+		{contentType: pkg.ContentTypeJSON, body: `{"userIDs": [1` + strings.Repeat(" ", 1<<17) + `]}`,
+			status: http.StatusRequestEntityTooLarge},
+		{contentType: pkg.ContentTypeCSV, body: "1\n" + strings.Repeat(" ", 1<<17) + "\n2\n",
+			status: http.StatusRequestEntityTooLarge},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/segment/test/users", bytes.NewReader([]byte(test.body)))
+		r.Header.Set("Content-Type", test.contentType)
+		vars := map[string]string{
+			"slug": "test",
+		}
+
+		r = mux.SetURLVars(r, vars)
+		w := httptest.NewRecorder()
+
+		segmentH.AddSegmentUsers(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("[TEST] %s %s: Expected status %d, got %d ", test.contentType, test.body, test.status, w.Code)
+		}
+	}
+}
+
+func TestDelivery_GetUsersSegments(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.BatchGetLimit = 2
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{body: `{"userIDs": [1, 2]}`, status: http.StatusOK},
+		{body: `{"userIDs": []}`, status: http.StatusBadRequest},
+		{body: `{"userIDs": [1, 2, 3]}`, status: http.StatusRequestEntityTooLarge},
+		{body: `{"userIDs": ["1"]}`, status: http.StatusBadRequest},
+		{body: `{"userIDs": [1` + strings.Repeat(" ", 1<<17) + `]}`, status: http.StatusRequestEntityTooLarge},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	segmentUC.EXPECT().GetUsersSegments([]uint64{1, 2}).Return(&models.UsersSegmentsResponse{
+		Users:   map[uint64][]models.UserSegment{1: {}},
+		Unknown: []uint64{2},
+	}, nil)
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/users/segments:batchGet", bytes.NewReader([]byte(test.body)))
+		w := httptest.NewRecorder()
+
+		segmentH.GetUsersSegments(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("[TEST] %s: Expected status %d, got %d ", test.body, test.status, w.Code)
+		}
+	}
+}
+
+func TestDelivery_EditUserSegmentsUnknownSlugs(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(1)
+	fakeForm := models.FormEditSegments{
+		SegmentsToAdd: []models.AddUserToSegment{
+			{SegmentSlug: "missing"},
+		},
+		SegmentsToRemove: []string{"gone"},
+	}
+	status := http.StatusNotFound
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentUC := mockSegmentUC.NewMockUseCaseI(ctrl)
+	segmentH := New(cfg, segmentUC)
+
+	body, err := json.Marshal(fakeForm)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPut, "/user/{id}/segments/edit", bytes.NewReader(body))
+	vars := map[string]string{
+		"id": strconv.FormatUint(userID, 10),
+	}
+
+	r = mux.SetURLVars(r, vars)
+	w := httptest.NewRecorder()
+
+	segmentUC.EXPECT().EditUserSegments(userID, gomock.Any(), fakeForm.SegmentsToRemove, models.Change{}).
+		Return(nil, errors.WithDetails(errors.ErrSegmentNotFound, "missing", "gone"))
+	segmentH.EditUserSegments(w, r)
+
+	if w.Code != status {
+		t.Errorf("[TEST] simple: Expected status %d, got %d ", status, w.Code)
+	}
+
+	var response errors.JSONError
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("error while unmarshaling response: %v", err)
+	}
+	if !reflect.DeepEqual(response.Details, []string{"missing", "gone"}) {
+		t.Errorf("[TEST] simple: Expected details %v, got %v ", []string{"missing", "gone"}, response.Details)
+	}
+}
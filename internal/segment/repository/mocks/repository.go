@@ -34,6 +34,49 @@ func (m *MockRepositoryI) EXPECT() *MockRepositoryIMockRecorder {
 	return m.recorder
 }
 
+// AddUsersToSegment mocks base method.
+func (m *MockRepositoryI) AddUsersToSegment(segmentID uint64, members []models.SegmentMember, until *string, source string, change models.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUsersToSegment", segmentID, members, until, source, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUsersToSegment indicates an expected call of AddUsersToSegment.
+func (mr *MockRepositoryIMockRecorder) AddUsersToSegment(segmentID, members, until, source, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUsersToSegment", reflect.TypeOf((*MockRepositoryI)(nil).AddUsersToSegment), segmentID, members, until, source, change)
+}
+
+// ArchiveSegment mocks base method.
+func (m *MockRepositoryI) ArchiveSegment(segmentID uint64, change models.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArchiveSegment", segmentID, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ArchiveSegment indicates an expected call of ArchiveSegment.
+func (mr *MockRepositoryIMockRecorder) ArchiveSegment(segmentID, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArchiveSegment", reflect.TypeOf((*MockRepositoryI)(nil).ArchiveSegment), segmentID, change)
+}
+
+// CountSegmentUsers mocks base method.
+func (m *MockRepositoryI) CountSegmentUsers(segmentID uint64, filter models.SegmentUsersFilter) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountSegmentUsers", segmentID, filter)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountSegmentUsers indicates an expected call of CountSegmentUsers.
+func (mr *MockRepositoryIMockRecorder) CountSegmentUsers(segmentID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountSegmentUsers", reflect.TypeOf((*MockRepositoryI)(nil).CountSegmentUsers), segmentID, filter)
+}
+
 // DeleteSegment mocks base method.
 func (m *MockRepositoryI) DeleteSegment(slug string) error {
 	m.ctrl.T.Helper()
@@ -49,17 +92,45 @@ func (mr *MockRepositoryIMockRecorder) DeleteSegment(slug interface{}) *gomock.C
 }
 
 // DeleteSegmentsFromUser mocks base method.
-func (m *MockRepositoryI) DeleteSegmentsFromUser(userID uint64, segmentIDs []uint64) error {
+func (m *MockRepositoryI) DeleteSegmentsFromUser(userID uint64, segmentIDs []uint64, change models.Change) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteSegmentsFromUser", userID, segmentIDs)
+	ret := m.ctrl.Call(m, "DeleteSegmentsFromUser", userID, segmentIDs, change)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteSegmentsFromUser indicates an expected call of DeleteSegmentsFromUser.
-func (mr *MockRepositoryIMockRecorder) DeleteSegmentsFromUser(userID, segmentIDs interface{}) *gomock.Call {
+func (mr *MockRepositoryIMockRecorder) DeleteSegmentsFromUser(userID, segmentIDs, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegmentsFromUser", reflect.TypeOf((*MockRepositoryI)(nil).DeleteSegmentsFromUser), userID, segmentIDs, change)
+}
+
+// DeleteUserMemberships mocks base method.
+func (m *MockRepositoryI) DeleteUserMemberships(userID uint64, change models.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserMemberships", userID, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserMemberships indicates an expected call of DeleteUserMemberships.
+func (mr *MockRepositoryIMockRecorder) DeleteUserMemberships(userID, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegmentsFromUser", reflect.TypeOf((*MockRepositoryI)(nil).DeleteSegmentsFromUser), userID, segmentIDs)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserMemberships", reflect.TypeOf((*MockRepositoryI)(nil).DeleteUserMemberships), userID, change)
+}
+
+// DeleteUsersFromSegment mocks base method.
+func (m *MockRepositoryI) DeleteUsersFromSegment(segmentID uint64, userIDs []uint64, change models.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUsersFromSegment", segmentID, userIDs, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUsersFromSegment indicates an expected call of DeleteUsersFromSegment.
+func (mr *MockRepositoryIMockRecorder) DeleteUsersFromSegment(segmentID, userIDs, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUsersFromSegment", reflect.TypeOf((*MockRepositoryI)(nil).DeleteUsersFromSegment), segmentID, userIDs, change)
 }
 
 // InsertSegment mocks base method.
@@ -78,46 +149,75 @@ func (mr *MockRepositoryIMockRecorder) InsertSegment(segment interface{}) *gomoc
 }
 
 // InsertSegmentsToUser mocks base method.
-func (m *MockRepositoryI) InsertSegmentsToUser(userID uint64, segments []models.AddUserToSegment) error {
+func (m *MockRepositoryI) InsertSegmentsToUser(userID uint64, segments []models.AddUserToSegment, change models.Change) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertSegmentsToUser", userID, segments)
+	ret := m.ctrl.Call(m, "InsertSegmentsToUser", userID, segments, change)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertSegmentsToUser indicates an expected call of InsertSegmentsToUser.
-func (mr *MockRepositoryIMockRecorder) InsertSegmentsToUser(userID, segments interface{}) *gomock.Call {
+func (mr *MockRepositoryIMockRecorder) InsertSegmentsToUser(userID, segments, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertSegmentsToUser", reflect.TypeOf((*MockRepositoryI)(nil).InsertSegmentsToUser), userID, segments)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertSegmentsToUser", reflect.TypeOf((*MockRepositoryI)(nil).InsertSegmentsToUser), userID, segments, change)
 }
 
 // InsertUsersToSegment mocks base method.
-func (m *MockRepositoryI) InsertUsersToSegment(segmentID uint64, userIDs []uint64) error {
+func (m *MockRepositoryI) InsertUsersToSegment(segmentID uint64, members []models.SegmentMember, change models.Change) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertUsersToSegment", segmentID, userIDs)
+	ret := m.ctrl.Call(m, "InsertUsersToSegment", segmentID, members, change)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertUsersToSegment indicates an expected call of InsertUsersToSegment.
-func (mr *MockRepositoryIMockRecorder) InsertUsersToSegment(segmentID, userIDs interface{}) *gomock.Call {
+func (mr *MockRepositoryIMockRecorder) InsertUsersToSegment(segmentID, members, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUsersToSegment", reflect.TypeOf((*MockRepositoryI)(nil).InsertUsersToSegment), segmentID, userIDs)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUsersToSegment", reflect.TypeOf((*MockRepositoryI)(nil).InsertUsersToSegment), segmentID, members, change)
 }
 
-// SelectSegmentByID mocks base method.
-func (m *MockRepositoryI) SelectSegmentByID(segmentID uint64) (*models.Segment, error) {
+// RestoreSegment mocks base method.
+func (m *MockRepositoryI) RestoreSegment(segmentID uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectSegmentByID", segmentID)
-	ret0, _ := ret[0].(*models.Segment)
+	ret := m.ctrl.Call(m, "RestoreSegment", segmentID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreSegment indicates an expected call of RestoreSegment.
+func (mr *MockRepositoryIMockRecorder) RestoreSegment(segmentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreSegment", reflect.TypeOf((*MockRepositoryI)(nil).RestoreSegment), segmentID)
+}
+
+// SelectDynamicSegments mocks base method.
+func (m *MockRepositoryI) SelectDynamicSegments() ([]models.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectDynamicSegments")
+	ret0, _ := ret[0].([]models.Segment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// SelectSegmentByID indicates an expected call of SelectSegmentByID.
-func (mr *MockRepositoryIMockRecorder) SelectSegmentByID(segmentID interface{}) *gomock.Call {
+// SelectDynamicSegments indicates an expected call of SelectDynamicSegments.
+func (mr *MockRepositoryIMockRecorder) SelectDynamicSegments() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentByID", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentByID), segmentID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectDynamicSegments", reflect.TypeOf((*MockRepositoryI)(nil).SelectDynamicSegments))
+}
+
+// SelectMemberIDs mocks base method.
+func (m *MockRepositoryI) SelectMemberIDs(segmentIDs, userIDs []uint64) ([]uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectMemberIDs", segmentIDs, userIDs)
+	ret0, _ := ret[0].([]uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectMemberIDs indicates an expected call of SelectMemberIDs.
+func (mr *MockRepositoryIMockRecorder) SelectMemberIDs(segmentIDs, userIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectMemberIDs", reflect.TypeOf((*MockRepositoryI)(nil).SelectMemberIDs), segmentIDs, userIDs)
 }
 
 // SelectSegmentBySlug mocks base method.
@@ -135,11 +235,86 @@ func (mr *MockRepositoryIMockRecorder) SelectSegmentBySlug(slug interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentBySlug", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentBySlug), slug)
 }
 
+// SelectSegmentSummaries mocks base method.
+func (m *MockRepositoryI) SelectSegmentSummaries() ([]models.SegmentSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentSummaries")
+	ret0, _ := ret[0].([]models.SegmentSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentSummaries indicates an expected call of SelectSegmentSummaries.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentSummaries() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentSummaries", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentSummaries))
+}
+
+// SelectSegmentUserIDs mocks base method.
+func (m *MockRepositoryI) SelectSegmentUserIDs(segmentID uint64, source string) ([]uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentUserIDs", segmentID, source)
+	ret0, _ := ret[0].([]uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentUserIDs indicates an expected call of SelectSegmentUserIDs.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentUserIDs(segmentID, source interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentUserIDs", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentUserIDs), segmentID, source)
+}
+
+// SelectSegmentUsers mocks base method.
+func (m *MockRepositoryI) SelectSegmentUsers(segmentID uint64, filter models.SegmentUsersFilter) ([]models.SegmentUser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentUsers", segmentID, filter)
+	ret0, _ := ret[0].([]models.SegmentUser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentUsers indicates an expected call of SelectSegmentUsers.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentUsers(segmentID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentUsers", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentUsers), segmentID, filter)
+}
+
+// SelectSegmentsByLayer mocks base method.
+func (m *MockRepositoryI) SelectSegmentsByLayer(layerID uint64) ([]models.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentsByLayer", layerID)
+	ret0, _ := ret[0].([]models.Segment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentsByLayer indicates an expected call of SelectSegmentsByLayer.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentsByLayer(layerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentsByLayer", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentsByLayer), layerID)
+}
+
+// SelectSegmentsBySlugs mocks base method.
+func (m *MockRepositoryI) SelectSegmentsBySlugs(slugs []string) ([]models.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentsBySlugs", slugs)
+	ret0, _ := ret[0].([]models.Segment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentsBySlugs indicates an expected call of SelectSegmentsBySlugs.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentsBySlugs(slugs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentsBySlugs", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentsBySlugs), slugs)
+}
+
 // SelectSegmentsByUser mocks base method.
-func (m *MockRepositoryI) SelectSegmentsByUser(userID uint64) ([]models.Segment, error) {
+func (m *MockRepositoryI) SelectSegmentsByUser(userID uint64) ([]models.UserSegment, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "SelectSegmentsByUser", userID)
-	ret0, _ := ret[0].([]models.Segment)
+	ret0, _ := ret[0].([]models.UserSegment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -149,3 +324,46 @@ func (mr *MockRepositoryIMockRecorder) SelectSegmentsByUser(userID interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentsByUser", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentsByUser), userID)
 }
+
+// SelectSegmentsByUsers mocks base method.
+func (m *MockRepositoryI) SelectSegmentsByUsers(userIDs []uint64) (map[uint64][]models.UserSegment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSegmentsByUsers", userIDs)
+	ret0, _ := ret[0].(map[uint64][]models.UserSegment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSegmentsByUsers indicates an expected call of SelectSegmentsByUsers.
+func (mr *MockRepositoryIMockRecorder) SelectSegmentsByUsers(userIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSegmentsByUsers", reflect.TypeOf((*MockRepositoryI)(nil).SelectSegmentsByUsers), userIDs)
+}
+
+// UpdateSegment mocks base method.
+func (m *MockRepositoryI) UpdateSegment(segment *models.Segment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSegment", segment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSegment indicates an expected call of UpdateSegment.
+func (mr *MockRepositoryIMockRecorder) UpdateSegment(segment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSegment", reflect.TypeOf((*MockRepositoryI)(nil).UpdateSegment), segment)
+}
+
+// UpdateUserSegments mocks base method.
+func (m *MockRepositoryI) UpdateUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentIDsToRemove []uint64, change models.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserSegments", userID, segmentsToAdd, segmentIDsToRemove, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserSegments indicates an expected call of UpdateUserSegments.
+func (mr *MockRepositoryIMockRecorder) UpdateUserSegments(userID, segmentsToAdd, segmentIDsToRemove, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserSegments", reflect.TypeOf((*MockRepositoryI)(nil).UpdateUserSegments), userID, segmentsToAdd, segmentIDsToRemove, change)
+}
@@ -3,12 +3,23 @@ package postgres
 import (
 	"fmt"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"time"
 )
 
 type Segment struct {
-	SegmentID uint64 `gorm:"primary_key"`
-	Slug      string
-	Percent   *int `gorm:"null"`
+	SegmentID   uint64 `gorm:"primary_key"`
+	Slug        string
+	Percent     *int `gorm:"null"`
+	Salt        string
+	Variants    []models.Variant `gorm:"serializer:json"`
+	LayerID     *uint64          `gorm:"null"`
+	LayerOffset int
+	Rule        *string    `gorm:"null"`
+	StartsAt    *time.Time `gorm:"null"`
+	EndsAt      *time.Time `gorm:"null"`
+	DefaultTTL  *string    `gorm:"null"`
+	Active      bool
+	ArchivedAt  *time.Time `gorm:"null"`
 }
 
 func (Segment) TableName(schemaName, tableName string) string {
@@ -19,22 +30,120 @@ func (s *Segment) FromSegmentModel(segment *models.Segment) {
 	s.SegmentID = segment.SegmentID
 	s.Slug = segment.Slug
 	s.Percent = segment.Percent
+	s.Salt = segment.Salt
+	s.Variants = segment.Variants
+	s.LayerID = segment.LayerID
+	s.LayerOffset = segment.LayerOffset
+	s.Rule = segment.Rule
+	s.StartsAt = segment.StartsAt
+	s.EndsAt = segment.EndsAt
+	s.DefaultTTL = segment.DefaultTTL
+	s.Active = segment.IsActive(time.Now())
+	s.ArchivedAt = segment.ArchivedAt
 }
 
 func (s *Segment) ToSegmentModel() *models.Segment {
 	return &models.Segment{
-		SegmentID: s.SegmentID,
-		Slug:      s.Slug,
-		Percent:   s.Percent,
+		SegmentID:   s.SegmentID,
+		Slug:        s.Slug,
+		Percent:     s.Percent,
+		Salt:        s.Salt,
+		Variants:    s.Variants,
+		LayerID:     s.LayerID,
+		LayerOffset: s.LayerOffset,
+		Rule:        s.Rule,
+		StartsAt:    s.StartsAt,
+		EndsAt:      s.EndsAt,
+		DefaultTTL:  s.DefaultTTL,
+		ArchivedAt:  s.ArchivedAt,
 	}
 }
 
+type UserSegment struct {
+	Segment `gorm:"embedded"`
+	Source  string
+	Variant string
+	Until   *time.Time
+}
+
+func (s *UserSegment) ToUserSegmentModel() *models.UserSegment {
+	userSegment := &models.UserSegment{
+		Segment: *s.Segment.ToSegmentModel(),
+		Source:  s.Source,
+		Variant: s.Variant,
+	}
+	if s.Until != nil {
+		until := models.FormatUntil(*s.Until)
+		userSegment.Until = &until
+	}
+
+	return userSegment
+}
+
+// MemberSegment is a stored segment of one of several users read at once.
+type MemberSegment struct {
+	UserSegment `gorm:"embedded"`
+	UserID      uint64
+}
+
+// SegmentSummary is a segment with the number of its current members.
+type SegmentSummary struct {
+	Segment `gorm:"embedded"`
+	Members int64
+}
+
+func (s *SegmentSummary) ToSegmentSummaryModel() *models.SegmentSummary {
+	members := s.Members
+
+	return &models.SegmentSummary{
+		Segment: *s.Segment.ToSegmentModel(),
+		Members: &members,
+	}
+}
+
+// SegmentUser is a membership read for listing; added_at is filled by the database on insert.
+type SegmentUser struct {
+	UserID  uint64
+	Source  string
+	Variant string
+	Until   *time.Time
+	AddedAt time.Time
+}
+
+func (u *SegmentUser) ToSegmentUserModel() *models.SegmentUser {
+	segmentUser := &models.SegmentUser{
+		UserID:  u.UserID,
+		Source:  u.Source,
+		Variant: u.Variant,
+		AddedAt: u.AddedAt.UTC(),
+	}
+	if u.Until != nil {
+		until := models.FormatUntil(*u.Until)
+		segmentUser.Until = &until
+	}
+
+	return segmentUser
+}
+
 type Users2Segments struct {
 	UserID    uint64
 	SegmentID uint64
 	Until     *string
+	Source    string
+	Variant   string
 }
 
 func (Users2Segments) TableName(schemaName, tableName string) string {
 	return fmt.Sprintf("%s.%s", schemaName, tableName)
 }
+
+// expired reports whether the membership's until has passed by the moment; such a row is hidden on read
+// until the sweep removes it.
+func (u Users2Segments) expired(moment time.Time) bool {
+	if u.Until == nil {
+		return false
+	}
+
+	until, err := models.ParseUntil(*u.Until)
+	return err == nil && !until.After(moment)
+}
@@ -2,27 +2,53 @@ package postgres
 
 import (
 	pkgErrors "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	"github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
 	"github.com/vvinokurshin/AvitoInternship/pkg"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"time"
 )
 
+// defaultExpiryPollInterval is used when the config does not set a positive poll interval.
+const defaultExpiryPollInterval = time.Minute
+
+// HistoryWriter returns the history repository bound to tx, membership changes are logged through it
+// in the transaction that makes them.
+type HistoryWriter func(tx *gorm.DB) historyRepository.RepositoryI
+
 type segmentRepo struct {
-	cfg *config.Config
-	db  *gorm.DB
+	cfg          *config.Config
+	db           *gorm.DB
+	history      HistoryWriter
+	pollInterval time.Duration
+	expirations  *pkg.Deadlines
+	activations  *pkg.Deadlines
 }
 
-func New(cfg *config.Config, db *gorm.DB) (repository.RepositoryI, error) {
+func New(cfg *config.Config, db *gorm.DB, history HistoryWriter) (repository.RepositoryI, error) {
 	segRepo := &segmentRepo{
-		cfg: cfg,
-		db:  db,
+		cfg:          cfg,
+		db:           db,
+		history:      history,
+		pollInterval: cfg.Expiry.PollInterval,
+	}
+	if segRepo.pollInterval <= 0 {
+		segRepo.pollInterval = defaultExpiryPollInterval
+	}
+	segRepo.expirations = pkg.NewDeadlines(segRepo.ClearExpiredConnections)
+	segRepo.activations = pkg.NewDeadlines(segRepo.SwitchSegmentsActivity)
+
+	err := pkg.CronInit("@every "+segRepo.pollInterval.String(), segRepo.ScheduleExpirations)
+	if err != nil {
+		return nil, pkgErrors.Wrap(err, "cron init")
 	}
 
-	err := pkg.CronInit("@every 5m", segRepo.ClearExpiredConnections)
+	err = pkg.CronInit("@every "+segRepo.pollInterval.String(), segRepo.ScheduleActivations)
 	if err != nil {
 		return nil, pkgErrors.Wrap(err, "cron init")
 	}
@@ -30,6 +56,15 @@ func New(cfg *config.Config, db *gorm.DB) (repository.RepositoryI, error) {
 	return segRepo, nil
 }
 
+// NewTx returns a copy of repo, which must be created by New, bound to the transaction tx. The copy starts
+// no background jobs of its own and arms the timers of repo.
+func NewTx(repo repository.RepositoryI, tx *gorm.DB) repository.RepositoryI {
+	txRepo := *repo.(*segmentRepo)
+	txRepo.db = tx
+
+	return &txRepo
+}
+
 func (repo *segmentRepo) InsertSegment(segment *models.Segment) (uint64, error) {
 	var dbSegment Segment
 	dbSegment.FromSegmentModel(segment)
@@ -39,9 +74,46 @@ func (repo *segmentRepo) InsertSegment(segment *models.Segment) (uint64, error)
 		return 0, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
 
+	repo.scheduleWindow(segment)
+
 	return dbSegment.SegmentID, nil
 }
 
+// UpdateSegment keeps active as it was and switches it in the same transaction, so a window moved over
+// the current moment is logged as ACTIVATE/DEACTIVATE right away.
+func (repo *segmentRepo) UpdateSegment(segment *models.Segment) error {
+	var dbSegment Segment
+	dbSegment.FromSegmentModel(segment)
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+			Select("*").Omit("segment_id", "active", "archived_at").Updates(&dbSegment).Error
+		if err != nil {
+			return err
+		}
+
+		return repo.switchActivity(tx, segment.SegmentID)
+	})
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	repo.scheduleWindow(segment)
+
+	return nil
+}
+
+// scheduleWindow arms the activation timers at the bounds of the segment's window that come before the next poll,
+// the later ones are armed by ScheduleActivations.
+func (repo *segmentRepo) scheduleWindow(segment *models.Segment) {
+	horizon := time.Now().Add(repo.pollInterval)
+	for _, moment := range []*time.Time{segment.StartsAt, segment.EndsAt} {
+		if moment != nil && moment.After(time.Now()) && !moment.After(horizon) {
+			repo.activations.Schedule(*moment)
+		}
+	}
+}
+
 func (repo *segmentRepo) DeleteSegment(slug string) error {
 	tx := repo.db.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
 		Where("slug = ?", slug).Delete(Segment{})
@@ -52,6 +124,34 @@ func (repo *segmentRepo) DeleteSegment(slug string) error {
 	return nil
 }
 
+// ArchiveSegment hides the segment and drops its memberships; the row and the slug are kept.
+func (repo *segmentRepo) ArchiveSegment(segmentID uint64, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := repo.deleteMemberships(tx, change, models.OperationDel, "segment_id = ?", segmentID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+			Where("segment_id = ?", segmentID).Update("archived_at", time.Now()).Error
+	})
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
+func (repo *segmentRepo) RestoreSegment(segmentID uint64) error {
+	tx := repo.db.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+		Where("segment_id = ?", segmentID).Update("archived_at", nil)
+	if err := tx.Error; err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
 func (repo *segmentRepo) SelectSegmentBySlug(slug string) (*models.Segment, error) {
 	var dbSegment Segment
 
@@ -68,13 +168,155 @@ func (repo *segmentRepo) SelectSegmentBySlug(slug string) (*models.Segment, erro
 	return dbSegment.ToSegmentModel(), nil
 }
 
-func (repo *segmentRepo) SelectSegmentsByUser(userID uint64) ([]models.Segment, error) {
+// SelectSegmentsBySlugs returns the segments found by the slugs, a missing slug is not an error.
+func (repo *segmentRepo) SelectSegmentsBySlugs(slugs []string) ([]models.Segment, error) {
 	var dbSegments []Segment
+
+	tx := repo.db.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+		Where("slug IN ?", slugs).Find(&dbSegments)
+	if err := tx.Error; err != nil {
+		return []models.Segment{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.Segment, len(dbSegments))
+	for idx, dbSegment := range dbSegments {
+		result[idx] = *dbSegment.ToSegmentModel()
+	}
+
+	return result, nil
+}
+
+func (repo *segmentRepo) SelectSegmentsByUser(userID uint64) ([]models.UserSegment, error) {
+	var dbSegments []UserSegment
+	SegmentsTablename := Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)
+	U2STableName := Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)
+
+	tx := repo.db.Table(SegmentsTablename).Select(SegmentsTablename+".*, "+U2STableName+".source, "+U2STableName+
+		".variant, "+U2STableName+".until").Joins("JOIN "+U2STableName+" using(segment_id)").
+		Where("user_id = ? AND (until IS NULL OR until > current_timestamp)", userID).Find(&dbSegments)
+	if err := tx.Error; err != nil {
+		return []models.UserSegment{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.UserSegment, len(dbSegments))
+	for idx, dbSegment := range dbSegments {
+		result[idx] = *dbSegment.ToUserSegmentModel()
+	}
+
+	return result, nil
+}
+
+// SelectSegmentsByUsers returns the stored unexpired segments of the users in one query, grouped by user ID.
+func (repo *segmentRepo) SelectSegmentsByUsers(userIDs []uint64) (map[uint64][]models.UserSegment, error) {
+	var dbSegments []MemberSegment
 	SegmentsTablename := Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)
 	U2STableName := Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)
 
-	tx := repo.db.Table(SegmentsTablename).Select(SegmentsTablename+".*").Joins("JOIN "+U2STableName+
-		" using(segment_id)").Where("user_id = ?", userID).Find(&dbSegments)
+	tx := repo.db.Table(SegmentsTablename).Select(SegmentsTablename+".*, "+U2STableName+".user_id, "+U2STableName+
+		".source, "+U2STableName+".variant, "+U2STableName+".until").Joins("JOIN "+U2STableName+" using(segment_id)").
+		Where("user_id IN ? AND (until IS NULL OR until > current_timestamp)", userIDs).Find(&dbSegments)
+	if err := tx.Error; err != nil {
+		return nil, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make(map[uint64][]models.UserSegment)
+	for _, dbSegment := range dbSegments {
+		result[dbSegment.UserID] = append(result[dbSegment.UserID], *dbSegment.ToUserSegmentModel())
+	}
+
+	return result, nil
+}
+
+// SelectSegmentSummaries returns all segments, archived included, ordered by slug with the number of members
+// whose membership has not expired.
+func (repo *segmentRepo) SelectSegmentSummaries() ([]models.SegmentSummary, error) {
+	var dbSegments []SegmentSummary
+	SegmentsTablename := Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)
+	U2STableName := Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)
+
+	tx := repo.db.Table(SegmentsTablename).Select(SegmentsTablename + ".*, count(" + U2STableName + ".user_id) AS members").
+		Joins("LEFT JOIN " + U2STableName + " ON " + U2STableName + ".segment_id = " + SegmentsTablename + ".segment_id AND (" +
+			U2STableName + ".until IS NULL OR " + U2STableName + ".until > current_timestamp)").
+		Group(SegmentsTablename + ".segment_id").Order("slug").Find(&dbSegments)
+	if err := tx.Error; err != nil {
+		return []models.SegmentSummary{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.SegmentSummary, len(dbSegments))
+	for idx, dbSegment := range dbSegments {
+		result[idx] = *dbSegment.ToSegmentSummaryModel()
+	}
+
+	return result, nil
+}
+
+func (repo *segmentRepo) SelectSegmentUsers(segmentID uint64, filter models.SegmentUsersFilter) ([]models.SegmentUser, error) {
+	var dbUsers []SegmentUser
+
+	tx := repo.segmentUsers(segmentID, filter).Select("user_id, source, variant, until, added_at").
+		Where("user_id > ?", filter.AfterUserID).Order("user_id").Limit(filter.Limit).Find(&dbUsers)
+	if err := tx.Error; err != nil {
+		return []models.SegmentUser{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.SegmentUser, len(dbUsers))
+	for idx, dbUser := range dbUsers {
+		result[idx] = *dbUser.ToSegmentUserModel()
+	}
+
+	return result, nil
+}
+
+func (repo *segmentRepo) CountSegmentUsers(segmentID uint64, filter models.SegmentUsersFilter) (int64, error) {
+	var count int64
+
+	tx := repo.segmentUsers(segmentID, filter).Count(&count)
+	if err := tx.Error; err != nil {
+		return 0, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return count, nil
+}
+
+// segmentUsers selects the memberships of the segment that have not expired and match the filter.
+func (repo *segmentRepo) segmentUsers(segmentID uint64, filter models.SegmentUsersFilter) *gorm.DB {
+	tx := repo.db.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
+		Where("segment_id = ? AND (until IS NULL OR until > current_timestamp)", segmentID)
+	if filter.Source != "" {
+		tx = tx.Where("source = ?", filter.Source)
+	}
+	if filter.ExpiringBefore != nil {
+		tx = tx.Where("until < ?", *filter.ExpiringBefore)
+	}
+	if filter.AddedAfter != nil {
+		tx = tx.Where("added_at > ?", *filter.AddedAfter)
+	}
+
+	return tx
+}
+
+func (repo *segmentRepo) SelectDynamicSegments() ([]models.Segment, error) {
+	var dbSegments []Segment
+
+	tx := repo.db.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+		Where("archived_at IS NULL AND (percent IS NOT NULL OR rule IS NOT NULL)").Find(&dbSegments)
+	if err := tx.Error; err != nil {
+		return []models.Segment{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.Segment, len(dbSegments))
+	for idx, dbSegment := range dbSegments {
+		result[idx] = *dbSegment.ToSegmentModel()
+	}
+
+	return result, nil
+}
+
+func (repo *segmentRepo) SelectSegmentsByLayer(layerID uint64) ([]models.Segment, error) {
+	var dbSegments []Segment
+
+	tx := repo.db.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+		Where("layer_id = ? AND archived_at IS NULL", layerID).Order("layer_offset").Find(&dbSegments)
 	if err := tx.Error; err != nil {
 		return []models.Segment{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
@@ -87,52 +329,482 @@ func (repo *segmentRepo) SelectSegmentsByUser(userID uint64) ([]models.Segment,
 	return result, nil
 }
 
-func (repo *segmentRepo) InsertSegmentsToUser(userID uint64, segments []models.AddUserToSegment) error {
+// InsertSegmentsToUser adds the memberships and logs ADD for those the user did not have;
+// for existing ones until and source are updated, which is logged as EXTEND unless both old and new until are empty.
+func (repo *segmentRepo) InsertSegmentsToUser(userID uint64, segments []models.AddUserToSegment, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return repo.insertSegmentsToUser(tx, userID, segments, change)
+	})
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
+// UpdateUserSegments adds and removes the user's memberships in one transaction, so the edit is applied
+// either entirely or not at all.
+func (repo *segmentRepo) UpdateUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment,
+	segmentIDsToRemove []uint64, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if len(segmentsToAdd) != 0 {
+			err := repo.insertSegmentsToUser(tx, userID, segmentsToAdd, change)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(segmentIDsToRemove) != 0 {
+			return repo.deleteMemberships(tx, change, models.OperationDel, "user_id = ? AND segment_id IN ?", userID,
+				segmentIDsToRemove)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
+func (repo *segmentRepo) insertSegmentsToUser(tx *gorm.DB, userID uint64, segments []models.AddUserToSegment,
+	change models.Change) error {
+	segmentIDs := make([]uint64, len(segments))
 	dbU2S := make([]Users2Segments, len(segments))
 	for idx, segment := range segments {
+		segmentIDs[idx] = segment.SegmentID
 		dbU2S[idx].UserID = userID
 		dbU2S[idx].SegmentID = segment.SegmentID
 		dbU2S[idx].Until = segment.Until
+		dbU2S[idx].Source = segment.Source
+		dbU2S[idx].Variant = segment.Variant
 	}
 
-	tx := repo.db.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
-		Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "user_id"}, {Name: "segment_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"until"}),
-		}).Create(&dbU2S)
-	if err := tx.Error; err != nil {
+	U2STableName := Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)
+
+	var existingRows []Users2Segments
+	err := tx.Table(U2STableName).Where("user_id = ? AND segment_id IN ?", userID, segmentIDs).Find(&existingRows).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Table(U2STableName).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "segment_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"until", "source"}),
+	}).Create(&dbU2S).Error
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		repo.scheduleExpiry(segment.Until)
+	}
+
+	existing := make(map[uint64]Users2Segments, len(existingRows))
+	for _, row := range existingRows {
+		existing[row.SegmentID] = row
+	}
+
+	now := time.Now()
+	records := make([]models.HistoryRecord, 0, len(segments))
+	for _, segment := range segments {
+		operation := models.OperationAdd
+		if row, ok := existing[segment.SegmentID]; ok && row.expired(now) {
+			// the membership has already ended for readers, so it is added anew rather than prolonged
+			records = append(records, models.Change{Actor: models.ActorSystem}.Record(userID, segment.SegmentSlug,
+				models.OperationExpire, row.Source, row.Variant, now))
+		} else if ok {
+			if row.Until == nil && segment.Until == nil {
+				continue
+			}
+			operation = models.OperationExtend
+		}
+
+		records = append(records, change.Record(userID, segment.SegmentSlug, operation, segment.Source,
+			segment.Variant, now))
+	}
+
+	return repo.history(tx).InsertRecords(records)
+}
+
+func (repo *segmentRepo) DeleteSegmentsFromUser(userID uint64, segmentIDs []uint64, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return repo.deleteMemberships(tx, change, models.OperationDel, "user_id = ? AND segment_id IN ?", userID, segmentIDs)
+	})
+	if err != nil {
 		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
 
 	return nil
 }
 
-func (repo *segmentRepo) DeleteSegmentsFromUser(userID uint64, segmentIDs []uint64) error {
-	tx := repo.db.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).Where(
-		"user_id = ? AND segment_id IN ?", userID, segmentIDs).Delete(&Users2Segments{})
-	if err := tx.Error; err != nil {
+func (repo *segmentRepo) DeleteUserMemberships(userID uint64, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := repo.deleteMemberships(tx, models.Change{Actor: models.ActorSystem}, models.OperationExpire,
+			"user_id = ? AND until <= current_timestamp", userID)
+		if err != nil {
+			return err
+		}
+
+		return repo.deleteMemberships(tx, change, models.OperationDel, "user_id = ?", userID)
+	})
+	if err != nil {
 		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
 
 	return nil
 }
 
-func (repo *segmentRepo) InsertUsersToSegment(segmentID uint64, userIDs []uint64) error {
-	dbU2S := make([]Users2Segments, len(userIDs))
-	for idx, userID := range userIDs {
-		dbU2S[idx].UserID = userID
-		dbU2S[idx].SegmentID = segmentID
+// InsertUsersToSegment enrolls the members by percentage and logs ADD for those who were not in the segment yet.
+func (repo *segmentRepo) InsertUsersToSegment(segmentID uint64, members []models.SegmentMember, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		U2STableName := Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)
+
+		var existingIDs []uint64
+		err := tx.Table(U2STableName).Select("user_id").Where("segment_id = ?", segmentID).Find(&existingIDs).Error
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[uint64]struct{}, len(existingIDs))
+		for _, userID := range existingIDs {
+			existing[userID] = struct{}{}
+		}
+
+		dbU2S := make([]Users2Segments, 0, len(members))
+		for _, member := range members {
+			if _, ok := existing[member.UserID]; !ok {
+				dbU2S = append(dbU2S, Users2Segments{
+					UserID:    member.UserID,
+					SegmentID: segmentID,
+					Source:    models.SourcePercentage,
+					Variant:   member.Variant,
+				})
+			}
+		}
+		if len(dbU2S) == 0 {
+			return nil
+		}
+
+		err = tx.Table(U2STableName).Clauses(clause.OnConflict{DoNothing: true}).Create(&dbU2S).Error
+		if err != nil {
+			return err
+		}
+
+		return repo.insertMembershipRecords(tx, change, dbU2S, func(Users2Segments) string {
+			return models.OperationAdd
+		})
+	})
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
 
+	return nil
+}
+
+// AddUsersToSegment adds the members with the same until and source and logs ADD for those who were not
+// in the segment; for existing ones until and source are updated as InsertSegmentsToUser does.
+func (repo *segmentRepo) AddUsersToSegment(segmentID uint64, members []models.SegmentMember, until *string,
+	source string, change models.Change) error {
+	userIDs := make([]uint64, len(members))
+	dbU2S := make([]Users2Segments, len(members))
+	for idx, member := range members {
+		userIDs[idx] = member.UserID
+		dbU2S[idx] = Users2Segments{
+			UserID:    member.UserID,
+			SegmentID: segmentID,
+			Until:     until,
+			Source:    source,
+			Variant:   member.Variant,
+		}
+	}
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		U2STableName := Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)
+
+		var existingRows []Users2Segments
+		err := tx.Table(U2STableName).Where("segment_id = ? AND user_id IN ?", segmentID, userIDs).
+			Find(&existingRows).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Table(U2STableName).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "segment_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"until", "source"}),
+		}).Create(&dbU2S).Error
+		if err != nil {
+			return err
+		}
+
+		repo.scheduleExpiry(until)
+
+		// memberships that have already ended for readers are added anew rather than prolonged
+		now := time.Now()
+		existing := make(map[uint64]Users2Segments, len(existingRows))
+		expired := make([]Users2Segments, 0)
+		for _, row := range existingRows {
+			if row.expired(now) {
+				expired = append(expired, row)
+				continue
+			}
+			existing[row.UserID] = row
+		}
+
+		if len(expired) != 0 {
+			err = repo.insertMembershipRecords(tx, models.Change{Actor: models.ActorSystem}, expired,
+				func(Users2Segments) string {
+					return models.OperationExpire
+				})
+			if err != nil {
+				return err
+			}
+		}
+
+		changed := make([]Users2Segments, 0, len(dbU2S))
+		for _, membership := range dbU2S {
+			if row, ok := existing[membership.UserID]; !ok || row.Until != nil || until != nil {
+				changed = append(changed, membership)
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+
+		return repo.insertMembershipRecords(tx, change, changed, func(membership Users2Segments) string {
+			if _, ok := existing[membership.UserID]; ok {
+				return models.OperationExtend
+			}
+			return models.OperationAdd
+		})
+	})
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
+
+func (repo *segmentRepo) SelectSegmentUserIDs(segmentID uint64, source string) ([]uint64, error) {
+	var IDs []uint64
+
 	tx := repo.db.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
-		Clauses(clause.OnConflict{DoNothing: true}).Create(&dbU2S)
+		Select("user_id").Where("segment_id = ? AND source = ?", segmentID, source).Find(&IDs)
 	if err := tx.Error; err != nil {
+		return IDs, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return IDs, nil
+}
+
+// SelectMemberIDs returns those of the users who have an unexpired membership in any of the segments.
+func (repo *segmentRepo) SelectMemberIDs(segmentIDs []uint64, userIDs []uint64) ([]uint64, error) {
+	var IDs []uint64
+
+	tx := repo.db.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
+		Distinct("user_id").Where("segment_id IN ? AND user_id IN ? AND (until IS NULL OR until > current_timestamp)",
+		segmentIDs, userIDs).Find(&IDs)
+	if err := tx.Error; err != nil {
+		return IDs, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return IDs, nil
+}
+
+func (repo *segmentRepo) DeleteUsersFromSegment(segmentID uint64, userIDs []uint64, change models.Change) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return repo.deleteMemberships(tx, change, models.OperationDel, "segment_id = ? AND user_id IN ?", segmentID, userIDs)
+	})
+	if err != nil {
 		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
 	}
 
 	return nil
 }
 
+// deleteMemberships removes the users2segments rows matching the condition and logs the operation for each of them.
+func (repo *segmentRepo) deleteMemberships(tx *gorm.DB, change models.Change, operation string, query string,
+	args ...any) error {
+	var deleted []Users2Segments
+	err := tx.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
+		Clauses(clause.Returning{}).Where(query, args...).Delete(&deleted).Error
+	if err != nil {
+		return err
+	}
+
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	return repo.insertMembershipRecords(tx, change, deleted, func(Users2Segments) string {
+		return operation
+	})
+}
+
+// insertMembershipRecords logs the operation returned by operation for every membership.
+func (repo *segmentRepo) insertMembershipRecords(tx *gorm.DB, change models.Change, memberships []Users2Segments,
+	operation func(Users2Segments) string) error {
+	segmentIDs := make([]uint64, 0)
+	seen := make(map[uint64]struct{})
+	for _, membership := range memberships {
+		if _, ok := seen[membership.SegmentID]; !ok {
+			seen[membership.SegmentID] = struct{}{}
+			segmentIDs = append(segmentIDs, membership.SegmentID)
+		}
+	}
+
+	slugs, err := repo.selectSlugs(tx, segmentIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	records := make([]models.HistoryRecord, len(memberships))
+	for idx, membership := range memberships {
+		records[idx] = change.Record(membership.UserID, slugs[membership.SegmentID], operation(membership),
+			membership.Source, membership.Variant, now)
+	}
+
+	return repo.history(tx).InsertRecords(records)
+}
+
+func (repo *segmentRepo) selectSlugs(tx *gorm.DB, segmentIDs []uint64) (map[uint64]string, error) {
+	var dbSegments []Segment
+	err := tx.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+		Select("segment_id", "slug").Where("segment_id IN ?", segmentIDs).Find(&dbSegments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	slugs := make(map[uint64]string, len(dbSegments))
+	for _, dbSegment := range dbSegments {
+		slugs[dbSegment.SegmentID] = dbSegment.Slug
+	}
+
+	return slugs, nil
+}
+
+// ScheduleExpirations expires overdue memberships and arms timers at the deadlines that come before the next poll,
+// so a membership is removed at its until rather than up to a poll interval later.
+func (repo *segmentRepo) ScheduleExpirations() {
+	repo.ClearExpiredConnections()
+
+	var deadlines []time.Time
+	now := time.Now()
+	err := repo.db.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
+		Where("until > ? AND until <= ?", now, now.Add(repo.pollInterval)).Distinct().Pluck("until", &deadlines).Error
+	if err != nil {
+		log.Error(pkgErrors.Wrap(err, "select upcoming deadlines"))
+		return
+	}
+
+	for _, deadline := range deadlines {
+		repo.expirations.Schedule(deadline)
+	}
+}
+
+// scheduleExpiry arms the timer at until when it comes before the next poll, the later deadlines are armed
+// by ScheduleExpirations.
+func (repo *segmentRepo) scheduleExpiry(until *string) {
+	if until == nil {
+		return
+	}
+
+	deadline, err := models.ParseUntil(*until)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	if deadline.After(now) && !deadline.After(now.Add(repo.pollInterval)) {
+		repo.expirations.Schedule(deadline)
+	}
+}
+
+// ClearExpiredConnections removes memberships whose until has passed and logs them as EXPIRE.
 func (repo *segmentRepo) ClearExpiredConnections() {
-	repo.db.Raw("SELECT delete_old_accesses()").Rows()
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return repo.deleteMemberships(tx, models.Change{Actor: models.ActorSystem}, models.OperationExpire,
+			"until <= current_timestamp")
+	})
+	if err != nil {
+		log.Error(pkgErrors.Wrap(err, "clear expired connections"))
+	}
+}
+
+// ScheduleActivations switches segments whose window was entered or left and arms timers at the window bounds
+// that come before the next poll, so ACTIVATE/DEACTIVATE is logged when the window actually opens or closes.
+func (repo *segmentRepo) ScheduleActivations() {
+	repo.SwitchSegmentsActivity()
+
+	now := time.Now()
+	for _, column := range []string{"starts_at", "ends_at"} {
+		var moments []time.Time
+		err := repo.db.Table(Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName)).
+			Where("archived_at IS NULL AND "+column+" > ? AND "+column+" <= ?", now, now.Add(repo.pollInterval)).
+			Distinct().Pluck(column, &moments).Error
+		if err != nil {
+			log.Error(pkgErrors.Wrap(err, "select upcoming window bounds"))
+			return
+		}
+
+		for _, moment := range moments {
+			repo.activations.Schedule(moment)
+		}
+	}
+}
+
+// SwitchSegmentsActivity logs ACTIVATE/DEACTIVATE history for segments whose schedule window was entered or left.
+// Only stored memberships are logged, members evaluated on read by a rule get no records.
+func (repo *segmentRepo) SwitchSegmentsActivity() {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return repo.switchActivity(tx)
+	})
+	if err != nil {
+		log.Error(pkgErrors.Wrap(err, "switch segments activity"))
+	}
+}
+
+// switchActivity flips active of the segments, all of them when none are given, whose window was entered or left
+// and logs it for their stored memberships.
+func (repo *segmentRepo) switchActivity(tx *gorm.DB, segmentIDs ...uint64) error {
+	query := `UPDATE ` + Segment{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBSegmentTableName) +
+		` SET active = NOT active WHERE archived_at IS NULL AND active <> (
+			(starts_at IS NULL OR starts_at <= current_timestamp) AND (ends_at IS NULL OR ends_at > current_timestamp)
+		)`
+	args := make([]interface{}, 0, 1)
+	if len(segmentIDs) != 0 {
+		query += ` AND segment_id IN ?`
+		args = append(args, segmentIDs)
+	}
+
+	var switched []Segment
+	err := tx.Raw(query+` RETURNING segment_id, active`, args...).Scan(&switched).Error
+	if err != nil || len(switched) == 0 {
+		return err
+	}
+
+	active := make(map[uint64]bool, len(switched))
+	switchedIDs := make([]uint64, len(switched))
+	for idx, dbSegment := range switched {
+		active[dbSegment.SegmentID] = dbSegment.Active
+		switchedIDs[idx] = dbSegment.SegmentID
+	}
+
+	var memberships []Users2Segments
+	err = tx.Table(Users2Segments{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBU2STableName)).
+		Where("segment_id IN ?", switchedIDs).Find(&memberships).Error
+	if err != nil || len(memberships) == 0 {
+		return err
+	}
+
+	return repo.insertMembershipRecords(tx, models.Change{Actor: models.ActorSystem}, memberships,
+		func(membership Users2Segments) string {
+			if active[membership.SegmentID] {
+				return models.OperationActivate
+			}
+
+			return models.OperationDeactivate
+		})
 }
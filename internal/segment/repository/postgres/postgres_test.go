@@ -2,17 +2,21 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/go-faker/faker/v4"
 	pkgErr "github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository/postgres"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"regexp"
 	"testing"
+	"time"
 )
 
 func createConfig() *config.Config {
@@ -20,6 +24,7 @@ func createConfig() *config.Config {
 	cfg.DB.DBSchemaName = "app"
 	cfg.DB.DBU2STableName = "users2segments"
 	cfg.DB.DBSegmentTableName = "segments"
+	cfg.DB.DBHistoryTableName = "history"
 
 	return cfg
 }
@@ -68,12 +73,14 @@ func TestRepository_InsertSegment(t *testing.T) {
 		AddRow(fakeSegment.SegmentID)
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."segments" ("slug","percent","segment_id")
-	VALUES ($1,$2,$3) RETURNING "segment_id"`)).WithArgs(fakeSegment.Slug, fakeSegment.Percent, fakeSegment.SegmentID).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."segments" ("slug","percent","salt","variants","layer_id","layer_offset","rule","starts_at","ends_at","default_ttl","active","archived_at","segment_id")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13) RETURNING "segment_id"`)).WithArgs(fakeSegment.Slug, fakeSegment.Percent,
+		fakeSegment.Salt, sqlmock.AnyArg(), fakeSegment.LayerID, fakeSegment.LayerOffset, fakeSegment.Rule, fakeSegment.StartsAt,
+		fakeSegment.EndsAt, fakeSegment.DefaultTTL, fakeSegment.IsActive(time.Now()), fakeSegment.ArchivedAt, fakeSegment.SegmentID).
 		WillReturnRows(createUserRow)
 	mock.ExpectCommit()
 
-	segmentRep, err := New(cfg, gormDB)
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
 	segmentID, err := segmentRep.InsertSegment(fakeSegment)
 	causeErr := pkgErr.Cause(err)
 
@@ -84,6 +91,86 @@ func TestRepository_InsertSegment(t *testing.T) {
 	}
 }
 
+func TestRepository_UpdateSegment(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeSegment *models.Segment
+	generateFakeData(&fakeSegment)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."segments" SET "slug"=$1,"percent"=$2,"salt"=$3,"variants"=$4,"layer_id"=$5,"layer_offset"=$6,"rule"=$7,"starts_at"=$8,"ends_at"=$9,"default_ttl"=$10 WHERE "segment_id" = $11`)).
+		WithArgs(fakeSegment.Slug, fakeSegment.Percent, fakeSegment.Salt, sqlmock.AnyArg(), fakeSegment.LayerID,
+			fakeSegment.LayerOffset, fakeSegment.Rule, fakeSegment.StartsAt, fakeSegment.EndsAt, fakeSegment.DefaultTTL,
+			fakeSegment.SegmentID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(switchActivityQuery + ` AND segment_id IN ($1) RETURNING segment_id, active`)).
+		WithArgs(fakeSegment.SegmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "active"}))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.UpdateSegment(fakeSegment)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+const switchActivityQuery = `UPDATE app.segments SET active = NOT active WHERE archived_at IS NULL AND active <> (
+			(starts_at IS NULL OR starts_at <= current_timestamp) AND (ends_at IS NULL OR ends_at > current_timestamp)
+		)`
+
+func TestRepository_UpdateSegmentActivates(t *testing.T) {
+	cfg := createConfig()
+
+	startsAt := time.Now().Add(-time.Minute)
+	segment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "test",
+		Salt:      "test",
+		StartsAt:  &startsAt,
+	}
+	userID := uint64(2)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."segments" SET`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(switchActivityQuery + ` AND segment_id IN ($1) RETURNING segment_id, active`)).
+		WithArgs(segment.SegmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "active"}).
+		AddRow(segment.SegmentID, true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segment.SegmentID).WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "source"}).
+		AddRow(userID, segment.SegmentID, models.SourceManual))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segment.SegmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).
+		AddRow(segment.SegmentID, segment.Slug))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WithArgs(userID, segment.Slug, models.OperationActivate, models.SourceManual, "", models.ActorSystem, "", "",
+			sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.UpdateSegment(segment)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
 func TestRepository_DeleteSegment(t *testing.T) {
 	cfg := createConfig()
 
@@ -100,7 +187,7 @@ func TestRepository_DeleteSegment(t *testing.T) {
 		WithArgs(segmentSlug).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	segmentRep, err := New(cfg, gormDB)
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
 	err = segmentRep.DeleteSegment(segmentSlug)
 	causeErr := pkgErr.Cause(err)
 
@@ -114,6 +201,11 @@ func TestRepository_SelectUserByID(t *testing.T) {
 
 	var fakeSegment *models.Segment
 	generateFakeData(&fakeSegment)
+	startsAt := time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC)
+	endsAt := startsAt.AddDate(0, 1, 0)
+	fakeSegment.StartsAt = &startsAt
+	fakeSegment.EndsAt = &endsAt
+	fakeSegment.ArchivedAt = nil
 
 	db, gormDB, mock, err := mockDB()
 	if err != nil {
@@ -121,12 +213,20 @@ func TestRepository_SelectUserByID(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"segment_id", "slug", "percent"}).
-		AddRow(fakeSegment.SegmentID, fakeSegment.Slug, fakeSegment.Percent)
+	variants, err := json.Marshal(fakeSegment.Variants)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "percent", "salt", "variants", "layer_id", "layer_offset", "rule",
+		"starts_at", "ends_at", "default_ttl"}).
+		AddRow(fakeSegment.SegmentID, fakeSegment.Slug, fakeSegment.Percent, fakeSegment.Salt, variants,
+			fakeSegment.LayerID, fakeSegment.LayerOffset, fakeSegment.Rule, fakeSegment.StartsAt, fakeSegment.EndsAt,
+			fakeSegment.DefaultTTL)
 
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."segments" WHERE slug = $1`)).WithArgs(fakeSegment.Slug).WillReturnRows(rows)
 
-	segmentRep, err := New(cfg, gormDB)
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
 	response, err := segmentRep.SelectSegmentBySlug(fakeSegment.Slug)
 	causeErr := pkgErr.Cause(err)
 
@@ -141,10 +241,54 @@ func TestRepository_SelectSegmentsByUser(t *testing.T) {
 	cfg := createConfig()
 
 	userID := uint64(1)
+	until := time.Date(2023, time.September, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	untilUTC := "2023-09-01T09:00:00Z"
+	fakeSegment := []models.UserSegment{
+		{
+			Segment: models.Segment{
+				SegmentID: 1,
+				Slug:      "test",
+				Salt:      "test",
+			},
+			Source: models.SourceManual,
+			Until:  &untilUTC,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "percent", "salt", "source", "variant", "until"}).
+		AddRow(fakeSegment[0].SegmentID, fakeSegment[0].Slug, fakeSegment[0].Percent, fakeSegment[0].Salt,
+			fakeSegment[0].Source, fakeSegment[0].Variant, until)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT app.segments.*, app.users2segments.source, app.users2segments.variant, app.users2segments.until FROM "app"."segments" JOIN app.users2segments using(segment_id) WHERE user_id = $1 AND (until IS NULL OR until > current_timestamp)`)).
+		WithArgs(userID).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentsByUser(userID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeSegment, response)
+	}
+}
+
+func TestRepository_SelectDynamicSegments(t *testing.T) {
+	cfg := createConfig()
+
+	percent := 10
 	fakeSegment := []models.Segment{
 		{
 			SegmentID: 1,
 			Slug:      "test",
+			Percent:   &percent,
+			Salt:      "test",
 		},
 	}
 
@@ -154,14 +298,53 @@ func TestRepository_SelectSegmentsByUser(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"segment_id", "slug", "percent"}).
-		AddRow(fakeSegment[0].SegmentID, fakeSegment[0].Slug, fakeSegment[0].Percent)
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "percent", "salt"}).
+		AddRow(fakeSegment[0].SegmentID, fakeSegment[0].Slug, fakeSegment[0].Percent, fakeSegment[0].Salt)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT app.segments.* FROM "app"."segments" JOIN app.users2segments using(segment_id) WHERE user_id = $1`)).
-		WithArgs(userID).WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."segments" WHERE archived_at IS NULL AND (percent IS NOT NULL OR rule IS NOT NULL)`)).WillReturnRows(rows)
 
-	segmentRep, err := New(cfg, gormDB)
-	response, err := segmentRep.SelectSegmentsByUser(userID)
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectDynamicSegments()
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeSegment, response)
+	}
+}
+
+func TestRepository_SelectSegmentsByLayer(t *testing.T) {
+	cfg := createConfig()
+
+	layerID := uint64(1)
+	percent := 10
+	fakeSegment := []models.Segment{
+		{
+			SegmentID:   1,
+			Slug:        "test",
+			Percent:     &percent,
+			Salt:        "layer",
+			LayerID:     &layerID,
+			LayerOffset: 20,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "percent", "salt", "layer_id", "layer_offset"}).
+		AddRow(fakeSegment[0].SegmentID, fakeSegment[0].Slug, fakeSegment[0].Percent, fakeSegment[0].Salt,
+			fakeSegment[0].LayerID, fakeSegment[0].LayerOffset)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."segments" WHERE layer_id = $1 AND archived_at IS NULL ORDER BY layer_offset`)).
+		WithArgs(layerID).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentsByLayer(layerID)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -173,12 +356,104 @@ func TestRepository_SelectSegmentsByUser(t *testing.T) {
 
 func TestRepository_InsertSegmentsToUser(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	userID := uint64(1)
+	segments := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			SegmentID:   1,
+			Source:      models.SourceManual,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
+		WithArgs(userID, segments[0].SegmentID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until","source","variant")
+	VALUES ($1,$2,$3,$4,$5) ON CONFLICT ("user_id","segment_id") DO UPDATE SET "until"="excluded"."until","source"="excluded"."source"`)).
+		WithArgs(userID, segments[0].SegmentID, segments[0].Until, segments[0].Source, segments[0].Variant).WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, segments[0].SegmentSlug, models.OperationAdd, segments[0].Source, segments[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.InsertSegmentsToUser(userID, segments, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_InsertSegmentsToUserExtend(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	userID := uint64(1)
+	oldUntil, newUntil := "2099-08-31 10:00", "2099-09-30 10:00"
+	segments := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			SegmentID:   1,
+			Until:       &newUntil,
+			Source:      models.SourceManual,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
+		WithArgs(userID, segments[0].SegmentID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, segments[0].SegmentID, oldUntil, models.SourceManual, ""))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until","source","variant")
+	VALUES ($1,$2,$3,$4,$5) ON CONFLICT ("user_id","segment_id") DO UPDATE SET "until"="excluded"."until","source"="excluded"."source"`)).
+		WithArgs(userID, segments[0].SegmentID, newUntil, segments[0].Source, segments[0].Variant).
+		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, segments[0].SegmentSlug, models.OperationExtend, segments[0].Source, segments[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.InsertSegmentsToUser(userID, segments, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_InsertSegmentsToUserAfterExpiry(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
 
 	userID := uint64(1)
+	oldUntil, newUntil := "2023-08-31T10:00:00Z", "2099-09-30T10:00:00Z"
 	segments := []models.AddUserToSegment{
 		{
 			SegmentSlug: "test",
 			SegmentID:   1,
+			Until:       &newUntil,
+			Source:      models.SourceManual,
 		},
 	}
 
@@ -189,22 +464,36 @@ func TestRepository_InsertSegmentsToUser(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until")
-	VALUES ($1,$2,$3) ON CONFLICT ("user_id","segment_id") DO UPDATE SET "until"="excluded"."until"`)).
-		WithArgs(userID, segments[0].SegmentID, segments[0].Until).WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
+		WithArgs(userID, segments[0].SegmentID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, segments[0].SegmentID, oldUntil, models.SourceImport, ""))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments"`)).
+		WithArgs(userID, segments[0].SegmentID, newUntil, segments[0].Source, segments[0].Variant).
+		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9),($10,$11,$12,$13,$14,$15,$16,$17,$18) RETURNING "record_id"`)).
+		WithArgs(userID, segments[0].SegmentSlug, models.OperationExpire, models.SourceImport, "",
+			models.ActorSystem, "", "", sqlmock.AnyArg(),
+			userID, segments[0].SegmentSlug, models.OperationAdd, segments[0].Source, segments[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1).AddRow(2))
 	mock.ExpectCommit()
 
-	segmentRep, err := New(cfg, gormDB)
-	err = segmentRep.InsertSegmentsToUser(userID, segments)
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.InsertSegmentsToUser(userID, segments, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
 		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.NoError(t, mock.ExpectationsWereMet())
 	}
 }
 
 func TestRepository_DeleteSegmentsFromUser(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
 
 	userID := uint64(1)
 	segmentIDs := uint64(1)
@@ -216,12 +505,21 @@ func TestRepository_DeleteSegmentsFromUser(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
-		WithArgs(userID, segmentIDs).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2) RETURNING *`)).
+		WithArgs(userID, segmentIDs).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, segmentIDs, nil, models.SourceManual, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentIDs).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentIDs, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, "test", models.OperationDel, models.SourceManual, "", change.Actor, change.Reason,
+			change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	segmentRep, err := New(cfg, gormDB)
-	err = segmentRep.DeleteSegmentsFromUser(userID, []uint64{segmentIDs})
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.DeleteSegmentsFromUser(userID, []uint64{segmentIDs}, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -229,11 +527,122 @@ func TestRepository_DeleteSegmentsFromUser(t *testing.T) {
 	}
 }
 
-func TestRepository_InsertUsersToSegment(t *testing.T) {
+func TestRepository_DeleteUserMemberships(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
 
 	userID := uint64(1)
+	expiredID, activeID := uint64(1), uint64(2)
+	until := time.Now().Add(-time.Minute)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE user_id = $1 AND until <= current_timestamp RETURNING *`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, expiredID, until, models.SourceManual, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(expiredID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(expiredID, "expired"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WithArgs(userID, "expired", models.OperationExpire, models.SourceManual, "", models.ActorSystem, "", "",
+			sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE user_id = $1 RETURNING *`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, activeID, nil, models.SourceManual, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(activeID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(activeID, "active"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WithArgs(userID, "active", models.OperationDel, models.SourceManual, "", change.Actor, change.Reason,
+			change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.DeleteUserMemberships(userID, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestRepository_ArchiveSegment(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	segmentID := uint64(1)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE segment_id = $1 RETURNING *`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."segments" SET "archived_at"=$1 WHERE segment_id = $2`)).
+		WithArgs(sqlmock.AnyArg(), segmentID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.ArchiveSegment(segmentID, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_RestoreSegment(t *testing.T) {
+	cfg := createConfig()
+
+	segmentID := uint64(1)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."segments" SET "archived_at"=$1 WHERE segment_id = $2`)).
+		WithArgs(nil, segmentID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.RestoreSegment(segmentID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_InsertUsersToSegment(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
 	segmentID := uint64(1)
+	members := []models.SegmentMember{
+		{
+			UserID:  1,
+			Variant: "A",
+		},
+		{
+			UserID:  2,
+			Variant: "B",
+		},
+	}
 
 	db, gormDB, mock, err := mockDB()
 	if err != nil {
@@ -242,16 +651,676 @@ func TestRepository_InsertUsersToSegment(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until")
-	VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`)).WithArgs(userID, segmentID, nil).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id FROM "app"."users2segments" WHERE segment_id = $1`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(members[1].UserID))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until","source","variant")
+	VALUES ($1,$2,$3,$4,$5) ON CONFLICT DO NOTHING`)).
+		WithArgs(members[0].UserID, segmentID, nil, models.SourcePercentage, members[0].Variant).
 		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentID, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(members[0].UserID, "test", models.OperationAdd, models.SourcePercentage, members[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	segmentRep, err := New(cfg, gormDB)
-	err = segmentRep.InsertUsersToSegment(segmentID, []uint64{userID})
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.InsertUsersToSegment(segmentID, members, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_SelectSegmentUserIDs(t *testing.T) {
+	cfg := createConfig()
+
+	segmentID := uint64(1)
+	fakeUserIDs := []uint64{1}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id"}).AddRow(1)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id FROM "app"."users2segments" WHERE segment_id = $1 AND source = $2`)).
+		WithArgs(segmentID, models.SourcePercentage).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentUserIDs(segmentID, models.SourcePercentage)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
 		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUserIDs, response)
+	}
+}
+
+func TestRepository_DeleteUsersFromSegment(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	userID := uint64(1)
+	segmentID := uint64(1)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE segment_id = $1 AND user_id IN ($2) RETURNING *`)).
+		WithArgs(segmentID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, segmentID, nil, models.SourcePercentage, "A"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentID, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, "test", models.OperationDel, models.SourcePercentage, "A", change.Actor, change.Reason,
+			change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.DeleteUsersFromSegment(segmentID, []uint64{userID}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_ClearExpiredConnections(t *testing.T) {
+	cfg := createConfig()
+
+	userID := uint64(1)
+	segmentID := uint64(1)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE until <= current_timestamp RETURNING *`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, segmentID, "2023-08-31 10:00", models.SourceManual, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentID, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, "test", models.OperationExpire, models.SourceManual, "", models.ActorSystem, "", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	segmentRep.(*segmentRepo).ClearExpiredConnections()
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, err)
+	}
+}
+
+func TestRepository_ScheduleExpirations(t *testing.T) {
+	cfg := createConfig()
+	cfg.Expiry.PollInterval = time.Minute
+
+	deadline := time.Now().Add(time.Hour)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE until <= current_timestamp RETURNING *`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT "until" FROM "app"."users2segments" WHERE until > $1 AND until <= $2`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"until"}).AddRow(deadline))
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	segmentRep.(*segmentRepo).ScheduleExpirations()
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, err)
+	}
+	if pending := segmentRep.(*segmentRepo).expirations.Pending(); pending != 1 {
+		t.Errorf("[TEST] simple: expected %d scheduled expirations, got %d", 1, pending)
+	}
+}
+
+func TestRepository_InsertSegmentsToUserSchedulesExpiry(t *testing.T) {
+	cfg := createConfig()
+	cfg.Expiry.PollInterval = time.Minute
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	userID := uint64(1)
+	until := models.FormatUntil(time.Now().Add(30 * time.Second))
+	segments := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			SegmentID:   1,
+			Until:       &until,
+			Source:      models.SourceManual,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
+		WithArgs(userID, segments[0].SegmentID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments"`)).
+		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.InsertSegmentsToUser(userID, segments, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+	if pending := segmentRep.(*segmentRepo).expirations.Pending(); pending != 1 {
+		t.Errorf("[TEST] simple: expected %d scheduled expirations, got %d", 1, pending)
+	}
+}
+
+func TestRepository_ScheduleActivations(t *testing.T) {
+	cfg := createConfig()
+	cfg.Expiry.PollInterval = time.Minute
+
+	startsAt := time.Now().Add(30 * time.Second)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(switchActivityQuery + ` RETURNING segment_id, active`)).
+		WillReturnRows(sqlmock.NewRows([]string{"segment_id", "active"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT "starts_at" FROM "app"."segments" WHERE archived_at IS NULL AND starts_at > $1 AND starts_at <= $2`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"starts_at"}).AddRow(startsAt))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT "ends_at" FROM "app"."segments" WHERE archived_at IS NULL AND ends_at > $1 AND ends_at <= $2`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"ends_at"}))
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	segmentRep.(*segmentRepo).ScheduleActivations()
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, err)
+	}
+	if pending := segmentRep.(*segmentRepo).activations.Pending(); pending != 1 {
+		t.Errorf("[TEST] simple: expected %d scheduled activations, got %d", 1, pending)
+	}
+}
+
+func TestRepository_SelectSegmentSummaries(t *testing.T) {
+	cfg := createConfig()
+
+	members := int64(2)
+	fakeSegments := []models.SegmentSummary{
+		{
+			Segment: models.Segment{
+				SegmentID: 1,
+				Slug:      "test",
+				Salt:      "test",
+			},
+			Members: &members,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "salt", "members"}).
+		AddRow(fakeSegments[0].SegmentID, fakeSegments[0].Slug, fakeSegments[0].Salt, members)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT app.segments.*, count(app.users2segments.user_id) AS members FROM "app"."segments" LEFT JOIN app.users2segments ON app.users2segments.segment_id = app.segments.segment_id AND (app.users2segments.until IS NULL OR app.users2segments.until > current_timestamp) GROUP BY "app"."segments"."segment_id" ORDER BY slug`)).
+		WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentSummaries()
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeSegments, response)
+	}
+}
+
+func TestRepository_SelectSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+
+	segmentID := uint64(1)
+	addedAfter := time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC)
+	addedAt := time.Date(2023, time.August, 15, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	until := time.Date(2023, time.September, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	untilUTC := "2023-09-01T09:00:00Z"
+	filter := models.SegmentUsersFilter{
+		Source:      models.SourceManual,
+		AddedAfter:  &addedAfter,
+		AfterUserID: 10,
+		Limit:       3,
+	}
+	fakeUsers := []models.SegmentUser{
+		{
+			UserID:  11,
+			Source:  models.SourceManual,
+			Until:   &untilUTC,
+			AddedAt: addedAt.UTC(),
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id", "source", "variant", "until", "added_at"}).
+		AddRow(fakeUsers[0].UserID, fakeUsers[0].Source, fakeUsers[0].Variant, until, addedAt)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, source, variant, until, added_at FROM "app"."users2segments" WHERE (segment_id = $1 AND (until IS NULL OR until > current_timestamp)) AND source = $2 AND added_at > $3 AND user_id > $4 ORDER BY user_id LIMIT 3`)).
+		WithArgs(segmentID, models.SourceManual, addedAfter, filter.AfterUserID).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentUsers(segmentID, filter)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUsers, response)
+	}
+}
+
+func TestRepository_CountSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+
+	segmentID := uint64(1)
+	expiringBefore := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	filter := models.SegmentUsersFilter{
+		ExpiringBefore: &expiringBefore,
+		AfterUserID:    10,
+		Limit:          3,
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"count"}).AddRow(42)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "app"."users2segments" WHERE (segment_id = $1 AND (until IS NULL OR until > current_timestamp)) AND until < $2`)).
+		WithArgs(segmentID, expiringBefore).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.CountSegmentUsers(segmentID, filter)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, int64(42), response)
+	}
+}
+
+func TestRepository_AddUsersToSegment(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	segmentID := uint64(1)
+	oldUntil, newUntil := "2099-08-31T10:00:00Z", "2099-09-30T10:00:00Z"
+	members := []models.SegmentMember{
+		{
+			UserID:  1,
+			Variant: "A",
+		},
+		{
+			UserID:  2,
+			Variant: "B",
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE segment_id = $1 AND user_id IN ($2,$3)`)).
+		WithArgs(segmentID, members[0].UserID, members[1].UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(members[1].UserID, segmentID, oldUntil, models.SourceManual, members[1].Variant))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until","source","variant")
+	VALUES ($1,$2,$3,$4,$5),($6,$7,$8,$9,$10) ON CONFLICT ("user_id","segment_id") DO UPDATE SET "until"="excluded"."until","source"="excluded"."source"`)).
+		WithArgs(members[0].UserID, segmentID, newUntil, models.SourceImport, members[0].Variant,
+			members[1].UserID, segmentID, newUntil, models.SourceImport, members[1].Variant).
+		WillReturnResult(sqlmock.NewResult(int64(0), 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentID, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9),($10,$11,$12,$13,$14,$15,$16,$17,$18) RETURNING "record_id"`)).
+		WithArgs(members[0].UserID, "test", models.OperationAdd, models.SourceImport, members[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg(),
+			members[1].UserID, "test", models.OperationExtend, models.SourceImport, members[1].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.AddUsersToSegment(segmentID, members, &newUntil, models.SourceImport, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_AddUsersToSegmentAfterExpiry(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	segmentID := uint64(1)
+	oldUntil := "2023-08-31T10:00:00Z"
+	members := []models.SegmentMember{
+		{
+			UserID:  1,
+			Variant: "A",
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE segment_id = $1 AND user_id IN ($2)`)).
+		WithArgs(segmentID, members[0].UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(members[0].UserID, segmentID, oldUntil, models.SourceManual, members[0].Variant))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments"`)).
+		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentID, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WithArgs(members[0].UserID, "test", models.OperationExpire, models.SourceManual, members[0].Variant,
+			models.ActorSystem, "", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentID).WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentID, "test"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WithArgs(members[0].UserID, "test", models.OperationAdd, models.SourceImport, members[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.AddUsersToSegment(segmentID, members, nil, models.SourceImport, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestRepository_SelectMemberIDs(t *testing.T) {
+	cfg := createConfig()
+
+	segmentIDs := []uint64{2, 3}
+	userIDs := []uint64{1, 2}
+	fakeUserIDs := []uint64{2}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id"}).AddRow(2)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT user_id FROM "app"."users2segments" WHERE segment_id IN ($1,$2) AND user_id IN ($3,$4) AND (until IS NULL OR until > current_timestamp)`)).
+		WithArgs(segmentIDs[0], segmentIDs[1], userIDs[0], userIDs[1]).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectMemberIDs(segmentIDs, userIDs)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUserIDs, response)
+	}
+}
+
+func TestRepository_SelectSegmentsByUsers(t *testing.T) {
+	cfg := createConfig()
+
+	userIDs := []uint64{1, 2, 3}
+	fakeSegments := map[uint64][]models.UserSegment{
+		1: {
+			{
+				Segment: models.Segment{
+					SegmentID: 1,
+					Slug:      "first",
+					Salt:      "first",
+				},
+				Source: models.SourceManual,
+			},
+			{
+				Segment: models.Segment{
+					SegmentID: 2,
+					Slug:      "second",
+					Salt:      "second",
+				},
+				Source:  models.SourceImport,
+				Variant: "B",
+			},
+		},
+		3: {
+			{
+				Segment: models.Segment{
+					SegmentID: 1,
+					Slug:      "first",
+					Salt:      "first",
+				},
+				Source: models.SourceManual,
+			},
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "salt", "user_id", "source", "variant", "until"}).
+		AddRow(1, "first", "first", 1, models.SourceManual, "", nil).
+		AddRow(2, "second", "second", 1, models.SourceImport, "B", nil).
+		AddRow(1, "first", "first", 3, models.SourceManual, "", nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT app.segments.*, app.users2segments.user_id, app.users2segments.source, app.users2segments.variant, app.users2segments.until FROM "app"."segments" JOIN app.users2segments using(segment_id) WHERE user_id IN ($1,$2,$3) AND (until IS NULL OR until > current_timestamp)`)).
+		WithArgs(userIDs[0], userIDs[1], userIDs[2]).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentsByUsers(userIDs)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeSegments, response)
+	}
+}
+
+func TestRepository_SelectSegmentsBySlugs(t *testing.T) {
+	cfg := createConfig()
+
+	slugs := []string{"test", "missing"}
+	fakeSegments := []models.Segment{
+		{
+			SegmentID: 1,
+			Slug:      "test",
+			Salt:      "test",
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"segment_id", "slug", "salt"}).
+		AddRow(fakeSegments[0].SegmentID, fakeSegments[0].Slug, fakeSegments[0].Salt)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."segments" WHERE slug IN ($1,$2)`)).
+		WithArgs(slugs[0], slugs[1]).WillReturnRows(rows)
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	response, err := segmentRep.SelectSegmentsBySlugs(slugs)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeSegments, response)
+	}
+}
+
+func TestRepository_UpdateUserSegments(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	userID := uint64(1)
+	segmentIDToRemove := uint64(2)
+	segments := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			SegmentID:   1,
+			Source:      models.SourceManual,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
+		WithArgs(userID, segments[0].SegmentID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until","source","variant")
+	VALUES ($1,$2,$3,$4,$5) ON CONFLICT ("user_id","segment_id") DO UPDATE SET "until"="excluded"."until","source"="excluded"."source"`)).
+		WithArgs(userID, segments[0].SegmentID, segments[0].Until, segments[0].Source, segments[0].Variant).
+		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, segments[0].SegmentSlug, models.OperationAdd, segments[0].Source, segments[0].Variant,
+			change.Actor, change.Reason, change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2) RETURNING *`)).
+		WithArgs(userID, segmentIDToRemove).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}).
+			AddRow(userID, segmentIDToRemove, nil, models.SourceManual, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "segment_id","slug" FROM "app"."segments" WHERE segment_id IN ($1)`)).
+		WithArgs(segmentIDToRemove).
+		WillReturnRows(sqlmock.NewRows([]string{"segment_id", "slug"}).AddRow(segmentIDToRemove, "tmp"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history" ("user_id","segment_slug","operation","source","variant","actor","reason","request_id","datetime")
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "record_id"`)).
+		WithArgs(userID, "tmp", models.OperationDel, models.SourceManual, "", change.Actor, change.Reason,
+			change.RequestID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.UpdateUserSegments(userID, segments, []uint64{segmentIDToRemove}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
+func TestRepository_UpdateUserSegmentsRollback(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{Actor: "pm", RequestID: "request-1"}
+
+	userID := uint64(1)
+	segmentIDToRemove := uint64(2)
+	segments := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			SegmentID:   1,
+			Source:      models.SourceManual,
+		},
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2)`)).
+		WithArgs(userID, segments[0].SegmentID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "segment_id", "until", "source", "variant"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "app"."users2segments" ("user_id","segment_id","until","source","variant")
+	VALUES ($1,$2,$3,$4,$5) ON CONFLICT ("user_id","segment_id") DO UPDATE SET "until"="excluded"."until","source"="excluded"."source"`)).
+		WithArgs(userID, segments[0].SegmentID, segments[0].Until, segments[0].Source, segments[0].Variant).
+		WillReturnResult(sqlmock.NewResult(int64(0), 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."history"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "app"."users2segments" WHERE user_id = $1 AND segment_id IN ($2) RETURNING *`)).
+		WithArgs(userID, segmentIDToRemove).WillReturnError(fmt.Errorf("connection reset"))
+	mock.ExpectRollback()
+
+	segmentRep, err := New(cfg, gormDB, historyRepository.NewWriter(cfg))
+	err = segmentRep.UpdateUserSegments(userID, segments, []uint64{segmentIDToRemove}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrInternal {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrInternal, causeErr)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, err)
 	}
 }
@@ -6,10 +6,30 @@ import "github.com/vvinokurshin/AvitoInternship/internal/models"
 
 type RepositoryI interface {
 	InsertSegment(segment *models.Segment) (uint64, error)
+	UpdateSegment(segment *models.Segment) error
 	DeleteSegment(slug string) error
+	ArchiveSegment(segmentID uint64, change models.Change) error
+	RestoreSegment(segmentID uint64) error
 	SelectSegmentBySlug(slug string) (*models.Segment, error)
-	SelectSegmentsByUser(userID uint64) ([]models.Segment, error)
-	InsertSegmentsToUser(userID uint64, segments []models.AddUserToSegment) error
-	DeleteSegmentsFromUser(userID uint64, segmentIDs []uint64) error
-	InsertUsersToSegment(segmentID uint64, userIDs []uint64) error
+	SelectSegmentsBySlugs(slugs []string) ([]models.Segment, error)
+	SelectSegmentsByUser(userID uint64) ([]models.UserSegment, error)
+	SelectSegmentsByUsers(userIDs []uint64) (map[uint64][]models.UserSegment, error)
+	SelectSegmentSummaries() ([]models.SegmentSummary, error)
+	SelectSegmentUsers(segmentID uint64, filter models.SegmentUsersFilter) ([]models.SegmentUser, error)
+	CountSegmentUsers(segmentID uint64, filter models.SegmentUsersFilter) (int64, error)
+	SelectDynamicSegments() ([]models.Segment, error)
+	SelectSegmentsByLayer(layerID uint64) ([]models.Segment, error)
+	InsertSegmentsToUser(userID uint64, segments []models.AddUserToSegment, change models.Change) error
+	DeleteSegmentsFromUser(userID uint64, segmentIDs []uint64, change models.Change) error
+	// DeleteUserMemberships removes all memberships of the user: the ones whose until has passed are logged
+	// as EXPIRE, the others as DEL.
+	DeleteUserMemberships(userID uint64, change models.Change) error
+	UpdateUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentIDsToRemove []uint64,
+		change models.Change) error
+	InsertUsersToSegment(segmentID uint64, members []models.SegmentMember, change models.Change) error
+	AddUsersToSegment(segmentID uint64, members []models.SegmentMember, until *string, source string,
+		change models.Change) error
+	SelectSegmentUserIDs(segmentID uint64, source string) ([]uint64, error)
+	SelectMemberIDs(segmentIDs []uint64, userIDs []uint64) ([]uint64, error)
+	DeleteUsersFromSegment(segmentID uint64, userIDs []uint64, change models.Change) error
 }
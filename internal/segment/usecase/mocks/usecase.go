@@ -34,48 +34,63 @@ func (m *MockUseCaseI) EXPECT() *MockUseCaseIMockRecorder {
 	return m.recorder
 }
 
+// AddSegmentUsers mocks base method.
+func (m *MockUseCaseI) AddSegmentUsers(slug string, form models.FormSegmentUsersBulk, change models.Change) (*models.SegmentUsersBulkResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddSegmentUsers", slug, form, change)
+	ret0, _ := ret[0].(*models.SegmentUsersBulkResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddSegmentUsers indicates an expected call of AddSegmentUsers.
+func (mr *MockUseCaseIMockRecorder) AddSegmentUsers(slug, form, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSegmentUsers", reflect.TypeOf((*MockUseCaseI)(nil).AddSegmentUsers), slug, form, change)
+}
+
 // CreateSegment mocks base method.
-func (m *MockUseCaseI) CreateSegment(form models.FormSegment) (*models.Segment, error) {
+func (m *MockUseCaseI) CreateSegment(form models.FormSegment, change models.Change) (*models.Segment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateSegment", form)
+	ret := m.ctrl.Call(m, "CreateSegment", form, change)
 	ret0, _ := ret[0].(*models.Segment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateSegment indicates an expected call of CreateSegment.
-func (mr *MockUseCaseIMockRecorder) CreateSegment(form interface{}) *gomock.Call {
+func (mr *MockUseCaseIMockRecorder) CreateSegment(form, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSegment", reflect.TypeOf((*MockUseCaseI)(nil).CreateSegment), form)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSegment", reflect.TypeOf((*MockUseCaseI)(nil).CreateSegment), form, change)
 }
 
 // DeleteSegment mocks base method.
-func (m *MockUseCaseI) DeleteSegment(slug string) error {
+func (m *MockUseCaseI) DeleteSegment(slug string, change models.Change) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteSegment", slug)
+	ret := m.ctrl.Call(m, "DeleteSegment", slug, change)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteSegment indicates an expected call of DeleteSegment.
-func (mr *MockUseCaseIMockRecorder) DeleteSegment(slug interface{}) *gomock.Call {
+func (mr *MockUseCaseIMockRecorder) DeleteSegment(slug, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegment", reflect.TypeOf((*MockUseCaseI)(nil).DeleteSegment), slug)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegment", reflect.TypeOf((*MockUseCaseI)(nil).DeleteSegment), slug, change)
 }
 
 // EditUserSegments mocks base method.
-func (m *MockUseCaseI) EditUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string) ([]models.Segment, error) {
+func (m *MockUseCaseI) EditUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string, change models.Change) ([]models.UserSegment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EditUserSegments", userID, segmentsToAdd, segmentsToRemove)
-	ret0, _ := ret[0].([]models.Segment)
+	ret := m.ctrl.Call(m, "EditUserSegments", userID, segmentsToAdd, segmentsToRemove, change)
+	ret0, _ := ret[0].([]models.UserSegment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // EditUserSegments indicates an expected call of EditUserSegments.
-func (mr *MockUseCaseIMockRecorder) EditUserSegments(userID, segmentsToAdd, segmentsToRemove interface{}) *gomock.Call {
+func (mr *MockUseCaseIMockRecorder) EditUserSegments(userID, segmentsToAdd, segmentsToRemove, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditUserSegments", reflect.TypeOf((*MockUseCaseI)(nil).EditUserSegments), userID, segmentsToAdd, segmentsToRemove)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditUserSegments", reflect.TypeOf((*MockUseCaseI)(nil).EditUserSegments), userID, segmentsToAdd, segmentsToRemove, change)
 }
 
 // GetSegmentBySlug mocks base method.
@@ -93,11 +108,41 @@ func (mr *MockUseCaseIMockRecorder) GetSegmentBySlug(slug interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegmentBySlug", reflect.TypeOf((*MockUseCaseI)(nil).GetSegmentBySlug), slug)
 }
 
+// GetSegmentUsers mocks base method.
+func (m *MockUseCaseI) GetSegmentUsers(form models.FormSegmentUsers) (*models.SegmentUsersResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSegmentUsers", form)
+	ret0, _ := ret[0].(*models.SegmentUsersResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSegmentUsers indicates an expected call of GetSegmentUsers.
+func (mr *MockUseCaseIMockRecorder) GetSegmentUsers(form interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegmentUsers", reflect.TypeOf((*MockUseCaseI)(nil).GetSegmentUsers), form)
+}
+
+// GetSegments mocks base method.
+func (m *MockUseCaseI) GetSegments() ([]models.SegmentSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSegments")
+	ret0, _ := ret[0].([]models.SegmentSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSegments indicates an expected call of GetSegments.
+func (mr *MockUseCaseIMockRecorder) GetSegments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegments", reflect.TypeOf((*MockUseCaseI)(nil).GetSegments))
+}
+
 // GetUserSegments mocks base method.
-func (m *MockUseCaseI) GetUserSegments(userID uint64) ([]models.Segment, error) {
+func (m *MockUseCaseI) GetUserSegments(userID uint64) ([]models.UserSegment, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetUserSegments", userID)
-	ret0, _ := ret[0].([]models.Segment)
+	ret0, _ := ret[0].([]models.UserSegment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -107,3 +152,77 @@ func (mr *MockUseCaseIMockRecorder) GetUserSegments(userID interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSegments", reflect.TypeOf((*MockUseCaseI)(nil).GetUserSegments), userID)
 }
+
+// GetUsersSegments mocks base method.
+func (m *MockUseCaseI) GetUsersSegments(userIDs []uint64) (*models.UsersSegmentsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsersSegments", userIDs)
+	ret0, _ := ret[0].(*models.UsersSegmentsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsersSegments indicates an expected call of GetUsersSegments.
+func (mr *MockUseCaseIMockRecorder) GetUsersSegments(userIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsersSegments", reflect.TypeOf((*MockUseCaseI)(nil).GetUsersSegments), userIDs)
+}
+
+// PurgeSegment mocks base method.
+func (m *MockUseCaseI) PurgeSegment(slug, confirmation string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeSegment", slug, confirmation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeSegment indicates an expected call of PurgeSegment.
+func (mr *MockUseCaseIMockRecorder) PurgeSegment(slug, confirmation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeSegment", reflect.TypeOf((*MockUseCaseI)(nil).PurgeSegment), slug, confirmation)
+}
+
+// RemoveSegmentUsers mocks base method.
+func (m *MockUseCaseI) RemoveSegmentUsers(slug string, userIDs []uint64, change models.Change) (*models.SegmentUsersBulkResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveSegmentUsers", slug, userIDs, change)
+	ret0, _ := ret[0].(*models.SegmentUsersBulkResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveSegmentUsers indicates an expected call of RemoveSegmentUsers.
+func (mr *MockUseCaseIMockRecorder) RemoveSegmentUsers(slug, userIDs, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveSegmentUsers", reflect.TypeOf((*MockUseCaseI)(nil).RemoveSegmentUsers), slug, userIDs, change)
+}
+
+// RestoreSegment mocks base method.
+func (m *MockUseCaseI) RestoreSegment(slug string, change models.Change) (*models.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreSegment", slug, change)
+	ret0, _ := ret[0].(*models.Segment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreSegment indicates an expected call of RestoreSegment.
+func (mr *MockUseCaseIMockRecorder) RestoreSegment(slug, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreSegment", reflect.TypeOf((*MockUseCaseI)(nil).RestoreSegment), slug, change)
+}
+
+// UpdateSegment mocks base method.
+func (m *MockUseCaseI) UpdateSegment(slug string, form models.FormUpdateSegment, change models.Change) (*models.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSegment", slug, form, change)
+	ret0, _ := ret[0].(*models.Segment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSegment indicates an expected call of UpdateSegment.
+func (mr *MockUseCaseIMockRecorder) UpdateSegment(slug, form, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSegment", reflect.TypeOf((*MockUseCaseI)(nil).UpdateSegment), slug, form, change)
+}
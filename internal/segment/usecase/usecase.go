@@ -3,77 +3,377 @@ package usecase
 import (
 	pkgErr "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	layerRepository "github.com/vvinokurshin/AvitoInternship/internal/layer/repository"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
 	userRepository "github.com/vvinokurshin/AvitoInternship/internal/user/repository"
 	"github.com/vvinokurshin/AvitoInternship/pkg"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"strconv"
+	"time"
 )
 
 //go:generate mockgen -destination=./mocks/usecase.go -source=./usecase.go -package=mocks
 
 type UseCaseI interface {
-	CreateSegment(form models.FormSegment) (*models.Segment, error)
-	DeleteSegment(slug string) error
+	CreateSegment(form models.FormSegment, change models.Change) (*models.Segment, error)
+	UpdateSegment(slug string, form models.FormUpdateSegment, change models.Change) (*models.Segment, error)
+	DeleteSegment(slug string, change models.Change) error
+	RestoreSegment(slug string, change models.Change) (*models.Segment, error)
+	PurgeSegment(slug string, confirmation string) error
 	GetSegmentBySlug(slug string) (*models.Segment, error)
-	GetUserSegments(userID uint64) ([]models.Segment, error)
-	EditUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string) ([]models.Segment, error)
+	GetSegments() ([]models.SegmentSummary, error)
+	GetSegmentUsers(form models.FormSegmentUsers) (*models.SegmentUsersResponse, error)
+	AddSegmentUsers(slug string, form models.FormSegmentUsersBulk, change models.Change) (*models.SegmentUsersBulkResponse,
+		error)
+	RemoveSegmentUsers(slug string, userIDs []uint64, change models.Change) (*models.SegmentUsersBulkResponse, error)
+	GetUserSegments(userID uint64) ([]models.UserSegment, error)
+	GetUsersSegments(userIDs []uint64) (*models.UsersSegmentsResponse, error)
+	EditUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string,
+		change models.Change) ([]models.UserSegment, error)
 }
 
 type UseCase struct {
 	cfg         *config.Config
+	uow         transaction.UnitOfWorkI
 	segmentRepo segmentRepository.RepositoryI
 	userRepo    userRepository.RepositoryI
+	layerRepo   layerRepository.RepositoryI
 }
 
-func New(cfg *config.Config, segmentRepo segmentRepository.RepositoryI, userRepo userRepository.RepositoryI) UseCaseI {
+func New(cfg *config.Config, uow transaction.UnitOfWorkI, segmentRepo segmentRepository.RepositoryI,
+	userRepo userRepository.RepositoryI, layerRepo layerRepository.RepositoryI) UseCaseI {
 	return &UseCase{
 		cfg:         cfg,
+		uow:         uow,
 		segmentRepo: segmentRepo,
 		userRepo:    userRepo,
+		layerRepo:   layerRepo,
 	}
 }
 
-func (uc *UseCase) CreateSegment(form models.FormSegment) (*models.Segment, error) {
-	_, err := uc.segmentRepo.SelectSegmentBySlug(form.Slug)
+func (uc *UseCase) CreateSegment(form models.FormSegment, change models.Change) (*models.Segment, error) {
+	existing, err := uc.segmentRepo.SelectSegmentBySlug(form.Slug)
+	if err == nil && existing.ArchivedAt != nil {
+		return nil, errors.ErrSegmentArchived
+	}
 	if err != errors.ErrSegmentNotFound {
 		return nil, errors.ErrSegmentExists
 	}
 
 	segment := &models.Segment{
-		Slug:    form.Slug,
-		Percent: form.Percent,
+		Slug:       form.Slug,
+		Percent:    form.Percent,
+		Salt:       form.Slug,
+		Variants:   form.Variants,
+		Rule:       form.Rule,
+		StartsAt:   form.StartsAt,
+		EndsAt:     form.EndsAt,
+		DefaultTTL: form.DefaultTTL,
+	}
+	if form.Salt != nil {
+		segment.Salt = *form.Salt
+	}
+
+	if form.Layer != nil {
+		layer, err := uc.layerRepo.SelectLayerByName(*form.Layer)
+		if err != nil {
+			return nil, pkgErr.Wrap(err, "select layer by name")
+		}
+
+		segment.LayerID = &layer.LayerID
+		segment.Salt = layer.Salt
+	}
+
+	// the segment is not created when its rollout fails to be stored
+	err = uc.uow.Do(func(repos transaction.Repositories) error {
+		if segment.LayerID != nil && segment.Percent != nil {
+			segments, err := layerSegments(repos, *segment.LayerID)
+			if err != nil {
+				return err
+			}
+
+			offset, ok := pkg.FreeLayerOffset(segments, *segment.Percent)
+			if !ok {
+				return errors.ErrLayerIsFull
+			}
+			segment.LayerOffset = offset
+		}
+
+		segmentID, err := repos.Segments.InsertSegment(segment)
+		if err != nil {
+			return pkgErr.Wrap(err, "insert segment")
+		}
+
+		segment.SegmentID = segmentID
+
+		if segment.Percent != nil && segment.Rule == nil {
+			return enrollPercentage(repos, segment, change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// layerSegments locks the layer before reading its segments, so segments placed in the layer at the same time
+// get their slices one after another and cannot take the same free one.
+func layerSegments(repos transaction.Repositories, layerID uint64) ([]models.Segment, error) {
+	_, err := repos.Layers.SelectLayerForUpdate(layerID)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select layer for update")
 	}
 
-	segmentID, err := uc.segmentRepo.InsertSegment(segment)
+	segments, err := repos.Segments.SelectSegmentsByLayer(layerID)
 	if err != nil {
-		return nil, pkgErr.Wrap(err, "insert segment")
+		return nil, pkgErr.Wrap(err, "select segments by layer")
 	}
 
-	segment.SegmentID = segmentID
+	return segments, nil
+}
 
-	if segment.Percent != nil {
-		userIDs, err := uc.userRepo.SelectUserIDs()
+// enrollPercentage stores memberships of all existing users that fall into the segment's rollout.
+func enrollPercentage(repos transaction.Repositories, segment *models.Segment, change models.Change) error {
+	userIDs, err := repos.Users.SelectUserIDs()
+	if err != nil {
+		return pkgErr.Wrap(err, "get user IDs")
+	}
+
+	IDsToAdd := pkg.PercentageIDs(userIDs, segment, *segment.Percent)
+	err = repos.Segments.InsertUsersToSegment(segment.SegmentID, pkg.SegmentMembers(segment, IDsToAdd), change)
+	if err != nil {
+		return pkgErr.Wrap(err, "insert users to segment")
+	}
+
+	return nil
+}
+
+func (uc *UseCase) UpdateSegment(slug string, form models.FormUpdateSegment, change models.Change) (*models.Segment, error) {
+	// the segment and the memberships of its new rollout or rule are changed together
+	var segment *models.Segment
+	err := uc.uow.Do(func(repos transaction.Repositories) error {
+		var err error
+		segment, err = repos.Segments.SelectSegmentBySlug(slug)
 		if err != nil {
-			return nil, pkgErr.Wrap(err, "get user IDs")
+			return pkgErr.Wrap(err, "select segment by slug")
+		}
+
+		if segment.ArchivedAt != nil {
+			return errors.ErrSegmentArchived
+		}
+
+		oldPercent := 0
+		if segment.Percent != nil {
+			oldPercent = *segment.Percent
+		}
+		newPercent := oldPercent
+		if form.Percent != nil {
+			newPercent = *form.Percent
+		}
+
+		if segment.LayerID != nil && newPercent > oldPercent {
+			segments, err := layerSegments(repos, *segment.LayerID)
+			if err != nil {
+				return err
+			}
+
+			if !pkg.LayerRangeIsFree(segments, segment.SegmentID, segment.LayerOffset, newPercent) {
+				offset, ok := pkg.FreeLayerOffset(segments, newPercent)
+				if oldPercent != 0 || !ok {
+					return errors.ErrLayerIsFull
+				}
+				segment.LayerOffset = offset
+			}
 		}
 
-		IDsToAdd := pkg.PercentageIDs(userIDs, *segment.Percent)
-		err = uc.segmentRepo.InsertUsersToSegment(segmentID, IDsToAdd)
+		if form.StartsAt != nil {
+			segment.StartsAt = form.StartsAt
+		}
+		if form.EndsAt != nil {
+			segment.EndsAt = form.EndsAt
+		}
+		if form.DefaultTTL != nil {
+			segment.DefaultTTL = form.DefaultTTL
+			if *form.DefaultTTL == "" {
+				segment.DefaultTTL = nil
+			}
+		}
+		if segment.StartsAt != nil && segment.EndsAt != nil && !segment.StartsAt.Before(*segment.EndsAt) {
+			return errors.ErrScheduleIsInvalid
+		}
+
+		hadRule := segment.Rule != nil
+		if form.Percent != nil {
+			segment.Percent = form.Percent
+		}
+		if form.Rule != nil {
+			segment.Rule = form.Rule
+			if *form.Rule == "" {
+				segment.Rule = nil
+			}
+		}
+
+		err = repos.Segments.UpdateSegment(segment)
 		if err != nil {
-			return nil, pkgErr.Wrap(err, "insert users to segment")
+			return pkgErr.Wrap(err, "update segment")
 		}
+
+		// rule-based segments are evaluated on read, so only pure percentage memberships are stored
+		if segment.Rule != nil {
+			if !hadRule {
+				userIDs, err := repos.Segments.SelectSegmentUserIDs(segment.SegmentID, models.SourcePercentage)
+				if err != nil {
+					return pkgErr.Wrap(err, "select segment user IDs")
+				}
+
+				if len(userIDs) != 0 {
+					err = repos.Segments.DeleteUsersFromSegment(segment.SegmentID, userIDs, change)
+					if err != nil {
+						return pkgErr.Wrap(err, "delete users from segment")
+					}
+				}
+			}
+
+			return nil
+		}
+		if hadRule {
+			oldPercent = 0
+		}
+
+		if newPercent > oldPercent {
+			userIDs, err := repos.Users.SelectUserIDs()
+			if err != nil {
+				return pkgErr.Wrap(err, "get user IDs")
+			}
+
+			IDsToAdd := pkg.PercentageIDs(userIDs, segment, newPercent)
+			if len(IDsToAdd) != 0 {
+				err = repos.Segments.InsertUsersToSegment(segment.SegmentID, pkg.SegmentMembers(segment, IDsToAdd), change)
+				if err != nil {
+					return pkgErr.Wrap(err, "insert users to segment")
+				}
+			}
+		} else if newPercent < oldPercent {
+			userIDs, err := repos.Segments.SelectSegmentUserIDs(segment.SegmentID, models.SourcePercentage)
+			if err != nil {
+				return pkgErr.Wrap(err, "select segment user IDs")
+			}
+
+			IDsToRemove := make([]uint64, 0, len(userIDs))
+			for _, userID := range userIDs {
+				if !pkg.InPercentage(segment, userID, newPercent) {
+					IDsToRemove = append(IDsToRemove, userID)
+				}
+			}
+
+			if len(IDsToRemove) != 0 {
+				err = repos.Segments.DeleteUsersFromSegment(segment.SegmentID, IDsToRemove, change)
+				if err != nil {
+					return pkgErr.Wrap(err, "delete users from segment")
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return segment, nil
 }
 
-func (uc *UseCase) DeleteSegment(slug string) error {
-	_, err := uc.segmentRepo.SelectSegmentBySlug(slug)
+// DeleteSegment archives the segment: it stops being evaluated, its slug stays reserved and history is kept.
+func (uc *UseCase) DeleteSegment(slug string, change models.Change) error {
+	segment, err := uc.segmentRepo.SelectSegmentBySlug(slug)
 	if err != nil {
 		return pkgErr.Wrap(err, "select segment by slug")
 	}
 
+	if segment.ArchivedAt != nil {
+		return errors.ErrSegmentArchived
+	}
+
+	err = uc.segmentRepo.ArchiveSegment(segment.SegmentID, change)
+	if err != nil {
+		return pkgErr.Wrap(err, "archive segment")
+	}
+
+	return nil
+}
+
+func (uc *UseCase) RestoreSegment(slug string, change models.Change) (*models.Segment, error) {
+	segment, err := uc.segmentRepo.SelectSegmentBySlug(slug)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segment by slug")
+	}
+
+	if segment.ArchivedAt == nil {
+		return segment, nil
+	}
+
+	err = uc.uow.Do(func(repos transaction.Repositories) error {
+		// the layer slice could have been taken by another segment while this one was archived
+		if segment.LayerID != nil && segment.Percent != nil {
+			segments, err := layerSegments(repos, *segment.LayerID)
+			if err != nil {
+				return err
+			}
+
+			if !pkg.LayerRangeIsFree(segments, segment.SegmentID, segment.LayerOffset, *segment.Percent) {
+				offset, ok := pkg.FreeLayerOffset(segments, *segment.Percent)
+				if !ok {
+					return errors.ErrLayerIsFull
+				}
+
+				segment.LayerOffset = offset
+				err = repos.Segments.UpdateSegment(segment)
+				if err != nil {
+					return pkgErr.Wrap(err, "update segment")
+				}
+			}
+		}
+
+		err := repos.Segments.RestoreSegment(segment.SegmentID)
+		if err != nil {
+			return pkgErr.Wrap(err, "restore segment")
+		}
+
+		segment.ArchivedAt = nil
+
+		if segment.Percent != nil && segment.Rule == nil {
+			return enrollPercentage(repos, segment, change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// PurgeSegment irreversibly deletes an archived segment; history records of its slug are kept.
+func (uc *UseCase) PurgeSegment(slug string, confirmation string) error {
+	if confirmation != slug {
+		return errors.ErrPurgeNotConfirmed
+	}
+
+	segment, err := uc.segmentRepo.SelectSegmentBySlug(slug)
+	if err != nil {
+		return pkgErr.Wrap(err, "select segment by slug")
+	}
+
+	if segment.ArchivedAt == nil {
+		return errors.ErrSegmentNotArchived
+	}
+
 	err = uc.segmentRepo.DeleteSegment(slug)
 	if err != nil {
 		return pkgErr.Wrap(err, "delete segment")
@@ -91,63 +391,593 @@ func (uc *UseCase) GetSegmentBySlug(slug string) (*models.Segment, error) {
 	return segment, nil
 }
 
-func (uc *UseCase) GetUserSegments(userID uint64) ([]models.Segment, error) {
-	_, err := uc.userRepo.SelectUserByID(userID)
+func (uc *UseCase) GetSegments() ([]models.SegmentSummary, error) {
+	segments, err := uc.segmentRepo.SelectSegmentSummaries()
 	if err != nil {
-		return []models.Segment{}, pkgErr.Wrap(err, "select user by ID")
+		return nil, pkgErr.Wrap(err, "select segment summaries")
 	}
 
-	segments, err := uc.segmentRepo.SelectSegmentsByUser(userID)
-	if err != nil {
-		return []models.Segment{}, pkgErr.Wrap(err, "select segments by userID")
+	for idx := range segments {
+		if segments[idx].Rule != nil {
+			segments[idx].Members = nil
+		}
 	}
 
 	return segments, nil
 }
 
-func (uc *UseCase) EditUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string) ([]models.Segment, error) {
-	_, err := uc.userRepo.SelectUserByID(userID)
+func (uc *UseCase) GetSegmentUsers(form models.FormSegmentUsers) (*models.SegmentUsersResponse, error) {
+	segment, err := uc.segmentRepo.SelectSegmentBySlug(form.Slug)
 	if err != nil {
-		return []models.Segment{}, pkgErr.Wrap(err, "select user by ID")
+		return nil, pkgErr.Wrap(err, "select segment by slug")
+	}
+	if segment.Rule != nil {
+		return nil, errors.ErrRuleSegmentMembers
 	}
 
-	for idx, currentSegment := range segmentsToAdd {
-		segment, err := uc.segmentRepo.SelectSegmentBySlug(currentSegment.SegmentSlug)
+	filter := form.Filter()
+	filter.Limit++
+
+	users, err := uc.segmentRepo.SelectSegmentUsers(segment.SegmentID, filter)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segment users")
+	}
+
+	count, err := uc.segmentRepo.CountSegmentUsers(segment.SegmentID, filter)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "count segment users")
+	}
+
+	response := &models.SegmentUsersResponse{
+		Users: users,
+		Count: count,
+	}
+	if len(users) > form.Limit {
+		response.Users = users[:form.Limit]
+		response.NextCursor = strconv.FormatUint(response.Users[form.Limit-1].UserID, 10)
+	}
+
+	return response, nil
+}
+
+// AddSegmentUsers adds the users batch by batch, each batch in its own transaction, so a failure leaves
+// the previous batches applied. Unknown users and users taken by another segment of an exclusive layer are skipped.
+func (uc *UseCase) AddSegmentUsers(slug string, form models.FormSegmentUsersBulk,
+	change models.Change) (*models.SegmentUsersBulkResponse, error) {
+	segment, err := uc.segmentRepo.SelectSegmentBySlug(slug)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segment by slug")
+	}
+
+	if segment.ArchivedAt != nil {
+		return nil, pkgErr.Wrapf(errors.ErrSegmentArchived, "segment %s", segment.Slug)
+	}
+
+	until := form.Until
+	if until == nil && segment.DefaultTTL != nil {
+		ttl, err := models.ParseTTL(*segment.DefaultTTL)
 		if err != nil {
-			return []models.Segment{}, pkgErr.Wrap(err, "select segment by slug")
+			return nil, pkgErr.Wrapf(errors.ErrTTLIsInvalid, "default ttl of segment %s", segment.Slug)
+		}
+
+		formatted := models.FormatUntil(time.Now().Add(ttl))
+		until = &formatted
+	}
+
+	rivalSegments, err := uc.rivalSegments(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	response := newBulkResponse()
+	for _, batch := range batches(uniqueIDs(form.UserIDs), uc.cfg.Bulk.BatchSize) {
+		err = uc.uow.Do(func(repos transaction.Repositories) error {
+			// edits and batches sharing users wait for each other here, so both cannot pass the layer check
+			users, err := repos.Users.SelectUsersForUpdate(batch)
+			if err != nil {
+				return pkgErr.Wrap(err, "select users for update")
+			}
+
+			userIDs := make([]uint64, len(users))
+			for idx, user := range users {
+				userIDs[idx] = user.UserID
+			}
+			response.Unknown = append(response.Unknown, exceptIDs(batch, userIDs)...)
+
+			conflicting, err := layerRivalMembers(repos.Segments, rivalSegments, users)
+			if err != nil {
+				return err
+			}
+			response.Conflicting = append(response.Conflicting, conflicting...)
+
+			userIDs = exceptIDs(intersectIDs(batch, userIDs), conflicting)
+			if len(userIDs) == 0 {
+				return nil
+			}
+
+			err = repos.Segments.AddUsersToSegment(segment.SegmentID, pkg.SegmentMembers(segment, userIDs), until,
+				form.Source, change)
+			if err != nil {
+				return pkgErr.Wrap(err, "add users to segment")
+			}
+
+			response.Processed += len(userIDs)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// RemoveSegmentUsers removes the users batch by batch as AddSegmentUsers adds them, unknown users are skipped.
+func (uc *UseCase) RemoveSegmentUsers(slug string, userIDs []uint64,
+	change models.Change) (*models.SegmentUsersBulkResponse, error) {
+	segment, err := uc.segmentRepo.SelectSegmentBySlug(slug)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segment by slug")
+	}
+
+	if segment.ArchivedAt != nil {
+		return nil, pkgErr.Wrapf(errors.ErrSegmentArchived, "segment %s", segment.Slug)
+	}
+
+	response := newBulkResponse()
+	for _, batch := range batches(uniqueIDs(userIDs), uc.cfg.Bulk.BatchSize) {
+		known, err := uc.knownUserIDs(batch, response)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(known) == 0 {
+			continue
+		}
+
+		err = uc.segmentRepo.DeleteUsersFromSegment(segment.SegmentID, known, change)
+		if err != nil {
+			return nil, pkgErr.Wrap(err, "delete users from segment")
+		}
+
+		response.Processed += len(known)
+	}
+
+	return response, nil
+}
+
+// rivalSegments returns the other segments of the segment's layer if the layer is exclusive.
+func (uc *UseCase) rivalSegments(segment *models.Segment) ([]models.Segment, error) {
+	if segment.LayerID == nil {
+		return nil, nil
+	}
+
+	layer, err := uc.layerRepo.SelectLayerByID(*segment.LayerID)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select layer by ID")
+	}
+
+	if !layer.Exclusive {
+		return nil, nil
+	}
+
+	layerSegments, err := uc.segmentRepo.SelectSegmentsByLayer(layer.LayerID)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segments by layer")
+	}
+
+	result := make([]models.Segment, 0, len(layerSegments))
+	for _, layerSegment := range layerSegments {
+		if layerSegment.SegmentID != segment.SegmentID {
+			result = append(result, layerSegment)
+		}
+	}
+
+	return result, nil
+}
+
+// layerRivalMembers returns the users who are already in one of the rival segments, stored or matched by its rule,
+// in the order of the users.
+func layerRivalMembers(segmentRepo segmentRepository.RepositoryI, rivalSegments []models.Segment,
+	users []models.User) ([]uint64, error) {
+	conflicting := make([]uint64, 0)
+	if len(rivalSegments) == 0 || len(users) == 0 {
+		return conflicting, nil
+	}
+
+	segmentIDs := make([]uint64, len(rivalSegments))
+	for idx, segment := range rivalSegments {
+		segmentIDs[idx] = segment.SegmentID
+	}
+
+	userIDs := make([]uint64, len(users))
+	for idx, user := range users {
+		userIDs[idx] = user.UserID
+	}
+
+	memberIDs, err := segmentRepo.SelectMemberIDs(segmentIDs, userIDs)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select member IDs")
+	}
+
+	members := make(map[uint64]struct{}, len(memberIDs))
+	for _, userID := range memberIDs {
+		members[userID] = struct{}{}
+	}
+
+	now := time.Now()
+	for idx := range users {
+		_, stored := members[users[idx].UserID]
+		evaluated := activeSegments(mergeSegments(users[idx].UserID, nil, pkg.RuleSegments(rivalSegments, &users[idx])), now)
+		if stored || len(evaluated) != 0 {
+			conflicting = append(conflicting, users[idx].UserID)
+		}
+	}
+
+	return conflicting, nil
+}
+
+// knownUserIDs returns the existing users of the batch and reports the rest as unknown.
+func (uc *UseCase) knownUserIDs(batch []uint64, response *models.SegmentUsersBulkResponse) ([]uint64, error) {
+	known, err := uc.userRepo.SelectExistingUserIDs(batch)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select existing user IDs")
+	}
+
+	response.Unknown = append(response.Unknown, exceptIDs(batch, known)...)
+
+	return intersectIDs(batch, known), nil
+}
+
+func newBulkResponse() *models.SegmentUsersBulkResponse {
+	return &models.SegmentUsersBulkResponse{
+		Unknown:     []uint64{},
+		Conflicting: []uint64{},
+	}
+}
+
+// uniqueIDs drops repeated IDs keeping the order of the first occurrences.
+func uniqueIDs(IDs []uint64) []uint64 {
+	seen := make(map[uint64]struct{}, len(IDs))
+	result := make([]uint64, 0, len(IDs))
+	for _, ID := range IDs {
+		if _, ok := seen[ID]; !ok {
+			seen[ID] = struct{}{}
+			result = append(result, ID)
+		}
+	}
+
+	return result
+}
+
+// batches splits the IDs into slices of at most size IDs, a non-positive size means a single batch.
+func batches(IDs []uint64, size int) [][]uint64 {
+	if size <= 0 {
+		size = len(IDs)
+	}
+
+	result := make([][]uint64, 0)
+	for len(IDs) > size {
+		result = append(result, IDs[:size])
+		IDs = IDs[size:]
+	}
+	if len(IDs) != 0 {
+		result = append(result, IDs)
+	}
+
+	return result
+}
+
+// exceptIDs keeps the IDs that are not in excluded, in their order.
+func exceptIDs(IDs []uint64, excluded []uint64) []uint64 {
+	set := make(map[uint64]struct{}, len(excluded))
+	for _, ID := range excluded {
+		set[ID] = struct{}{}
+	}
+
+	result := make([]uint64, 0, len(IDs))
+	for _, ID := range IDs {
+		if _, ok := set[ID]; !ok {
+			result = append(result, ID)
+		}
+	}
+
+	return result
+}
+
+// intersectIDs keeps the IDs that are in included, in their order.
+func intersectIDs(IDs []uint64, included []uint64) []uint64 {
+	set := make(map[uint64]struct{}, len(included))
+	for _, ID := range included {
+		set[ID] = struct{}{}
+	}
+
+	result := make([]uint64, 0, len(included))
+	for _, ID := range IDs {
+		if _, ok := set[ID]; ok {
+			result = append(result, ID)
+		}
+	}
+
+	return result
+}
+
+func (uc *UseCase) GetUserSegments(userID uint64) ([]models.UserSegment, error) {
+	user, err := uc.userRepo.SelectUserByID(userID)
+	if err != nil {
+		return []models.UserSegment{}, pkgErr.Wrap(err, "select user by ID")
+	}
+
+	return userSegments(uc.segmentRepo, user)
+}
+
+func userSegments(segmentRepo segmentRepository.RepositoryI, user *models.User) ([]models.UserSegment, error) {
+	segments, err := segmentRepo.SelectSegmentsByUser(user.UserID)
+	if err != nil {
+		return []models.UserSegment{}, pkgErr.Wrap(err, "select segments by userID")
+	}
+
+	dynamicSegments, err := segmentRepo.SelectDynamicSegments()
+	if err != nil {
+		return []models.UserSegment{}, pkgErr.Wrap(err, "select dynamic segments")
+	}
+
+	return activeSegments(mergeSegments(user.UserID, segments, pkg.RuleSegments(dynamicSegments, user)), time.Now()), nil
+}
+
+// GetUsersSegments resolves the segments of many users with three queries whatever their number: the users,
+// their memberships and the dynamic segments.
+func (uc *UseCase) GetUsersSegments(userIDs []uint64) (*models.UsersSegmentsResponse, error) {
+	userIDs = uniqueIDs(userIDs)
+
+	users, err := uc.userRepo.SelectUsersByIDs(userIDs)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select users by IDs")
+	}
+
+	response := &models.UsersSegmentsResponse{
+		Users: make(map[uint64][]models.UserSegment, len(users)),
+	}
+
+	knownIDs := make([]uint64, len(users))
+	for idx, user := range users {
+		knownIDs[idx] = user.UserID
+	}
+	response.Unknown = exceptIDs(userIDs, knownIDs)
+
+	if len(users) == 0 {
+		return response, nil
+	}
+
+	segments, err := uc.segmentRepo.SelectSegmentsByUsers(knownIDs)
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select segments by users")
+	}
+
+	dynamicSegments, err := uc.segmentRepo.SelectDynamicSegments()
+	if err != nil {
+		return nil, pkgErr.Wrap(err, "select dynamic segments")
+	}
+
+	now := time.Now()
+	for idx := range users {
+		user := &users[idx]
+		response.Users[user.UserID] = activeSegments(mergeSegments(user.UserID, segments[user.UserID],
+			pkg.RuleSegments(dynamicSegments, user)), now)
+	}
+
+	return response, nil
+}
+
+// activeSegments hides segments whose schedule window does not cover the moment.
+func activeSegments(segments []models.UserSegment, moment time.Time) []models.UserSegment {
+	result := make([]models.UserSegment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.IsActive(moment) {
+			result = append(result, segment)
+		}
+	}
+
+	return result
+}
+
+// mergeSegments appends matched rule segments the user is not yet stored in.
+func mergeSegments(userID uint64, stored []models.UserSegment, evaluated []models.Segment) []models.UserSegment {
+	seen := make(map[uint64]struct{}, len(stored))
+	for _, segment := range stored {
+		seen[segment.SegmentID] = struct{}{}
+	}
+
+	for _, segment := range evaluated {
+		if _, ok := seen[segment.SegmentID]; !ok {
+			stored = append(stored, models.UserSegment{
+				Segment: segment,
+				Source:  models.SourceRule,
+				Variant: pkg.PickVariant(segment.Salt, userID, segment.Variants),
+			})
+		}
+	}
+
+	return stored
+}
+
+// EditUserSegments applies the whole edit in one transaction. A slug both added and removed or added twice
+// is rejected, and all unknown slugs are reported at once.
+func (uc *UseCase) EditUserSegments(userID uint64, segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string,
+	change models.Change) ([]models.UserSegment, error) {
+	if slugs := contradictingSlugs(segmentsToAdd, segmentsToRemove); len(slugs) != 0 {
+		return []models.UserSegment{}, errors.WithDetails(errors.ErrSegmentsContradict, slugs...)
+	}
+
+	user, err := uc.userRepo.SelectUserByID(userID)
+	if err != nil {
+		return []models.UserSegment{}, pkgErr.Wrap(err, "select user by ID")
+	}
+
+	segmentsBySlug, err := uc.segmentsBySlugs(segmentsToAdd, segmentsToRemove)
+	if err != nil {
+		return []models.UserSegment{}, err
+	}
+
+	layeredSegments := make([]models.Segment, 0)
+	for idx, currentSegment := range segmentsToAdd {
+		segment := segmentsBySlug[currentSegment.SegmentSlug]
+		if segment.ArchivedAt != nil {
+			return []models.UserSegment{}, pkgErr.Wrapf(errors.ErrSegmentArchived, "segment %s", segment.Slug)
 		}
 
 		segmentsToAdd[idx].SegmentID = segment.SegmentID
+		segmentsToAdd[idx].Variant = pkg.PickVariant(segment.Salt, userID, segment.Variants)
+		if currentSegment.Until == nil && segment.DefaultTTL != nil {
+			ttl, err := models.ParseTTL(*segment.DefaultTTL)
+			if err != nil {
+				return []models.UserSegment{}, pkgErr.Wrapf(errors.ErrTTLIsInvalid, "default ttl of segment %s", segment.Slug)
+			}
+
+			until := models.FormatUntil(time.Now().Add(ttl))
+			segmentsToAdd[idx].Until = &until
+		}
+		if segment.LayerID != nil {
+			layeredSegments = append(layeredSegments, *segment)
+		}
 	}
 
 	segmentIDsToRemove := make([]uint64, len(segmentsToRemove))
 	for idx, segmentSlug := range segmentsToRemove {
-		segment, err := uc.segmentRepo.SelectSegmentBySlug(segmentSlug)
+		segmentIDsToRemove[idx] = segmentsBySlug[segmentSlug].SegmentID
+	}
+
+	if len(segmentsToAdd) != 0 || len(segmentIDsToRemove) != 0 {
+		err = uc.uow.Do(func(repos transaction.Repositories) error {
+			// concurrent edits of the user wait for each other here, so both cannot pass the layer check
+			user, err := repos.Users.SelectUserForUpdate(userID)
+			if err != nil {
+				return pkgErr.Wrap(err, "select user for update")
+			}
+
+			if len(layeredSegments) != 0 {
+				err = uc.checkLayerConflicts(repos.Segments, user, layeredSegments, segmentIDsToRemove)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = repos.Segments.UpdateUserSegments(userID, segmentsToAdd, segmentIDsToRemove, change)
+			if err != nil {
+				return pkgErr.Wrap(err, "update user segments")
+			}
+
+			return nil
+		})
 		if err != nil {
-			return []models.Segment{}, pkgErr.Wrap(err, "select segment by slug")
+			return []models.UserSegment{}, err
 		}
+	}
+
+	// the same view as GetUserSegments, matched rule segments included
+	return userSegments(uc.segmentRepo, user)
+}
 
-		segmentIDsToRemove[idx] = segment.SegmentID
+// contradictingSlugs returns the slugs that are added twice or both added and removed, each once.
+func contradictingSlugs(segmentsToAdd []models.AddUserToSegment, segmentsToRemove []string) []string {
+	added := make(map[string]struct{}, len(segmentsToAdd))
+	reported := make(map[string]struct{})
+	slugs := make([]string, 0)
+	report := func(slug string) {
+		if _, ok := reported[slug]; !ok {
+			reported[slug] = struct{}{}
+			slugs = append(slugs, slug)
+		}
 	}
 
-	if len(segmentsToAdd) != 0 {
-		err = uc.segmentRepo.InsertSegmentsToUser(userID, segmentsToAdd)
-		if err != nil {
-			return []models.Segment{}, pkgErr.Wrap(err, "insert segments to user")
+	for _, segment := range segmentsToAdd {
+		if _, ok := added[segment.SegmentSlug]; ok {
+			report(segment.SegmentSlug)
 		}
+		added[segment.SegmentSlug] = struct{}{}
 	}
 
-	if len(segmentIDsToRemove) != 0 {
-		err = uc.segmentRepo.DeleteSegmentsFromUser(userID, segmentIDsToRemove)
-		if err != nil {
-			return []models.Segment{}, pkgErr.Wrap(err, "delete segments from user")
+	for _, slug := range segmentsToRemove {
+		if _, ok := added[slug]; ok {
+			report(slug)
 		}
 	}
 
-	segments, err := uc.segmentRepo.SelectSegmentsByUser(userID)
+	return slugs
+}
+
+// segmentsBySlugs looks up the segments of an edit in one query and reports all unknown slugs together.
+func (uc *UseCase) segmentsBySlugs(segmentsToAdd []models.AddUserToSegment,
+	segmentsToRemove []string) (map[string]*models.Segment, error) {
+	slugs := make([]string, 0, len(segmentsToAdd)+len(segmentsToRemove))
+	for _, segment := range segmentsToAdd {
+		slugs = append(slugs, segment.SegmentSlug)
+	}
+	slugs = append(slugs, segmentsToRemove...)
+
+	result := make(map[string]*models.Segment, len(slugs))
+	if len(slugs) == 0 {
+		return result, nil
+	}
+
+	segments, err := uc.segmentRepo.SelectSegmentsBySlugs(slugs)
 	if err != nil {
-		return []models.Segment{}, pkgErr.Wrap(err, "select segments by userID")
+		return nil, pkgErr.Wrap(err, "select segments by slugs")
 	}
 
-	return segments, nil
+	for idx := range segments {
+		result[segments[idx].Slug] = &segments[idx]
+	}
+
+	unknown := make([]string, 0)
+	for _, slug := range slugs {
+		if _, ok := result[slug]; !ok {
+			unknown = append(unknown, slug)
+		}
+	}
+	if len(unknown) != 0 {
+		return nil, errors.WithDetails(errors.ErrSegmentNotFound, unknown...)
+	}
+
+	return result, nil
+}
+
+// checkLayerConflicts rejects adding the user to a second segment of an exclusive layer.
+func (uc *UseCase) checkLayerConflicts(segmentRepo segmentRepository.RepositoryI, user *models.User,
+	segmentsToAdd []models.Segment, segmentIDsToRemove []uint64) error {
+	currentSegments, err := userSegments(segmentRepo, user)
+	if err != nil {
+		return err
+	}
+
+	removed := make(map[uint64]struct{}, len(segmentIDsToRemove))
+	for _, segmentID := range segmentIDsToRemove {
+		removed[segmentID] = struct{}{}
+	}
+
+	occupied := make(map[uint64]uint64)
+	for _, segment := range currentSegments {
+		if _, ok := removed[segment.SegmentID]; !ok && segment.LayerID != nil {
+			occupied[*segment.LayerID] = segment.SegmentID
+		}
+	}
+
+	for _, segment := range segmentsToAdd {
+		layer, err := uc.layerRepo.SelectLayerByID(*segment.LayerID)
+		if err != nil {
+			return pkgErr.Wrap(err, "select layer by ID")
+		}
+
+		if !layer.Exclusive {
+			continue
+		}
+
+		if segmentID, ok := occupied[layer.LayerID]; ok && segmentID != segment.SegmentID {
+			return pkgErr.Wrapf(errors.ErrLayerConflict, "layer %s", layer.Name)
+		}
+		occupied[layer.LayerID] = segment.SegmentID
+	}
+
+	return nil
 }
@@ -6,17 +6,32 @@ import (
 	pkgErr "github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	mockLayerRepo "github.com/vvinokurshin/AvitoInternship/internal/layer/repository/mocks"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	mockSegmentRepo "github.com/vvinokurshin/AvitoInternship/internal/segment/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
+	mockTransaction "github.com/vvinokurshin/AvitoInternship/internal/transaction/mocks"
 	mockUserRepo "github.com/vvinokurshin/AvitoInternship/internal/user/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 	"testing"
+	"time"
 )
 
 func createConfig() *config.Config {
 	return new(config.Config)
 }
 
+// newUnitOfWork passes the mocks to fn as they are, the expectations of each test check what fn does with them.
+func newUnitOfWork(ctrl *gomock.Controller, repos transaction.Repositories) transaction.UnitOfWorkI {
+	uow := mockTransaction.NewMockUnitOfWorkI(ctrl)
+	uow.EXPECT().Do(gomock.Any()).DoAndReturn(func(fn func(repos transaction.Repositories) error) error {
+		return fn(repos)
+	}).AnyTimes()
+
+	return uow
+}
+
 func generateFakeData(data any) {
 	faker.SetRandomMapAndSliceMaxSize(10)
 	faker.SetRandomMapAndSliceMinSize(1)
@@ -27,16 +42,27 @@ func generateFakeData(data any) {
 
 func TestUseCase_CreateSegment(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
 
 	var fakeForm models.FormSegment
 	generateFakeData(&fakeForm)
 	fakeForm.Percent = nil
+	fakeForm.Salt = nil
+	fakeForm.Layer = nil
+	fakeForm.Rule = nil
+	fakeForm.StartsAt = nil
+	fakeForm.EndsAt = nil
+	fakeForm.DefaultTTL = nil
 	fakeSegment := &models.Segment{
-		Slug: fakeForm.Slug,
+		Slug:     fakeForm.Slug,
+		Salt:     fakeForm.Slug,
+		Variants: fakeForm.Variants,
 	}
 	fakeSegmentResponse := &models.Segment{
 		SegmentID: 1,
 		Slug:      fakeForm.Slug,
+		Salt:      fakeForm.Slug,
+		Variants:  fakeForm.Variants,
 	}
 
 	t.Parallel()
@@ -45,11 +71,13 @@ func TestUseCase_CreateSegment(t *testing.T) {
 
 	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	segmentUC := New(cfg, segmentRepo, userRepo)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
 
 	segmentRepo.EXPECT().SelectSegmentBySlug(fakeForm.Slug).Return(nil, errors.ErrSegmentNotFound)
 	segmentRepo.EXPECT().InsertSegment(fakeSegment).Return(uint64(1), nil)
-	response, err := segmentUC.CreateSegment(fakeForm)
+	response, err := segmentUC.CreateSegment(fakeForm, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -59,8 +87,57 @@ func TestUseCase_CreateSegment(t *testing.T) {
 	}
 }
 
+func TestUseCase_UpdateSegment(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	oldPercent, newPercent := 50, 10
+	fakeSegment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "test",
+		Percent:   &oldPercent,
+		Salt:      "test",
+	}
+	fakeForm := models.FormUpdateSegment{
+		Percent: &newPercent,
+	}
+	fakeUserIDs := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	var IDsToRemove []uint64
+	for _, userID := range fakeUserIDs {
+		if !pkg.InPercentage(fakeSegment, userID, newPercent) {
+			IDsToRemove = append(IDsToRemove, userID)
+		}
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	segmentRepo.EXPECT().UpdateSegment(fakeSegment).Return(nil)
+	segmentRepo.EXPECT().SelectSegmentUserIDs(fakeSegment.SegmentID, models.SourcePercentage).Return(fakeUserIDs, nil)
+	if len(IDsToRemove) != 0 {
+		segmentRepo.EXPECT().DeleteUsersFromSegment(fakeSegment.SegmentID, IDsToRemove, change).Return(nil)
+	}
+	response, err := segmentUC.UpdateSegment(fakeSegment.Slug, fakeForm, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, newPercent, *response.Percent)
+	}
+}
+
 func TestUseCase_DeleteSegment(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
 
 	fakeSegment := &models.Segment{
 		SegmentID: 1,
@@ -73,11 +150,13 @@ func TestUseCase_DeleteSegment(t *testing.T) {
 
 	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	segmentUC := New(cfg, segmentRepo, userRepo)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
 
 	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
-	segmentRepo.EXPECT().DeleteSegment(fakeSegment.Slug).Return(nil)
-	err := segmentUC.DeleteSegment(fakeSegment.Slug)
+	segmentRepo.EXPECT().ArchiveSegment(fakeSegment.SegmentID, change).Return(nil)
+	err := segmentUC.DeleteSegment(fakeSegment.Slug, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -85,6 +164,81 @@ func TestUseCase_DeleteSegment(t *testing.T) {
 	}
 }
 
+func TestUseCase_RestoreSegment(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	archivedAt := time.Now()
+	percent := 10
+	fakeSegment := &models.Segment{
+		SegmentID:  1,
+		Slug:       "test",
+		Percent:    &percent,
+		Salt:       "test",
+		ArchivedAt: &archivedAt,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	segmentRepo.EXPECT().RestoreSegment(fakeSegment.SegmentID).Return(nil)
+	userRepo.EXPECT().SelectUserIDs().Return([]uint64{}, nil)
+	segmentRepo.EXPECT().InsertUsersToSegment(fakeSegment.SegmentID, []models.SegmentMember{}, change).Return(nil)
+	response, err := segmentUC.RestoreSegment(fakeSegment.Slug, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Nil(t, response.ArchivedAt)
+	}
+}
+
+func TestUseCase_PurgeSegment(t *testing.T) {
+	cfg := createConfig()
+
+	archivedAt := time.Now()
+	fakeSegment := &models.Segment{
+		SegmentID:  1,
+		Slug:       "test",
+		ArchivedAt: &archivedAt,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	err := segmentUC.PurgeSegment(fakeSegment.Slug, "")
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrPurgeNotConfirmed {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrPurgeNotConfirmed, causeErr)
+	}
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	segmentRepo.EXPECT().DeleteSegment(fakeSegment.Slug).Return(nil)
+	err = segmentUC.PurgeSegment(fakeSegment.Slug, fakeSegment.Slug)
+	causeErr = pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	}
+}
+
 func TestUseCase_GetSegmentBySlug(t *testing.T) {
 	cfg := createConfig()
 
@@ -99,7 +253,9 @@ func TestUseCase_GetSegmentBySlug(t *testing.T) {
 
 	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	segmentUC := New(cfg, segmentRepo, userRepo)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
 
 	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
 	response, err := segmentUC.GetSegmentBySlug(fakeSegment.Slug)
@@ -116,9 +272,22 @@ func TestUseCase_GetUserSegments(t *testing.T) {
 	cfg := createConfig()
 
 	var fakeUser *models.User
-	var fakeUserSegments []models.Segment
+	var fakeUserSegments []models.UserSegment
 	generateFakeData(&fakeUser)
 	generateFakeData(&fakeUserSegments)
+	for idx := range fakeUserSegments {
+		fakeUserSegments[idx].StartsAt = nil
+		fakeUserSegments[idx].EndsAt = nil
+	}
+	endedAt := time.Now().Add(-time.Hour)
+	finishedSegment := models.UserSegment{
+		Segment: models.Segment{
+			SegmentID: 100,
+			Slug:      "finished",
+			EndsAt:    &endedAt,
+		},
+		Source: models.SourceManual,
+	}
 
 	t.Parallel()
 	ctrl := gomock.NewController(t)
@@ -126,10 +295,14 @@ func TestUseCase_GetUserSegments(t *testing.T) {
 
 	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	segmentUC := New(cfg, segmentRepo, userRepo)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
 
 	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
-	segmentRepo.EXPECT().SelectSegmentsByUser(fakeUser.UserID).Return(fakeUserSegments, nil)
+	segmentRepo.EXPECT().SelectSegmentsByUser(fakeUser.UserID).
+		Return(append(append([]models.UserSegment{}, fakeUserSegments...), finishedSegment), nil)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return([]models.Segment{}, nil)
 	response, err := segmentUC.GetUserSegments(fakeUser.UserID)
 	causeErr := pkgErr.Cause(err)
 
@@ -142,17 +315,37 @@ func TestUseCase_GetUserSegments(t *testing.T) {
 
 func TestUseCase_EditUserSegments(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
 
 	var fakeUser *models.User
 	generateFakeData(&fakeUser)
+	fakeUser.Attributes = map[string]string{"platform": "ios"}
 	segmentsToAdd := []models.AddUserToSegment{
 		{
 			SegmentSlug: "test",
 			SegmentID:   1,
 			Until:       nil,
+			Source:      models.SourceManual,
 		},
 	}
 	segmentsToRemove := []string{"tmp"}
+	rule := `platform == "ios"`
+	percent := 100
+	// the percentage segment is not evaluated on read, the user is in it only while its row is stored
+	dynamicSegments := []models.Segment{
+		{
+			SegmentID: 3,
+			Slug:      "ios",
+			Salt:      "ios",
+			Rule:      &rule,
+		},
+		{
+			SegmentID: 4,
+			Slug:      "rollout",
+			Salt:      "rollout",
+			Percent:   &percent,
+		},
+	}
 	fakeSegments := []models.Segment{
 		{
 			SegmentID: 1,
@@ -165,11 +358,10 @@ func TestUseCase_EditUserSegments(t *testing.T) {
 			Percent:   nil,
 		},
 	}
-	fakeUserSegments := []models.Segment{
+	fakeUserSegments := []models.UserSegment{
 		{
-			SegmentID: fakeSegments[0].SegmentID,
-			Slug:      fakeSegments[0].Slug,
-			Percent:   fakeSegments[0].Percent,
+			Segment: fakeSegments[0],
+			Source:  models.SourceManual,
 		},
 	}
 
@@ -179,21 +371,755 @@ func TestUseCase_EditUserSegments(t *testing.T) {
 
 	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	segmentUC := New(cfg, segmentRepo, userRepo)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
 
 	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
-	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegments[0].Slug).Return(&fakeSegments[0], nil)
-	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegments[1].Slug).Return(&fakeSegments[1], nil)
-	segmentRepo.EXPECT().InsertSegmentsToUser(fakeUser.UserID, segmentsToAdd).Return(nil)
-	segmentRepo.EXPECT().DeleteSegmentsFromUser(fakeUser.UserID, []uint64{fakeSegments[1].SegmentID}).Return(nil)
+	userRepo.EXPECT().SelectUserForUpdate(fakeUser.UserID).Return(fakeUser, nil)
+	segmentRepo.EXPECT().SelectSegmentsBySlugs([]string{fakeSegments[0].Slug, fakeSegments[1].Slug}).Return(fakeSegments, nil)
+	segmentRepo.EXPECT().UpdateUserSegments(fakeUser.UserID, segmentsToAdd, []uint64{fakeSegments[1].SegmentID}, change).
+		Return(nil)
 	segmentRepo.EXPECT().SelectSegmentsByUser(fakeUser.UserID).Return(fakeUserSegments, nil)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return(dynamicSegments, nil)
 
-	response, err := segmentUC.EditUserSegments(fakeUser.UserID, segmentsToAdd, segmentsToRemove)
+	response, err := segmentUC.EditUserSegments(fakeUser.UserID, segmentsToAdd, segmentsToRemove, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
 		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
 	} else {
-		require.Equal(t, fakeUserSegments, response)
+		require.Equal(t, append(fakeUserSegments, models.UserSegment{Segment: dynamicSegments[0],
+			Source: models.SourceRule}), response)
+	}
+}
+
+func TestUseCase_EditUserSegmentsDefaultTTL(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	var fakeUser *models.User
+	generateFakeData(&fakeUser)
+	defaultTTL := "48h"
+	segmentsToAdd := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			Source:      models.SourceManual,
+		},
+	}
+	fakeSegment := models.Segment{
+		SegmentID:  1,
+		Slug:       "test",
+		DefaultTTL: &defaultTTL,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	var inserted []models.AddUserToSegment
+	before := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
+	userRepo.EXPECT().SelectUserForUpdate(fakeUser.UserID).Return(fakeUser, nil)
+	segmentRepo.EXPECT().SelectSegmentsBySlugs([]string{fakeSegment.Slug}).Return([]models.Segment{fakeSegment}, nil)
+	segmentRepo.EXPECT().UpdateUserSegments(fakeUser.UserID, gomock.Any(), []uint64{}, change).
+		DoAndReturn(func(userID uint64, segments []models.AddUserToSegment, segmentIDs []uint64,
+			change models.Change) error {
+			inserted = segments
+			return nil
+		})
+	segmentRepo.EXPECT().SelectSegmentsByUser(fakeUser.UserID).Return([]models.UserSegment{}, nil)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return([]models.Segment{}, nil)
+
+	_, err := segmentUC.EditUserSegments(fakeUser.UserID, segmentsToAdd, []string{}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Len(t, inserted, 1)
+		require.NotNil(t, inserted[0].Until)
+		until, err := models.ParseUntil(*inserted[0].Until)
+		require.NoError(t, err)
+		require.False(t, until.Before(before))
+		require.False(t, until.After(time.Now().Add(48*time.Hour)))
+	}
+}
+
+func TestUseCase_CreateSegmentInLayer(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	percent := 30
+	layerName := "checkout"
+	fakeForm := models.FormSegment{
+		Slug:    "test",
+		Percent: &percent,
+		Layer:   &layerName,
+	}
+	fakeLayer := &models.Layer{
+		LayerID:   1,
+		Name:      layerName,
+		Salt:      layerName,
+		Exclusive: true,
+	}
+	otherPercent := 50
+	layerSegments := []models.Segment{
+		{
+			SegmentID:   2,
+			Slug:        "other",
+			Percent:     &otherPercent,
+			LayerID:     &fakeLayer.LayerID,
+			LayerOffset: 0,
+		},
+	}
+	fakeSegment := &models.Segment{
+		Slug:        fakeForm.Slug,
+		Percent:     &percent,
+		Salt:        fakeLayer.Salt,
+		LayerID:     &fakeLayer.LayerID,
+		LayerOffset: 50,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo, Layers: layerRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeForm.Slug).Return(nil, errors.ErrSegmentNotFound)
+	layerRepo.EXPECT().SelectLayerByName(layerName).Return(fakeLayer, nil)
+	layerRepo.EXPECT().SelectLayerForUpdate(fakeLayer.LayerID).Return(fakeLayer, nil)
+	segmentRepo.EXPECT().SelectSegmentsByLayer(fakeLayer.LayerID).Return(layerSegments, nil)
+	segmentRepo.EXPECT().InsertSegment(fakeSegment).Return(uint64(1), nil)
+	userRepo.EXPECT().SelectUserIDs().Return([]uint64{}, nil)
+	segmentRepo.EXPECT().InsertUsersToSegment(uint64(1), gomock.Any(), change).Return(nil)
+	response, err := segmentUC.CreateSegment(fakeForm, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, 50, response.LayerOffset)
+	}
+}
+
+func TestUseCase_EditUserSegmentsLayerConflict(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	var fakeUser *models.User
+	generateFakeData(&fakeUser)
+	fakeLayer := &models.Layer{
+		LayerID:   1,
+		Name:      "checkout",
+		Salt:      "checkout",
+		Exclusive: true,
+	}
+	segmentsToAdd := []models.AddUserToSegment{
+		{
+			SegmentSlug: "test",
+			Source:      models.SourceManual,
+		},
+	}
+	fakeSegment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "test",
+		LayerID:   &fakeLayer.LayerID,
+	}
+	fakeUserSegments := []models.UserSegment{
+		{
+			Segment: models.Segment{
+				SegmentID: 2,
+				Slug:      "other",
+				LayerID:   &fakeLayer.LayerID,
+			},
+			Source: models.SourceManual,
+		},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
+	userRepo.EXPECT().SelectUserForUpdate(fakeUser.UserID).Return(fakeUser, nil)
+	segmentRepo.EXPECT().SelectSegmentsBySlugs([]string{fakeSegment.Slug}).Return([]models.Segment{*fakeSegment}, nil)
+	segmentRepo.EXPECT().SelectSegmentsByUser(fakeUser.UserID).Return(fakeUserSegments, nil)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return([]models.Segment{}, nil)
+	layerRepo.EXPECT().SelectLayerByID(fakeLayer.LayerID).Return(fakeLayer, nil)
+
+	_, err := segmentUC.EditUserSegments(fakeUser.UserID, segmentsToAdd, []string{}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrLayerConflict {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrLayerConflict, causeErr)
+	}
+}
+
+func TestUseCase_GetUserSegmentsByRule(t *testing.T) {
+	cfg := createConfig()
+
+	rule := `city in ["Moscow", "Kazan"] and platform == "ios"`
+	otherRule := `platform == "android"`
+	fakeUser := &models.User{
+		UserID:     1,
+		Username:   "test",
+		Attributes: map[string]string{"city": "Kazan", "platform": "ios"},
+	}
+	dynamicSegments := []models.Segment{
+		{
+			SegmentID: 1,
+			Slug:      "matching",
+			Salt:      "matching",
+			Rule:      &rule,
+		},
+		{
+			SegmentID: 2,
+			Slug:      "other",
+			Salt:      "other",
+			Rule:      &otherRule,
+		},
+	}
+	expected := []models.UserSegment{
+		{
+			Segment: dynamicSegments[0],
+			Source:  models.SourceRule,
+		},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
+	segmentRepo.EXPECT().SelectSegmentsByUser(fakeUser.UserID).Return([]models.UserSegment{}, nil)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return(dynamicSegments, nil)
+	response, err := segmentUC.GetUserSegments(fakeUser.UserID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, expected, response)
+	}
+}
+
+func TestUseCase_GetSegments(t *testing.T) {
+	cfg := createConfig()
+
+	members, ruleMembers := int64(2), int64(0)
+	rule := `city == "Moscow"`
+	fakeSegments := []models.SegmentSummary{
+		{
+			Segment: models.Segment{
+				SegmentID: 1,
+				Slug:      "test",
+			},
+			Members: &members,
+		},
+		{
+			Segment: models.Segment{
+				SegmentID: 2,
+				Slug:      "moscow",
+				Rule:      &rule,
+			},
+			Members: &ruleMembers,
+		},
+	}
+	expected := []models.SegmentSummary{fakeSegments[0], fakeSegments[1]}
+	expected[1].Members = nil
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentSummaries().Return(fakeSegments, nil)
+	response, err := segmentUC.GetSegments()
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, expected, response)
+	}
+}
+
+func TestUseCase_GetSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+
+	fakeSegment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "test",
+	}
+	form := models.FormSegmentUsers{
+		Slug:   fakeSegment.Slug,
+		Source: models.SourceManual,
+		Cursor: 10,
+		Limit:  2,
+	}
+	filter := models.SegmentUsersFilter{
+		Source:      models.SourceManual,
+		AfterUserID: 10,
+		Limit:       3,
+	}
+	fakeUsers := []models.SegmentUser{
+		{UserID: 11, Source: models.SourceManual},
+		{UserID: 12, Source: models.SourceManual},
+		{UserID: 13, Source: models.SourceManual},
+	}
+	expected := &models.SegmentUsersResponse{
+		Users:      fakeUsers[:2],
+		Count:      5,
+		NextCursor: "12",
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	segmentRepo.EXPECT().SelectSegmentUsers(fakeSegment.SegmentID, filter).Return(fakeUsers, nil)
+	segmentRepo.EXPECT().CountSegmentUsers(fakeSegment.SegmentID, filter).Return(int64(5), nil)
+	response, err := segmentUC.GetSegmentUsers(form)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, expected, response)
+	}
+}
+
+func TestUseCase_GetRuleSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+
+	rule := `city == "Moscow"`
+	fakeSegment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "moscow",
+		Rule:      &rule,
+	}
+	form := models.FormSegmentUsers{
+		Slug:  fakeSegment.Slug,
+		Limit: 2,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	_, err := segmentUC.GetSegmentUsers(form)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrRuleSegmentMembers {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrRuleSegmentMembers, causeErr)
+	}
+}
+
+func TestUseCase_AddSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.BatchSize = 2
+	change := models.Change{RequestID: "request-1"}
+
+	fakeLayer := &models.Layer{
+		LayerID:   1,
+		Name:      "checkout",
+		Salt:      "checkout",
+		Exclusive: true,
+	}
+	fakeSegment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "test",
+		Salt:      "test",
+		LayerID:   &fakeLayer.LayerID,
+	}
+	rule := `platform == "ios"`
+	fakeLayerSegments := []models.Segment{
+		*fakeSegment,
+		{
+			SegmentID: 2,
+			Slug:      "other",
+			LayerID:   &fakeLayer.LayerID,
+		},
+		{
+			SegmentID: 3,
+			Slug:      "ios",
+			Rule:      &rule,
+			LayerID:   &fakeLayer.LayerID,
+		},
+	}
+	fakeUsers := []models.User{
+		{UserID: 1, Attributes: map[string]string{"platform": "android"}},
+		{UserID: 3, Attributes: map[string]string{"platform": "android"}},
+		{UserID: 4, Attributes: map[string]string{"platform": "ios"}},
+		{UserID: 5, Attributes: map[string]string{"platform": "android"}},
+	}
+	until := "2023-09-01T12:00:00Z"
+	form := models.FormSegmentUsersBulk{
+		UserIDs: []uint64{1, 2, 1, 3, 4, 5},
+		Until:   &until,
+		Source:  models.SourceImport,
+	}
+	expected := &models.SegmentUsersBulkResponse{
+		Processed:   2,
+		Unknown:     []uint64{2},
+		Conflicting: []uint64{3, 4},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	layerRepo.EXPECT().SelectLayerByID(fakeLayer.LayerID).Return(fakeLayer, nil)
+	segmentRepo.EXPECT().SelectSegmentsByLayer(fakeLayer.LayerID).Return(fakeLayerSegments, nil)
+	gomock.InOrder(
+		userRepo.EXPECT().SelectUsersForUpdate([]uint64{1, 2}).Return(fakeUsers[:1], nil),
+		segmentRepo.EXPECT().SelectMemberIDs([]uint64{2, 3}, []uint64{1}).Return([]uint64{}, nil),
+		segmentRepo.EXPECT().AddUsersToSegment(fakeSegment.SegmentID, pkg.SegmentMembers(fakeSegment, []uint64{1}),
+			&until, models.SourceImport, change).Return(nil),
+		userRepo.EXPECT().SelectUsersForUpdate([]uint64{3, 4}).Return(fakeUsers[1:3], nil),
+		segmentRepo.EXPECT().SelectMemberIDs([]uint64{2, 3}, []uint64{3, 4}).Return([]uint64{3}, nil),
+		userRepo.EXPECT().SelectUsersForUpdate([]uint64{5}).Return(fakeUsers[3:], nil),
+		segmentRepo.EXPECT().SelectMemberIDs([]uint64{2, 3}, []uint64{5}).Return([]uint64{}, nil),
+		segmentRepo.EXPECT().AddUsersToSegment(fakeSegment.SegmentID, pkg.SegmentMembers(fakeSegment, []uint64{5}),
+			&until, models.SourceImport, change).Return(nil),
+	)
+	response, err := segmentUC.AddSegmentUsers(fakeSegment.Slug, form, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, expected, response)
+	}
+}
+
+func TestUseCase_AddSegmentUsersArchived(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	archivedAt := time.Now()
+	fakeSegment := &models.Segment{
+		SegmentID:  1,
+		Slug:       "test",
+		ArchivedAt: &archivedAt,
+	}
+	form := models.FormSegmentUsersBulk{
+		UserIDs: []uint64{1},
+		Source:  models.SourceImport,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	_, err := segmentUC.AddSegmentUsers(fakeSegment.Slug, form, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrSegmentArchived {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrSegmentArchived, causeErr)
+	}
+}
+
+func TestUseCase_RemoveSegmentUsersArchived(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	archivedAt := time.Now()
+	fakeSegment := &models.Segment{
+		SegmentID:  1,
+		Slug:       "test",
+		ArchivedAt: &archivedAt,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	_, err := segmentUC.RemoveSegmentUsers(fakeSegment.Slug, []uint64{1}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrSegmentArchived {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrSegmentArchived, causeErr)
+	}
+}
+
+func TestUseCase_RemoveSegmentUsers(t *testing.T) {
+	cfg := createConfig()
+	cfg.Bulk.BatchSize = 1000
+	change := models.Change{RequestID: "request-1"}
+
+	fakeSegment := &models.Segment{
+		SegmentID: 1,
+		Slug:      "test",
+	}
+	expected := &models.SegmentUsersBulkResponse{
+		Processed:   2,
+		Unknown:     []uint64{5},
+		Conflicting: []uint64{},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeSegment.Slug).Return(fakeSegment, nil)
+	userRepo.EXPECT().SelectExistingUserIDs([]uint64{1, 5, 2}).Return([]uint64{1, 2}, nil)
+	segmentRepo.EXPECT().DeleteUsersFromSegment(fakeSegment.SegmentID, []uint64{1, 2}, change).Return(nil)
+	response, err := segmentUC.RemoveSegmentUsers(fakeSegment.Slug, []uint64{1, 5, 2, 5}, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, expected, response)
+	}
+}
+
+func TestUseCase_GetUsersSegments(t *testing.T) {
+	cfg := createConfig()
+
+	rule := `platform == "ios"`
+	fakeUsers := []models.User{
+		{
+			UserID:     1,
+			Username:   "ios",
+			Attributes: map[string]string{"platform": "ios"},
+		},
+		{
+			UserID:     2,
+			Username:   "android",
+			Attributes: map[string]string{"platform": "android"},
+		},
+	}
+	storedSegment := models.UserSegment{
+		Segment: models.Segment{
+			SegmentID: 1,
+			Slug:      "stored",
+		},
+		Source: models.SourceManual,
+	}
+	dynamicSegments := []models.Segment{
+		{
+			SegmentID: 2,
+			Slug:      "ios",
+			Salt:      "ios",
+			Rule:      &rule,
+		},
+	}
+	expected := &models.UsersSegmentsResponse{
+		Users: map[uint64][]models.UserSegment{
+			1: {
+				{
+					Segment: dynamicSegments[0],
+					Source:  models.SourceRule,
+				},
+			},
+			2: {storedSegment},
+		},
+		Unknown: []uint64{3},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	userRepo.EXPECT().SelectUsersByIDs([]uint64{1, 3, 2}).Return(fakeUsers, nil)
+	segmentRepo.EXPECT().SelectSegmentsByUsers([]uint64{1, 2}).
+		Return(map[uint64][]models.UserSegment{2: {storedSegment}}, nil)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return(dynamicSegments, nil)
+	response, err := segmentUC.GetUsersSegments([]uint64{1, 3, 2, 1})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, expected, response)
+	}
+}
+
+func TestUseCase_EditUserSegmentsContradiction(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	segmentsToAdd := []models.AddUserToSegment{
+		{SegmentSlug: "first", Source: models.SourceManual},
+		{SegmentSlug: "second", Source: models.SourceManual},
+		{SegmentSlug: "first", Source: models.SourceManual},
+	}
+	segmentsToRemove := []string{"second", "third"}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	_, err := segmentUC.EditUserSegments(1, segmentsToAdd, segmentsToRemove, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrSegmentsContradict {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrSegmentsContradict, causeErr)
+	} else {
+		require.Equal(t, []string{"first", "second"}, errors.Details(err))
+	}
+}
+
+func TestUseCase_EditUserSegmentsUnknownSlugs(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	var fakeUser *models.User
+	generateFakeData(&fakeUser)
+	segmentsToAdd := []models.AddUserToSegment{
+		{SegmentSlug: "known", Source: models.SourceManual},
+		{SegmentSlug: "missing", Source: models.SourceManual},
+	}
+	segmentsToRemove := []string{"gone"}
+	fakeSegments := []models.Segment{
+		{
+			SegmentID: 1,
+			Slug:      "known",
+		},
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
+	segmentRepo.EXPECT().SelectSegmentsBySlugs([]string{"known", "missing", "gone"}).Return(fakeSegments, nil)
+
+	_, err := segmentUC.EditUserSegments(fakeUser.UserID, segmentsToAdd, segmentsToRemove, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrSegmentNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrSegmentNotFound, causeErr)
+	} else {
+		require.Equal(t, []string{"missing", "gone"}, errors.Details(err))
+	}
+}
+
+func TestUseCase_CreateSegmentEnrollFailed(t *testing.T) {
+	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
+
+	percent := 50
+	fakeForm := models.FormSegment{
+		Slug:    "rollout",
+		Percent: &percent,
+	}
+	fakeSegment := &models.Segment{
+		Slug:    fakeForm.Slug,
+		Salt:    fakeForm.Slug,
+		Percent: &percent,
+	}
+
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
+	layerRepo := mockLayerRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo})
+	segmentUC := New(cfg, uow, segmentRepo, userRepo, layerRepo)
+
+	segmentRepo.EXPECT().SelectSegmentBySlug(fakeForm.Slug).Return(nil, errors.ErrSegmentNotFound)
+	segmentRepo.EXPECT().InsertSegment(fakeSegment).Return(uint64(1), nil)
+	userRepo.EXPECT().SelectUserIDs().Return([]uint64{1, 2, 3}, nil)
+	segmentRepo.EXPECT().InsertUsersToSegment(uint64(1), gomock.Any(), change).Return(errors.ErrInternal)
+	response, err := segmentUC.CreateSegment(fakeForm, change)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrInternal {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrInternal, causeErr)
+	} else {
+		require.Nil(t, response)
 	}
 }
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
+	"sync"
+)
+
+// Snapshotter is implemented by in-memory repositories whose state can be saved and put back.
+type Snapshotter interface {
+	Snapshot() any
+	Restore(snapshot any)
+}
+
+type unitOfWork struct {
+	mu     sync.Mutex
+	repos  transaction.Repositories
+	stores []Snapshotter
+}
+
+// New fails when one of the given repositories is not a Snapshotter, because its changes could not be
+// discarded; repositories left nil are not used by the unit of work.
+func New(repos transaction.Repositories) (transaction.UnitOfWorkI, error) {
+	uow := &unitOfWork{
+		repos: repos,
+	}
+
+	for _, repo := range []any{repos.Users, repos.Segments, repos.History, repos.Layers} {
+		if repo == nil {
+			continue
+		}
+
+		store, ok := repo.(Snapshotter)
+		if !ok {
+			return nil, pkgErrors.Errorf("repository %T cannot be snapshotted", repo)
+		}
+		uow.stores = append(uow.stores, store)
+	}
+
+	return uow, nil
+}
+
+// Do runs units of work one at a time over the same repositories, which are restored when fn fails.
+func (uow *unitOfWork) Do(fn func(repos transaction.Repositories) error) error {
+	uow.mu.Lock()
+	defer uow.mu.Unlock()
+
+	snapshots := make([]any, len(uow.stores))
+	for idx, store := range uow.stores {
+		snapshots[idx] = store.Snapshot()
+	}
+
+	err := fn(uow.repos)
+	if err != nil {
+		for idx := len(uow.stores) - 1; idx >= 0; idx-- {
+			uow.stores[idx].Restore(snapshots[idx])
+		}
+		return err
+	}
+
+	return nil
+}
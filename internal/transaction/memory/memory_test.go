@@ -0,0 +1,96 @@
+package memory
+
+import (
+	pkgErr "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
+	userRepository "github.com/vvinokurshin/AvitoInternship/internal/user/repository"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"testing"
+)
+
+// userStore keeps users in a map and implements only the methods used by the tests.
+type userStore struct {
+	userRepository.RepositoryI
+	users map[uint64]models.User
+}
+
+func (store *userStore) InsertUser(user *models.User) (uint64, error) {
+	userID := uint64(len(store.users) + 1)
+	store.users[userID] = *user
+
+	return userID, nil
+}
+
+func (store *userStore) Snapshot() any {
+	users := make(map[uint64]models.User, len(store.users))
+	for userID, user := range store.users {
+		users[userID] = user
+	}
+
+	return users
+}
+
+func (store *userStore) Restore(snapshot any) {
+	store.users = snapshot.(map[uint64]models.User)
+}
+
+func TestUnitOfWork_Do(t *testing.T) {
+	store := &userStore{users: map[uint64]models.User{}}
+	uow, err := New(transaction.Repositories{Users: store})
+	if err != nil {
+		t.Fatalf("error while creating unit of work: %v", err)
+	}
+
+	err = uow.Do(func(repos transaction.Repositories) error {
+		_, err := repos.Users.InsertUser(&models.User{Username: "user"})
+		return err
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, map[uint64]models.User{1: {Username: "user"}}, store.users)
+	}
+}
+
+func TestUnitOfWork_DoRollback(t *testing.T) {
+	store := &userStore{users: map[uint64]models.User{1: {Username: "user"}}}
+	uow, err := New(transaction.Repositories{Users: store})
+	if err != nil {
+		t.Fatalf("error while creating unit of work: %v", err)
+	}
+
+	err = uow.Do(func(repos transaction.Repositories) error {
+		_, err := repos.Users.InsertUser(&models.User{Username: "other"})
+		if err != nil {
+			return err
+		}
+
+		return errors.ErrSegmentNotFound
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrSegmentNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrSegmentNotFound, causeErr)
+	} else {
+		require.Equal(t, map[uint64]models.User{1: {Username: "user"}}, store.users)
+	}
+}
+
+// segmentStore cannot be snapshotted, so the changes made through it could not be discarded.
+type segmentStore struct {
+	segmentRepository.RepositoryI
+}
+
+func TestUnitOfWork_NewWithoutSnapshot(t *testing.T) {
+	store := &userStore{users: map[uint64]models.User{}}
+	_, err := New(transaction.Repositories{Users: store, Segments: &segmentStore{}})
+
+	if err == nil {
+		t.Errorf("[TEST] simple: expected err, got \"%v\"", err)
+	}
+}
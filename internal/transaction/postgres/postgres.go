@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository/postgres"
+	layerRepository "github.com/vvinokurshin/AvitoInternship/internal/layer/repository/postgres"
+	"github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
+	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository/postgres"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
+	userRepository "github.com/vvinokurshin/AvitoInternship/internal/user/repository/postgres"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type unitOfWork struct {
+	cfg      *config.Config
+	db       *gorm.DB
+	segments repository.RepositoryI
+}
+
+// New takes the segment repository created at startup, the ones bound to transactions share its timers.
+func New(cfg *config.Config, db *gorm.DB, segments repository.RepositoryI) transaction.UnitOfWorkI {
+	return &unitOfWork{
+		cfg:      cfg,
+		db:       db,
+		segments: segments,
+	}
+}
+
+// Do runs fn in a database transaction. Repository methods that open transactions of their own
+// get savepoints inside it.
+func (uow *unitOfWork) Do(fn func(repos transaction.Repositories) error) error {
+	var fnErr error
+	err := uow.db.Transaction(func(tx *gorm.DB) error {
+		fnErr = fn(transaction.Repositories{
+			Users:    userRepository.New(uow.cfg, tx),
+			Segments: segmentRepository.NewTx(uow.segments, tx),
+			History:  historyRepository.New(uow.cfg, tx),
+			Layers:   layerRepository.New(uow.cfg, tx),
+		})
+
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return nil
+}
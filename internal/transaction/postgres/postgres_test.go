@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	pkgErr "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository/postgres"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository/postgres"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"regexp"
+	"testing"
+)
+
+func createConfig() *config.Config {
+	cfg := new(config.Config)
+	cfg.DB.DBSchemaName = "app"
+	cfg.DB.DBUserTableName = "users"
+
+	return cfg
+}
+
+func mockDB() (*sql.DB, *gorm.DB, sqlmock.Sqlmock, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("mocking database error: %s", err)
+	}
+
+	dialector := postgres.New(postgres.Config{
+		DSN:                  "sqlmock_db_0",
+		DriverName:           "postgres",
+		Conn:                 db,
+		PreferSimpleProtocol: true,
+	})
+	gormDB, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("opening gorm error: %s", err)
+	}
+
+	return db, gormDB, mock, nil
+}
+
+const insertUserQuery = `INSERT INTO "app"."users" ("username","first_name","last_name","attributes")
+	VALUES ($1,$2,$3,$4) RETURNING "user_id"`
+
+func newUnitOfWork(t *testing.T, cfg *config.Config, db *gorm.DB) transaction.UnitOfWorkI {
+	segments, err := segmentRepository.New(cfg, db, historyRepository.NewWriter(cfg))
+	if err != nil {
+		t.Fatalf("error while creating segment repository: %s", err)
+	}
+
+	return New(cfg, db, segments)
+}
+
+func TestUnitOfWork_Do(t *testing.T) {
+	cfg := createConfig()
+	user := &models.User{Username: "user"}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(insertUserQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	var userID uint64
+	err = newUnitOfWork(t, cfg, gormDB).Do(func(repos transaction.Repositories) error {
+		userID, err = repos.Users.InsertUser(user)
+		return err
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, uint64(1), userID)
+		require.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestUnitOfWork_DoRollback(t *testing.T) {
+	cfg := createConfig()
+	user := &models.User{Username: "user"}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(insertUserQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectRollback()
+
+	err = newUnitOfWork(t, cfg, gormDB).Do(func(repos transaction.Repositories) error {
+		_, err := repos.Users.InsertUser(user)
+		if err != nil {
+			return err
+		}
+
+		return errors.ErrSegmentNotFound
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrSegmentNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrSegmentNotFound, causeErr)
+	} else {
+		require.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestUnitOfWork_DoCommitFailed(t *testing.T) {
+	cfg := createConfig()
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("connection lost"))
+
+	err = newUnitOfWork(t, cfg, gormDB).Do(func(repos transaction.Repositories) error {
+		return nil
+	})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != errors.ErrInternal {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", errors.ErrInternal, causeErr)
+	}
+}
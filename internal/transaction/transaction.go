@@ -0,0 +1,24 @@
+package transaction
+
+import (
+	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository"
+	layerRepository "github.com/vvinokurshin/AvitoInternship/internal/layer/repository"
+	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
+	userRepository "github.com/vvinokurshin/AvitoInternship/internal/user/repository"
+)
+
+//go:generate mockgen -destination=./mocks/transaction.go -source=./transaction.go -package=mocks
+
+// Repositories are bound to one unit of work: changes made through them are kept or discarded together.
+type Repositories struct {
+	Users    userRepository.RepositoryI
+	Segments segmentRepository.RepositoryI
+	History  historyRepository.RepositoryI
+	Layers   layerRepository.RepositoryI
+}
+
+type UnitOfWorkI interface {
+	// Do passes repositories bound to a new unit of work to fn. The changes are kept if fn returns nil
+	// and discarded otherwise, in which case the error of fn is returned as is.
+	Do(fn func(repos Repositories) error) error
+}
@@ -40,6 +40,8 @@ func New(cfg *config.Config, uc userUC.UseCaseI) DeliveryI {
 // @Accept	 application/json
 // @Produce  application/json
 // @Param    segment body models.FormUser true "form user"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
 // @Success 200 {object} models.UserResponse "user created"
 // @Failure 400 {object} errors.JSONError "invalid form"
 // @Failure 409 {object} errors.JSONError "user with this nickname already exists"
@@ -58,7 +60,7 @@ func (d *Delivery) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := d.uc.CreateUser(form)
+	response, err := d.uc.CreateUser(form, pkg.RequestChange(r))
 	if err != nil {
 		pkg.HandleError(w, r, err)
 		return
@@ -122,6 +124,9 @@ func (d *Delivery) EditUser(w http.ResponseWriter, r *http.Request) {
 // @Accept	 application/json
 // @Produce  application/json
 // @Param id path int true "id"
+// @Param X-Actor header string false "identity of the caller recorded in history"
+// @Param X-Request-ID header string false "request ID recorded in history"
+// @Param reason query string false "reason or ticket recorded in history"
 // @Success 200 "user deleted"
 // @Failure 400 {object} errors.JSONError "invalid url"
 // @Failure 404 {object} errors.JSONError "user not found"
@@ -135,7 +140,7 @@ func (d *Delivery) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = d.uc.DeleteUser(userID)
+	err = d.uc.DeleteUser(userID, pkg.RequestChange(r))
 	if err != nil {
 		pkg.HandleError(w, r, err)
 		return
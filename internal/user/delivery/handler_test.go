@@ -70,7 +70,7 @@ func TestDelivery_CreateUser(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/user/create", bytes.NewReader(body))
 	w := httptest.NewRecorder()
 
-	userUC.EXPECT().CreateUser(fakeForm).Return(fakeUserResponse, nil)
+	userUC.EXPECT().CreateUser(fakeForm, models.Change{}).Return(fakeUserResponse, nil)
 	userH.CreateUser(w, r)
 
 	if w.Code != status {
@@ -141,7 +141,7 @@ func TestDelivery_DeleteUser(t *testing.T) {
 	r = mux.SetURLVars(r, vars)
 	w := httptest.NewRecorder()
 
-	userUC.EXPECT().DeleteUser(userID).Return(nil)
+	userUC.EXPECT().DeleteUser(userID, models.Change{}).Return(nil)
 	userH.DeleteUser(w, r)
 
 	if w.Code != status {
@@ -48,34 +48,34 @@ func (mr *MockRepositoryIMockRecorder) DeleteUser(userID interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepositoryI)(nil).DeleteUser), userID)
 }
 
-// GetUserIDs mocks base method.
-func (m *MockRepositoryI) SelectUserIDs() ([]uint64, error) {
+// InsertUser mocks base method.
+func (m *MockRepositoryI) InsertUser(user *models.User) (uint64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectUserIDs")
-	ret0, _ := ret[0].([]uint64)
+	ret := m.ctrl.Call(m, "InsertUser", user)
+	ret0, _ := ret[0].(uint64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserIDs indicates an expected call of GetUserIDs.
-func (mr *MockRepositoryIMockRecorder) GetUserIDs() *gomock.Call {
+// InsertUser indicates an expected call of InsertUser.
+func (mr *MockRepositoryIMockRecorder) InsertUser(user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserIDs", reflect.TypeOf((*MockRepositoryI)(nil).SelectUserIDs))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUser", reflect.TypeOf((*MockRepositoryI)(nil).InsertUser), user)
 }
 
-// InsertUser mocks base method.
-func (m *MockRepositoryI) InsertUser(user *models.User) (uint64, error) {
+// SelectExistingUserIDs mocks base method.
+func (m *MockRepositoryI) SelectExistingUserIDs(userIDs []uint64) ([]uint64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertUser", user)
-	ret0, _ := ret[0].(uint64)
+	ret := m.ctrl.Call(m, "SelectExistingUserIDs", userIDs)
+	ret0, _ := ret[0].([]uint64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// InsertUser indicates an expected call of InsertUser.
-func (mr *MockRepositoryIMockRecorder) InsertUser(user interface{}) *gomock.Call {
+// SelectExistingUserIDs indicates an expected call of SelectExistingUserIDs.
+func (mr *MockRepositoryIMockRecorder) SelectExistingUserIDs(userIDs interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUser", reflect.TypeOf((*MockRepositoryI)(nil).InsertUser), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectExistingUserIDs", reflect.TypeOf((*MockRepositoryI)(nil).SelectExistingUserIDs), userIDs)
 }
 
 // SelectUserByID mocks base method.
@@ -108,6 +108,66 @@ func (mr *MockRepositoryIMockRecorder) SelectUserByUsername(username interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserByUsername", reflect.TypeOf((*MockRepositoryI)(nil).SelectUserByUsername), username)
 }
 
+// SelectUserForUpdate mocks base method.
+func (m *MockRepositoryI) SelectUserForUpdate(userID uint64) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserForUpdate", userID)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserForUpdate indicates an expected call of SelectUserForUpdate.
+func (mr *MockRepositoryIMockRecorder) SelectUserForUpdate(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserForUpdate", reflect.TypeOf((*MockRepositoryI)(nil).SelectUserForUpdate), userID)
+}
+
+// SelectUserIDs mocks base method.
+func (m *MockRepositoryI) SelectUserIDs() ([]uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserIDs")
+	ret0, _ := ret[0].([]uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserIDs indicates an expected call of SelectUserIDs.
+func (mr *MockRepositoryIMockRecorder) SelectUserIDs() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserIDs", reflect.TypeOf((*MockRepositoryI)(nil).SelectUserIDs))
+}
+
+// SelectUsersByIDs mocks base method.
+func (m *MockRepositoryI) SelectUsersByIDs(userIDs []uint64) ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUsersByIDs", userIDs)
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUsersByIDs indicates an expected call of SelectUsersByIDs.
+func (mr *MockRepositoryIMockRecorder) SelectUsersByIDs(userIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUsersByIDs", reflect.TypeOf((*MockRepositoryI)(nil).SelectUsersByIDs), userIDs)
+}
+
+// SelectUsersForUpdate mocks base method.
+func (m *MockRepositoryI) SelectUsersForUpdate(userIDs []uint64) ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUsersForUpdate", userIDs)
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUsersForUpdate indicates an expected call of SelectUsersForUpdate.
+func (mr *MockRepositoryIMockRecorder) SelectUsersForUpdate(userIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUsersForUpdate", reflect.TypeOf((*MockRepositoryI)(nil).SelectUsersForUpdate), userIDs)
+}
+
 // UpdateUser mocks base method.
 func (m *MockRepositoryI) UpdateUser(user *models.User) error {
 	m.ctrl.T.Helper()
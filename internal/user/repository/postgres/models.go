@@ -6,10 +6,11 @@ import (
 )
 
 type User struct {
-	UserID    uint64 `gorm:"primary_key"`
-	Username  string
-	FirstName string
-	LastName  string
+	UserID     uint64 `gorm:"primary_key"`
+	Username   string
+	FirstName  string
+	LastName   string
+	Attributes map[string]string `gorm:"serializer:json"`
 }
 
 func (User) TableName(schemaName, tableName string) string {
@@ -21,13 +22,19 @@ func (u *User) FromUserModel(user *models.User) {
 	u.Username = user.Username
 	u.FirstName = user.FirstName
 	u.LastName = user.LastName
+	u.Attributes = user.Attributes
+	// the column is NOT NULL, while a nil map would be serialized as NULL
+	if u.Attributes == nil {
+		u.Attributes = map[string]string{}
+	}
 }
 
 func (u *User) ToUserModel() (user *models.User) {
 	return &models.User{
-		UserID:    u.UserID,
-		Username:  u.Username,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
+		UserID:     u.UserID,
+		Username:   u.Username,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		Attributes: u.Attributes,
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/vvinokurshin/AvitoInternship/internal/user/repository"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepo struct {
@@ -72,6 +73,56 @@ func (repo *userRepo) SelectUserByID(userID uint64) (*models.User, error) {
 	return dbUser.ToUserModel(), nil
 }
 
+func (repo *userRepo) SelectUserForUpdate(userID uint64) (*models.User, error) {
+	var dbUser User
+
+	tx := repo.db.Table(User{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBUserTableName)).
+		Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).Take(&dbUser)
+	if err := tx.Error; err != nil {
+		if pkgErrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrUserNotFound
+		}
+
+		return nil, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return dbUser.ToUserModel(), nil
+}
+
+func (repo *userRepo) SelectUsersForUpdate(userIDs []uint64) ([]models.User, error) {
+	var dbUsers []User
+
+	tx := repo.db.Table(User{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBUserTableName)).
+		Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id IN ?", userIDs).Order("user_id").Find(&dbUsers)
+	if err := tx.Error; err != nil {
+		return []models.User{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.User, len(dbUsers))
+	for idx, dbUser := range dbUsers {
+		result[idx] = *dbUser.ToUserModel()
+	}
+
+	return result, nil
+}
+
+func (repo *userRepo) SelectUsersByIDs(userIDs []uint64) ([]models.User, error) {
+	var dbUsers []User
+
+	tx := repo.db.Table(User{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBUserTableName)).
+		Where("user_id IN ?", userIDs).Find(&dbUsers)
+	if err := tx.Error; err != nil {
+		return []models.User{}, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	result := make([]models.User, len(dbUsers))
+	for idx, dbUser := range dbUsers {
+		result[idx] = *dbUser.ToUserModel()
+	}
+
+	return result, nil
+}
+
 func (repo *userRepo) SelectUserByUsername(username string) (*models.User, error) {
 	var dbUser User
 
@@ -98,3 +149,16 @@ func (repo *userRepo) SelectUserIDs() ([]uint64, error) {
 
 	return IDs, nil
 }
+
+// SelectExistingUserIDs returns those of the user IDs that belong to existing users.
+func (repo *userRepo) SelectExistingUserIDs(userIDs []uint64) ([]uint64, error) {
+	var IDs []uint64
+
+	tx := repo.db.Table(User{}.TableName(repo.cfg.DB.DBSchemaName, repo.cfg.DB.DBUserTableName)).Select("user_id").
+		Where("user_id IN ?", userIDs).Find(&IDs)
+	if err := tx.Error; err != nil {
+		return IDs, pkgErrors.WithMessage(errors.ErrInternal, err.Error())
+	}
+
+	return IDs, nil
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/go-faker/faker/v4"
 	pkgErr "github.com/pkg/errors"
@@ -67,8 +68,9 @@ func TestRepository_InsertUser(t *testing.T) {
 		AddRow(fakeUser.UserID)
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."users" ("username","first_name","last_name","user_id")
-	VALUES ($1,$2,$3,$4) RETURNING "user_id"`)).WithArgs(fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, fakeUser.UserID).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."users" ("username","first_name","last_name","attributes","user_id")
+	VALUES ($1,$2,$3,$4,$5) RETURNING "user_id"`)).WithArgs(fakeUser.Username, fakeUser.FirstName, fakeUser.LastName,
+		sqlmock.AnyArg(), fakeUser.UserID).
 		WillReturnRows(createUserRow)
 	mock.ExpectCommit()
 
@@ -83,6 +85,37 @@ func TestRepository_InsertUser(t *testing.T) {
 	}
 }
 
+func TestRepository_InsertUserWithoutAttributes(t *testing.T) {
+	cfg := createConfig()
+
+	fakeUser := &models.User{
+		UserID:   1,
+		Username: "user",
+	}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "app"."users" ("username","first_name","last_name","attributes","user_id")
+	VALUES ($1,$2,$3,$4,$5) RETURNING "user_id"`)).WithArgs(fakeUser.Username, "", "", "{}", fakeUser.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(fakeUser.UserID))
+	mock.ExpectCommit()
+
+	userRep := New(cfg, gormDB)
+	userID, err := userRep.InsertUser(fakeUser)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUser.UserID, userID)
+	}
+}
+
 func TestRepository_UpdateUser(t *testing.T) {
 	cfg := createConfig()
 
@@ -96,8 +129,8 @@ func TestRepository_UpdateUser(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."users" SET "username"=$1,"first_name"=$2,"last_name"=$3 WHERE "user_id" = $4`)).
-		WithArgs(fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, fakeUser.UserID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "app"."users" SET "username"=$1,"first_name"=$2,"last_name"=$3,"attributes"=$4 WHERE "user_id" = $5`)).
+		WithArgs(fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, sqlmock.AnyArg(), fakeUser.UserID).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit()
 
 	userRep := New(cfg, gormDB)
@@ -146,8 +179,13 @@ func TestRepository_SelectUserByID(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name"}).
-		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName)
+	attributes, err := json.Marshal(fakeUser.Attributes)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name", "attributes"}).
+		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, attributes)
 
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users" WHERE user_id = $1`)).WithArgs(fakeUser.UserID).WillReturnRows(rows)
 
@@ -162,6 +200,75 @@ func TestRepository_SelectUserByID(t *testing.T) {
 	}
 }
 
+func TestRepository_SelectUserForUpdate(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeUser *models.User
+	generateFakeData(&fakeUser)
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	attributes, err := json.Marshal(fakeUser.Attributes)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name", "attributes"}).
+		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, attributes)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users" WHERE user_id = $1 LIMIT 1 FOR UPDATE`)).
+		WithArgs(fakeUser.UserID).WillReturnRows(rows)
+
+	userRep := New(cfg, gormDB)
+	response, err := userRep.SelectUserForUpdate(fakeUser.UserID)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUser, response)
+	}
+}
+
+func TestRepository_SelectUsersForUpdate(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeUser *models.User
+	generateFakeData(&fakeUser)
+	fakeUsers := []models.User{*fakeUser}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	attributes, err := json.Marshal(fakeUser.Attributes)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name", "attributes"}).
+		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, attributes)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users" WHERE user_id IN ($1,$2) ORDER BY user_id FOR UPDATE`)).
+		WithArgs(fakeUser.UserID, fakeUser.UserID+1).WillReturnRows(rows)
+
+	userRep := New(cfg, gormDB)
+	response, err := userRep.SelectUsersForUpdate([]uint64{fakeUser.UserID, fakeUser.UserID + 1})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUsers, response)
+	}
+}
+
 func TestRepository_SelectUserByUsername(t *testing.T) {
 	cfg := createConfig()
 
@@ -174,8 +281,13 @@ func TestRepository_SelectUserByUsername(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name"}).
-		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName)
+	attributes, err := json.Marshal(fakeUser.Attributes)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name", "attributes"}).
+		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, attributes)
 
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users" WHERE username = $1`)).WithArgs(fakeUser.Username).WillReturnRows(rows)
 
@@ -215,3 +327,66 @@ func TestRepository_GetUserIDs(t *testing.T) {
 		require.Equal(t, fakeUserIDs, response)
 	}
 }
+
+func TestRepository_SelectExistingUserIDs(t *testing.T) {
+	cfg := createConfig()
+
+	userIDs := []uint64{1, 2, 3}
+	fakeUserIDs := []uint64{1, 3}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id"}).AddRow(1).AddRow(3)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id FROM "app"."users" WHERE user_id IN ($1,$2,$3)`)).
+		WithArgs(userIDs[0], userIDs[1], userIDs[2]).WillReturnRows(rows)
+
+	userRep := New(cfg, gormDB)
+	response, err := userRep.SelectExistingUserIDs(userIDs)
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUserIDs, response)
+	}
+}
+
+func TestRepository_SelectUsersByIDs(t *testing.T) {
+	cfg := createConfig()
+
+	var fakeUser *models.User
+	generateFakeData(&fakeUser)
+	fakeUsers := []models.User{*fakeUser}
+
+	db, gormDB, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("error while mocking database: %s", err)
+	}
+	defer db.Close()
+
+	attributes, err := json.Marshal(fakeUser.Attributes)
+	if err != nil {
+		t.Fatalf("error while marshaling to json: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "username", "first_name", "last_name", "attributes"}).
+		AddRow(fakeUser.UserID, fakeUser.Username, fakeUser.FirstName, fakeUser.LastName, attributes)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "app"."users" WHERE user_id IN ($1,$2)`)).
+		WithArgs(fakeUser.UserID, fakeUser.UserID+1).WillReturnRows(rows)
+
+	userRep := New(cfg, gormDB)
+	response, err := userRep.SelectUsersByIDs([]uint64{fakeUser.UserID, fakeUser.UserID + 1})
+	causeErr := pkgErr.Cause(err)
+
+	if causeErr != nil {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", nil, causeErr)
+	} else {
+		require.Equal(t, fakeUsers, response)
+	}
+}
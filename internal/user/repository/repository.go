@@ -9,6 +9,14 @@ type RepositoryI interface {
 	UpdateUser(user *models.User) error
 	DeleteUser(userID uint64) error
 	SelectUserByID(userID uint64) (*models.User, error)
+	// SelectUserForUpdate locks the user row until the end of the transaction the repository is bound to,
+	// so changes of the user's memberships checked against its current ones are made one after another.
+	SelectUserForUpdate(userID uint64) (*models.User, error)
+	// SelectUsersForUpdate locks the rows of the existing users among the IDs in the order of their IDs,
+	// so batches sharing users wait for each other instead of deadlocking.
+	SelectUsersForUpdate(userIDs []uint64) ([]models.User, error)
 	SelectUserByUsername(username string) (*models.User, error)
+	SelectUsersByIDs(userIDs []uint64) ([]models.User, error)
 	SelectUserIDs() ([]uint64, error)
+	SelectExistingUserIDs(userIDs []uint64) ([]uint64, error)
 }
@@ -35,32 +35,32 @@ func (m *MockUseCaseI) EXPECT() *MockUseCaseIMockRecorder {
 }
 
 // CreateUser mocks base method.
-func (m *MockUseCaseI) CreateUser(form models.FormUser) (*models.User, error) {
+func (m *MockUseCaseI) CreateUser(form models.FormUser, change models.Change) (*models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", form)
+	ret := m.ctrl.Call(m, "CreateUser", form, change)
 	ret0, _ := ret[0].(*models.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateUser indicates an expected call of CreateUser.
-func (mr *MockUseCaseIMockRecorder) CreateUser(form interface{}) *gomock.Call {
+func (mr *MockUseCaseIMockRecorder) CreateUser(form, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUseCaseI)(nil).CreateUser), form)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUseCaseI)(nil).CreateUser), form, change)
 }
 
 // DeleteUser mocks base method.
-func (m *MockUseCaseI) DeleteUser(userID uint64) error {
+func (m *MockUseCaseI) DeleteUser(userID uint64, change models.Change) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUser", userID)
+	ret := m.ctrl.Call(m, "DeleteUser", userID, change)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUser indicates an expected call of DeleteUser.
-func (mr *MockUseCaseIMockRecorder) DeleteUser(userID interface{}) *gomock.Call {
+func (mr *MockUseCaseIMockRecorder) DeleteUser(userID, change interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUseCaseI)(nil).DeleteUser), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUseCaseI)(nil).DeleteUser), userID, change)
 }
 
 // EditUser mocks base method.
@@ -3,50 +3,98 @@ package usecase
 import (
 	pkgErr "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	historyRepository "github.com/vvinokurshin/AvitoInternship/internal/history/repository"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	segmentRepository "github.com/vvinokurshin/AvitoInternship/internal/segment/repository"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
 	"github.com/vvinokurshin/AvitoInternship/internal/user/repository"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 )
 
 //go:generate mockgen -destination=./mocks/usecase.go -source=./usecase.go -package=mocks
 
 type UseCaseI interface {
-	CreateUser(form models.FormUser) (*models.User, error)
+	CreateUser(form models.FormUser, change models.Change) (*models.User, error)
 	EditUser(userID uint64, form models.FormUser) (*models.User, error)
-	DeleteUser(userID uint64) error
+	DeleteUser(userID uint64, change models.Change) error
 	GetUserByID(userID uint64) (*models.User, error)
 }
 
 type UseCase struct {
-	cfg  *config.Config
-	repo repository.RepositoryI
+	cfg         *config.Config
+	uow         transaction.UnitOfWorkI
+	repo        repository.RepositoryI
+	segmentRepo segmentRepository.RepositoryI
+	historyRepo historyRepository.RepositoryI
 }
 
-func New(cfg *config.Config, repo repository.RepositoryI) UseCaseI {
+func New(cfg *config.Config, uow transaction.UnitOfWorkI, repo repository.RepositoryI,
+	segmentRepo segmentRepository.RepositoryI, historyRepo historyRepository.RepositoryI) UseCaseI {
 	return &UseCase{
-		cfg:  cfg,
-		repo: repo,
+		cfg:         cfg,
+		uow:         uow,
+		repo:        repo,
+		segmentRepo: segmentRepo,
+		historyRepo: historyRepo,
 	}
 }
 
-func (uc *UseCase) CreateUser(form models.FormUser) (*models.User, error) {
+func (uc *UseCase) CreateUser(form models.FormUser, change models.Change) (*models.User, error) {
 	_, err := uc.repo.SelectUserByUsername(form.Username)
 	if err != errors.ErrUserNotFound {
 		return nil, errors.ErrUserExists
 	}
 
 	user := &models.User{
-		Username:  form.Username,
-		FirstName: form.FirstName,
-		LastName:  form.LastName,
+		Username:   form.Username,
+		FirstName:  form.FirstName,
+		LastName:   form.LastName,
+		Attributes: form.Attributes,
 	}
 
-	userID, err := uc.repo.InsertUser(user)
+	dynamicSegments, err := uc.segmentRepo.SelectDynamicSegments()
 	if err != nil {
-		return nil, pkgErr.Wrap(err, "insert user")
+		return nil, pkgErr.Wrap(err, "select dynamic segments")
+	}
+
+	// the user is not created when its percentage memberships fail to be stored
+	err = uc.uow.Do(func(repos transaction.Repositories) error {
+		userID, err := repos.Users.InsertUser(user)
+		if err != nil {
+			return pkgErr.Wrap(err, "insert user")
+		}
+
+		user.UserID = userID
+
+		// rule-based segments depend on attributes that may change, so only pure percentage ones are stored
+		segmentsToAdd := make([]models.AddUserToSegment, 0)
+		for _, segment := range pkg.MatchingSegments(dynamicSegments, user) {
+			if segment.Rule != nil {
+				continue
+			}
+
+			segmentsToAdd = append(segmentsToAdd, models.AddUserToSegment{
+				SegmentSlug: segment.Slug,
+				SegmentID:   segment.SegmentID,
+				Source:      models.SourcePercentage,
+				Variant:     pkg.PickVariant(segment.Salt, userID, segment.Variants),
+			})
+		}
+
+		if len(segmentsToAdd) != 0 {
+			err = repos.Segments.InsertSegmentsToUser(userID, segmentsToAdd, change)
+			if err != nil {
+				return pkgErr.Wrap(err, "insert segments to user")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	user.UserID = userID
 	return user, nil
 }
 
@@ -67,6 +115,9 @@ func (uc *UseCase) EditUser(userID uint64, form models.FormUser) (*models.User,
 
 	user.FirstName = form.FirstName
 	user.LastName = form.LastName
+	if form.Attributes != nil {
+		user.Attributes = form.Attributes
+	}
 
 	err = uc.repo.UpdateUser(user)
 	if err != nil {
@@ -76,18 +127,36 @@ func (uc *UseCase) EditUser(userID uint64, form models.FormUser) (*models.User,
 	return user, nil
 }
 
-func (uc *UseCase) DeleteUser(userID uint64) error {
-	_, err := uc.repo.SelectUserByID(userID)
-	if err != nil {
-		return pkgErr.Wrap(err, "select user by ID")
-	}
+// DeleteUser removes the memberships of the user with a history record for each of them, then deletes the user.
+// The user row is locked first, so memberships added concurrently are either removed and logged here
+// or not added at all. History outlives the user and can be pseudonymised.
+func (uc *UseCase) DeleteUser(userID uint64, change models.Change) error {
+	// memberships, history and the user itself go away together or stay as they were
+	return uc.uow.Do(func(repos transaction.Repositories) error {
+		_, err := repos.Users.SelectUserForUpdate(userID)
+		if err != nil {
+			return pkgErr.Wrap(err, "select user for update")
+		}
 
-	err = uc.repo.DeleteUser(userID)
-	if err != nil {
-		return pkgErr.Wrap(err, "delete user")
-	}
+		err = repos.Segments.DeleteUserMemberships(userID, change)
+		if err != nil {
+			return pkgErr.Wrap(err, "delete user memberships")
+		}
+
+		if uc.cfg.History.PseudonymizeDeletedUsers {
+			err = repos.History.UpdateUserID(userID, pkg.Pseudonym(uc.cfg.History.PseudonymKey, userID))
+			if err != nil {
+				return pkgErr.Wrap(err, "pseudonymize history")
+			}
+		}
+
+		err = repos.Users.DeleteUser(userID)
+		if err != nil {
+			return pkgErr.Wrap(err, "delete user")
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func (uc *UseCase) GetUserByID(userID uint64) (*models.User, error) {
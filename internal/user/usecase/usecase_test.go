@@ -6,8 +6,13 @@ import (
 	pkgErr "github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	mockHistoryRepo "github.com/vvinokurshin/AvitoInternship/internal/history/repository/mocks"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	mockSegmentRepo "github.com/vvinokurshin/AvitoInternship/internal/segment/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/internal/transaction"
+	mockTransaction "github.com/vvinokurshin/AvitoInternship/internal/transaction/mocks"
 	mockUserRepo "github.com/vvinokurshin/AvitoInternship/internal/user/repository/mocks"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
 	"testing"
 )
@@ -16,6 +21,16 @@ func createConfig() *config.Config {
 	return new(config.Config)
 }
 
+// newUnitOfWork passes the mocks to fn as they are, the expectations of each test check what fn does with them.
+func newUnitOfWork(ctrl *gomock.Controller, repos transaction.Repositories) transaction.UnitOfWorkI {
+	uow := mockTransaction.NewMockUnitOfWorkI(ctrl)
+	uow.EXPECT().Do(gomock.Any()).DoAndReturn(func(fn func(repos transaction.Repositories) error) error {
+		return fn(repos)
+	}).AnyTimes()
+
+	return uow
+}
+
 func generateFakeData(data any) {
 	faker.SetRandomMapAndSliceMaxSize(10)
 	faker.SetRandomMapAndSliceMinSize(1)
@@ -26,19 +41,22 @@ func generateFakeData(data any) {
 
 func TestUseCase_CreateUser(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
 
 	var fakeForm models.FormUser
 	generateFakeData(&fakeForm)
 	fakeUser := &models.User{
-		Username:  fakeForm.Username,
-		FirstName: fakeForm.FirstName,
-		LastName:  fakeForm.LastName,
+		Username:   fakeForm.Username,
+		FirstName:  fakeForm.FirstName,
+		LastName:   fakeForm.LastName,
+		Attributes: fakeForm.Attributes,
 	}
 	fakeUserResponse := &models.User{
-		UserID:    1,
-		Username:  fakeForm.Username,
-		FirstName: fakeForm.FirstName,
-		LastName:  fakeForm.LastName,
+		UserID:     1,
+		Username:   fakeForm.Username,
+		FirstName:  fakeForm.FirstName,
+		LastName:   fakeForm.LastName,
+		Attributes: fakeForm.Attributes,
 	}
 
 	t.Parallel()
@@ -46,11 +64,15 @@ func TestUseCase_CreateUser(t *testing.T) {
 	defer ctrl.Finish()
 
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	userUC := New(cfg, userRepo)
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo, History: historyRepo})
+	userUC := New(cfg, uow, userRepo, segmentRepo, historyRepo)
 
 	userRepo.EXPECT().SelectUserByUsername(fakeForm.Username).Return(nil, errors.ErrUserNotFound)
 	userRepo.EXPECT().InsertUser(fakeUser).Return(uint64(1), nil)
-	response, err := userUC.CreateUser(fakeForm)
+	segmentRepo.EXPECT().SelectDynamicSegments().Return([]models.Segment{}, nil)
+	response, err := userUC.CreateUser(fakeForm, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -67,10 +89,11 @@ func TestUseCase_EditUser(t *testing.T) {
 	var fakeForm models.FormUser
 	generateFakeData(&fakeForm)
 	fakeUser := &models.User{
-		UserID:    userID,
-		Username:  fakeForm.Username,
-		FirstName: fakeForm.FirstName,
-		LastName:  fakeForm.LastName,
+		UserID:     userID,
+		Username:   fakeForm.Username,
+		FirstName:  fakeForm.FirstName,
+		LastName:   fakeForm.LastName,
+		Attributes: fakeForm.Attributes,
 	}
 
 	t.Parallel()
@@ -78,7 +101,10 @@ func TestUseCase_EditUser(t *testing.T) {
 	defer ctrl.Finish()
 
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	userUC := New(cfg, userRepo)
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo, History: historyRepo})
+	userUC := New(cfg, uow, userRepo, segmentRepo, historyRepo)
 
 	userRepo.EXPECT().SelectUserByID(userID).Return(fakeUser, nil)
 	userRepo.EXPECT().UpdateUser(fakeUser).Return(nil)
@@ -94,22 +120,30 @@ func TestUseCase_EditUser(t *testing.T) {
 
 func TestUseCase_DeleteUser(t *testing.T) {
 	cfg := createConfig()
+	change := models.Change{RequestID: "request-1"}
 
 	userID := uint64(1)
 	var fakeUser *models.User
 	generateFakeData(&fakeUser)
 	fakeUser.UserID = userID
+	cfg.History.PseudonymizeDeletedUsers = true
+	cfg.History.PseudonymKey = "secret"
 
 	t.Parallel()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	userUC := New(cfg, userRepo)
-
-	userRepo.EXPECT().SelectUserByID(userID).Return(fakeUser, nil)
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo, History: historyRepo})
+	userUC := New(cfg, uow, userRepo, segmentRepo, historyRepo)
+
+	userRepo.EXPECT().SelectUserForUpdate(userID).Return(fakeUser, nil)
+	segmentRepo.EXPECT().DeleteUserMemberships(userID, change).Return(nil)
+	historyRepo.EXPECT().UpdateUserID(userID, pkg.Pseudonym(cfg.History.PseudonymKey, userID)).Return(nil)
 	userRepo.EXPECT().DeleteUser(userID).Return(nil)
-	err := userUC.DeleteUser(userID)
+	err := userUC.DeleteUser(userID, change)
 	causeErr := pkgErr.Cause(err)
 
 	if causeErr != nil {
@@ -128,7 +162,10 @@ func TestUseCase_GetUser(t *testing.T) {
 	defer ctrl.Finish()
 
 	userRepo := mockUserRepo.NewMockRepositoryI(ctrl)
-	userUC := New(cfg, userRepo)
+	segmentRepo := mockSegmentRepo.NewMockRepositoryI(ctrl)
+	historyRepo := mockHistoryRepo.NewMockRepositoryI(ctrl)
+	uow := newUnitOfWork(ctrl, transaction.Repositories{Users: userRepo, Segments: segmentRepo, History: historyRepo})
+	userUC := New(cfg, uow, userRepo, segmentRepo, historyRepo)
 
 	userRepo.EXPECT().SelectUserByID(fakeUser.UserID).Return(fakeUser, nil)
 	response, err := userUC.GetUserByID(fakeUser.UserID)
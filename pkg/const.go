@@ -1,8 +1,14 @@
 package pkg
 
-var HistoryFolderName = "history/"
-
 const (
 	ContextHandlerLog = "handler-logger-ctx"
 	ContentTypeJSON   = "application/json"
+	ContentTypeCSV    = "text/csv"
+	ContentTypeExcel  = "application/vnd.ms-excel"
+	ContentTypeNDJSON = "application/x-ndjson"
+	// ContentTypeParquet is registered by Apache, older clients may ask for application/x-parquet.
+	ContentTypeParquet   = "application/vnd.apache.parquet"
+	ContentTypeMultipart = "multipart/form-data"
+	HeaderRequestID      = "X-Request-ID"
+	HeaderActor          = "X-Actor"
 )
@@ -2,34 +2,120 @@ package pkg
 
 import (
 	"encoding/csv"
+	pkgErrors "github.com/pkg/errors"
 	"github.com/vvinokurshin/AvitoInternship/internal/models"
-	"os"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"io"
 	"strconv"
+	"strings"
 )
 
-func WriteCSV(records []models.History, fileName string) error {
-	file, err := os.Create(HistoryFolderName + fileName)
+// utf8BOM makes Excel read the file as UTF-8 rather than in the locale code page.
+const utf8BOM = "\xEF\xBB\xBF"
+
+// HistoryCSVWriter writes history records one by one, so an export keeps only a small buffer in memory
+// whatever the number of records.
+type HistoryCSVWriter struct {
+	w             io.Writer
+	writer        *csv.Writer
+	bom           bool
+	headerWritten bool
+}
+
+func NewHistoryCSVWriter(w io.Writer, delimiter rune) *HistoryCSVWriter {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+
+	return &HistoryCSVWriter{
+		w:      w,
+		writer: writer,
+	}
+}
+
+// NewHistoryExcelWriter writes CSV that Excel opens as is: UTF-8 with BOM and CRLF line endings.
+func NewHistoryExcelWriter(w io.Writer, delimiter rune) *HistoryCSVWriter {
+	hw := NewHistoryCSVWriter(w, delimiter)
+	hw.writer.UseCRLF = true
+	hw.bom = true
+
+	return hw
+}
+
+func (hw *HistoryCSVWriter) Write(record models.History) error {
+	err := hw.writeHeader()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	writer.Comma = ';'
+	return hw.writer.Write([]string{strconv.FormatUint(record.UserID, 10), record.SegmentSlug, record.Operation,
+		record.Source, record.Variant, record.Datetime, record.Actor, record.Reason})
+}
 
-	err = writer.Write([]string{"user_id", "slug", "operation", "datetime"})
+// Flush writes the buffered records, the header is written even if there are no records.
+func (hw *HistoryCSVWriter) Flush() error {
+	err := hw.writeHeader()
 	if err != nil {
 		return err
 	}
 
-	// Записываем данные структур в CSV
-	for _, record := range records {
-		err = writer.Write([]string{strconv.FormatUint(record.UserID, 10), record.SegmentSlug, record.Operation, record.Datetime})
-		if err != nil {
+	hw.writer.Flush()
+	return hw.writer.Error()
+}
+
+func (hw *HistoryCSVWriter) writeHeader() error {
+	if hw.headerWritten {
+		return nil
+	}
+	hw.headerWritten = true
+
+	// nothing is buffered by the csv writer yet, so the BOM goes first
+	if hw.bom {
+		if _, err := io.WriteString(hw.w, utf8BOM); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return hw.writer.Write(historyColumns)
+}
+
+// ReadUserIDs reads user IDs from the first column of a CSV, a header line and a UTF-8 BOM are skipped.
+// It stops with errors.ErrTooManyUserIDs as soon as more than limit IDs are read.
+func ReadUserIDs(r io.Reader, limit int) ([]uint64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	userIDs := make([]uint64, 0)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return userIDs, nil
+		}
+		if err != nil {
+			// errors of the reader itself, such as an exceeded body limit, are passed on as they are
+			var parseErr *csv.ParseError
+			if !pkgErrors.As(err, &parseErr) {
+				return nil, pkgErrors.Wrap(err, "read user IDs")
+			}
+			return nil, pkgErrors.Wrap(errors.ErrUserIDsAreInvalid, err.Error())
+		}
+
+		field := strings.TrimSpace(record[0])
+		if line == 1 {
+			field = strings.TrimPrefix(field, utf8BOM)
+		}
+
+		userID, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, pkgErrors.Wrapf(errors.ErrUserIDsAreInvalid, "line %d", line)
+		}
+
+		if len(userIDs) == limit {
+			return nil, errors.ErrTooManyUserIDs
+		}
+		userIDs = append(userIDs, userID)
+	}
 }
@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"strings"
+	"testing"
+)
+
+func TestReadUserIDs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		file    string
+		limit   int
+		userIDs []uint64
+		err     error
+	}{
+		{file: "1\n2\n\n3\n", limit: 10, userIDs: []uint64{1, 2, 3}},
+		{file: utf8BOM + "user_id,comment\r\n7,vip\r\n 8 ,\r\n", limit: 10, userIDs: []uint64{7, 8}},
+		{file: "", limit: 10, userIDs: []uint64{}},
+		{file: "1\nuser\n", limit: 10, err: errors.ErrUserIDsAreInvalid},
+		{file: "1\n-2\n", limit: 10, err: errors.ErrUserIDsAreInvalid},
+		{file: "1\n2\n3\n", limit: 2, err: errors.ErrTooManyUserIDs},
+	}
+
+	for _, test := range tests {
+		userIDs, err := ReadUserIDs(strings.NewReader(test.file), test.limit)
+		if causeErr := pkgErrors.Cause(err); causeErr != test.err {
+			t.Errorf("[TEST] %q: expected err \"%v\", got \"%v\"", test.file, test.err, causeErr)
+			continue
+		}
+
+		if test.err == nil {
+			require.Equal(t, test.userIDs, userIDs, test.file)
+		}
+	}
+}
@@ -13,57 +13,169 @@ const (
 	MinMonth   = 1
 	MaxPercent = 100
 	MinPercent = 1
+	MinWeight  = 1
+
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 1000
+
+	DefaultSegmentUsersLimit = 100
+	MaxSegmentUsersLimit     = 1000
 )
 
 var (
-	ErrInternal          = errors.New("internal server error")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrSegmentNotFound   = errors.New("segment not found")
-	ErrUserExists        = errors.New("user with this nickname already exists")
-	ErrSegmentExists     = errors.New("segment with this slug already exists")
-	ErrInvalidURL        = errors.New("invalid url")
-	ErrInvalidForm       = errors.New("invalid form")
-	ErrInvalidParameters = errors.New("invalid parameters")
-	ErrYearIsRequired    = errors.New("year is required")
-	ErrYearIsInvalid     = errors.New("year is invalid")
-	ErrMonthIsRequired   = errors.New("month is required")
-	ErrMonthIsInvalid    = errors.New("month is invalid")
-	ErrPercentIsInvalid  = errors.New("percent is invalid")
-	ErrUntilIsInvalid    = errors.New("field until is invalid. format: YYYY-MM-DD HH:MM")
+	ErrInternal           = errors.New("internal server error")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrSegmentNotFound    = errors.New("segment not found")
+	ErrUserExists         = errors.New("user with this nickname already exists")
+	ErrSegmentExists      = errors.New("segment with this slug already exists")
+	ErrInvalidURL         = errors.New("invalid url")
+	ErrInvalidForm        = errors.New("invalid form")
+	ErrInvalidParameters  = errors.New("invalid parameters")
+	ErrYearIsRequired     = errors.New("year is required")
+	ErrYearIsInvalid      = errors.New("year is invalid")
+	ErrMonthIsRequired    = errors.New("month is required")
+	ErrMonthIsInvalid     = errors.New("month is invalid")
+	ErrPercentIsInvalid   = errors.New("percent is invalid")
+	ErrUntilIsInvalid     = errors.New("field until is invalid. format: RFC 3339 or YYYY-MM-DD HH:MM in Moscow time")
+	ErrTTLIsInvalid       = errors.New("ttl is invalid. format: positive duration like 48h or 90m")
+	ErrVariantsAreInvalid = errors.New("variants are invalid")
+	ErrRuleIsInvalid      = errors.New("rule is invalid")
+	ErrScheduleIsInvalid  = errors.New("startsAt must be before endsAt")
+	ErrLayerNotFound      = errors.New("layer not found")
+	ErrLayerExists        = errors.New("layer with this name already exists")
+	ErrLayerIsFull        = errors.New("layer has no free traffic for this percent")
+	ErrLayerConflict      = errors.New("user already belongs to another segment of this exclusive layer")
+	ErrSegmentArchived    = errors.New("segment is archived")
+	ErrSegmentNotArchived = errors.New("segment must be archived before purge")
+	ErrPurgeNotConfirmed  = errors.New("purge must be confirmed with the segment slug")
+	ErrPeriodIsInvalid    = errors.New("period is invalid. format: RFC 3339 or YYYY-MM-DD, from before to")
+	ErrCursorIsInvalid    = errors.New("cursor is invalid")
+	ErrLimitIsInvalid     = errors.New("limit is invalid")
+	ErrReportNotFound     = errors.New("report not found")
+	ErrReportNotReady     = errors.New("report is not ready")
+	ErrReportExpired      = errors.New("report has expired")
+	ErrReportQueueIsFull  = errors.New("report queue is full, try again later")
+	ErrLinkIsInvalid      = errors.New("download link is invalid or expired")
+	ErrFileNotFound       = errors.New("file not found")
+	ErrRequestIsCanceled  = errors.New("request is canceled")
+	ErrMomentIsInvalid    = errors.New("at is invalid. format: RFC 3339 or YYYY-MM-DD")
+	ErrSourceIsInvalid    = errors.New("source is invalid. supported: MANUAL, PERCENTAGE, RULE, IMPORT, API")
+	ErrDateIsInvalid      = errors.New("date is invalid. format: RFC 3339 or YYYY-MM-DD")
+	ErrFormatIsInvalid    = errors.New("format is invalid. supported: csv, excel, ndjson, parquet")
+	ErrDelimiterIsInvalid = errors.New("delimiter is invalid. it must be a single character other than a quote " +
+		"or a line break, and only for csv or excel")
+	ErrUserIDsAreInvalid = errors.New("user IDs are invalid. send a JSON array userIDs or a CSV with one ID per line")
+	ErrTooManyUserIDs    = errors.New("too many user IDs")
+	ErrBodyTypeIsInvalid = errors.New("content type is not supported. use application/json, text/csv " +
+		"or multipart/form-data")
+	ErrSegmentsContradict = errors.New("segment is both added and removed or added twice")
+	ErrRuleSegmentMembers = errors.New("members of rule segments are matched on read and not stored, " +
+		"so they cannot be listed")
+	ErrBodyIsTooLarge  = errors.New("request body is too large")
+	ErrReportLeaseLost = errors.New("report lease is lost to another replica")
 )
 
+// StatusClientClosedRequest is the nginx code for requests abandoned by the client, it is only logged.
+const StatusClientClosedRequest = 499
+
 var HttpCodes = map[string]int{
-	ErrInternal.Error():          http.StatusInternalServerError,
-	ErrUserNotFound.Error():      http.StatusNotFound,
-	ErrSegmentNotFound.Error():   http.StatusNotFound,
-	ErrUserExists.Error():        http.StatusConflict,
-	ErrSegmentExists.Error():     http.StatusConflict,
-	ErrInvalidURL.Error():        http.StatusBadRequest,
-	ErrInvalidForm.Error():       http.StatusBadRequest,
-	ErrInvalidParameters.Error(): http.StatusBadRequest,
-	ErrYearIsRequired.Error():    http.StatusBadRequest,
-	ErrYearIsInvalid.Error():     http.StatusBadRequest,
-	ErrMonthIsRequired.Error():   http.StatusBadRequest,
-	ErrMonthIsInvalid.Error():    http.StatusBadRequest,
-	ErrPercentIsInvalid.Error():  http.StatusBadRequest,
-	ErrUntilIsInvalid.Error():    http.StatusBadRequest,
+	ErrInternal.Error():           http.StatusInternalServerError,
+	ErrUserNotFound.Error():       http.StatusNotFound,
+	ErrSegmentNotFound.Error():    http.StatusNotFound,
+	ErrUserExists.Error():         http.StatusConflict,
+	ErrSegmentExists.Error():      http.StatusConflict,
+	ErrInvalidURL.Error():         http.StatusBadRequest,
+	ErrInvalidForm.Error():        http.StatusBadRequest,
+	ErrInvalidParameters.Error():  http.StatusBadRequest,
+	ErrYearIsRequired.Error():     http.StatusBadRequest,
+	ErrYearIsInvalid.Error():      http.StatusBadRequest,
+	ErrMonthIsRequired.Error():    http.StatusBadRequest,
+	ErrMonthIsInvalid.Error():     http.StatusBadRequest,
+	ErrPercentIsInvalid.Error():   http.StatusBadRequest,
+	ErrUntilIsInvalid.Error():     http.StatusBadRequest,
+	ErrTTLIsInvalid.Error():       http.StatusBadRequest,
+	ErrVariantsAreInvalid.Error(): http.StatusBadRequest,
+	ErrRuleIsInvalid.Error():      http.StatusBadRequest,
+	ErrScheduleIsInvalid.Error():  http.StatusBadRequest,
+	ErrLayerNotFound.Error():      http.StatusNotFound,
+	ErrLayerExists.Error():        http.StatusConflict,
+	ErrLayerIsFull.Error():        http.StatusConflict,
+	ErrLayerConflict.Error():      http.StatusConflict,
+	ErrSegmentArchived.Error():    http.StatusConflict,
+	ErrSegmentNotArchived.Error(): http.StatusConflict,
+	ErrPurgeNotConfirmed.Error():  http.StatusBadRequest,
+	ErrPeriodIsInvalid.Error():    http.StatusBadRequest,
+	ErrCursorIsInvalid.Error():    http.StatusBadRequest,
+	ErrLimitIsInvalid.Error():     http.StatusBadRequest,
+	ErrReportNotFound.Error():     http.StatusNotFound,
+	ErrReportNotReady.Error():     http.StatusConflict,
+	ErrReportExpired.Error():      http.StatusGone,
+	ErrReportQueueIsFull.Error():  http.StatusServiceUnavailable,
+	ErrLinkIsInvalid.Error():      http.StatusForbidden,
+	ErrFileNotFound.Error():       http.StatusNotFound,
+	ErrRequestIsCanceled.Error():  StatusClientClosedRequest,
+	ErrMomentIsInvalid.Error():    http.StatusBadRequest,
+	ErrSourceIsInvalid.Error():    http.StatusBadRequest,
+	ErrDateIsInvalid.Error():      http.StatusBadRequest,
+	ErrFormatIsInvalid.Error():    http.StatusBadRequest,
+	ErrDelimiterIsInvalid.Error(): http.StatusBadRequest,
+	ErrUserIDsAreInvalid.Error():  http.StatusBadRequest,
+	ErrTooManyUserIDs.Error():     http.StatusRequestEntityTooLarge,
+	ErrBodyTypeIsInvalid.Error():  http.StatusUnsupportedMediaType,
+	ErrSegmentsContradict.Error(): http.StatusBadRequest,
+	ErrRuleSegmentMembers.Error(): http.StatusBadRequest,
+	ErrBodyIsTooLarge.Error():     http.StatusRequestEntityTooLarge,
+	ErrReportLeaseLost.Error():    http.StatusConflict,
 }
 
 var LogLevels = map[string]logrus.Level{
-	ErrInternal.Error():          logrus.ErrorLevel,
-	ErrUserNotFound.Error():      logrus.WarnLevel,
-	ErrSegmentNotFound.Error():   logrus.WarnLevel,
-	ErrUserExists.Error():        logrus.WarnLevel,
-	ErrSegmentExists.Error():     logrus.WarnLevel,
-	ErrInvalidURL.Error():        logrus.WarnLevel,
-	ErrInvalidForm.Error():       logrus.WarnLevel,
-	ErrInvalidParameters.Error(): logrus.WarnLevel,
-	ErrYearIsRequired.Error():    logrus.WarnLevel,
-	ErrYearIsInvalid.Error():     logrus.WarnLevel,
-	ErrMonthIsRequired.Error():   logrus.WarnLevel,
-	ErrMonthIsInvalid.Error():    logrus.WarnLevel,
-	ErrPercentIsInvalid.Error():  logrus.WarnLevel,
-	ErrUntilIsInvalid.Error():    logrus.WarnLevel,
+	ErrInternal.Error():           logrus.ErrorLevel,
+	ErrUserNotFound.Error():       logrus.WarnLevel,
+	ErrSegmentNotFound.Error():    logrus.WarnLevel,
+	ErrUserExists.Error():         logrus.WarnLevel,
+	ErrSegmentExists.Error():      logrus.WarnLevel,
+	ErrInvalidURL.Error():         logrus.WarnLevel,
+	ErrInvalidForm.Error():        logrus.WarnLevel,
+	ErrInvalidParameters.Error():  logrus.WarnLevel,
+	ErrYearIsRequired.Error():     logrus.WarnLevel,
+	ErrYearIsInvalid.Error():      logrus.WarnLevel,
+	ErrMonthIsRequired.Error():    logrus.WarnLevel,
+	ErrMonthIsInvalid.Error():     logrus.WarnLevel,
+	ErrPercentIsInvalid.Error():   logrus.WarnLevel,
+	ErrUntilIsInvalid.Error():     logrus.WarnLevel,
+	ErrTTLIsInvalid.Error():       logrus.WarnLevel,
+	ErrVariantsAreInvalid.Error(): logrus.WarnLevel,
+	ErrRuleIsInvalid.Error():      logrus.WarnLevel,
+	ErrScheduleIsInvalid.Error():  logrus.WarnLevel,
+	ErrLayerNotFound.Error():      logrus.WarnLevel,
+	ErrLayerExists.Error():        logrus.WarnLevel,
+	ErrLayerIsFull.Error():        logrus.WarnLevel,
+	ErrLayerConflict.Error():      logrus.WarnLevel,
+	ErrSegmentArchived.Error():    logrus.WarnLevel,
+	ErrSegmentNotArchived.Error(): logrus.WarnLevel,
+	ErrPurgeNotConfirmed.Error():  logrus.WarnLevel,
+	ErrPeriodIsInvalid.Error():    logrus.WarnLevel,
+	ErrCursorIsInvalid.Error():    logrus.WarnLevel,
+	ErrLimitIsInvalid.Error():     logrus.WarnLevel,
+	ErrReportNotFound.Error():     logrus.WarnLevel,
+	ErrReportNotReady.Error():     logrus.WarnLevel,
+	ErrReportExpired.Error():      logrus.WarnLevel,
+	ErrReportQueueIsFull.Error():  logrus.WarnLevel,
+	ErrLinkIsInvalid.Error():      logrus.WarnLevel,
+	ErrFileNotFound.Error():       logrus.WarnLevel,
+	ErrRequestIsCanceled.Error():  logrus.InfoLevel,
+	ErrMomentIsInvalid.Error():    logrus.WarnLevel,
+	ErrSourceIsInvalid.Error():    logrus.WarnLevel,
+	ErrDateIsInvalid.Error():      logrus.WarnLevel,
+	ErrFormatIsInvalid.Error():    logrus.WarnLevel,
+	ErrDelimiterIsInvalid.Error(): logrus.WarnLevel,
+	ErrUserIDsAreInvalid.Error():  logrus.WarnLevel,
+	ErrTooManyUserIDs.Error():     logrus.WarnLevel,
+	ErrBodyTypeIsInvalid.Error():  logrus.WarnLevel,
+	ErrSegmentsContradict.Error(): logrus.WarnLevel,
+	ErrRuleSegmentMembers.Error(): logrus.WarnLevel,
+	ErrBodyIsTooLarge.Error():     logrus.WarnLevel,
+	ErrReportLeaseLost.Error():    logrus.WarnLevel,
 }
 
 func HttpCode(err error) int {
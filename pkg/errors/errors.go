@@ -1,8 +1,14 @@
 package errors
 
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
 type JSONError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
 }
 
 func (err *JSONError) Error() string {
@@ -15,3 +21,39 @@ func New(code int, err error) *JSONError {
 		Message: err.Error(),
 	}
 }
+
+// detailedError lists everything a classified error concerns, such as all unknown slugs of a request,
+// while its cause stays the classified error.
+type detailedError struct {
+	cause   error
+	details []string
+}
+
+func WithDetails(err error, details ...string) error {
+	return &detailedError{
+		cause:   err,
+		details: details,
+	}
+}
+
+func (err *detailedError) Error() string {
+	return err.cause.Error() + ": " + strings.Join(err.details, ", ")
+}
+
+func (err *detailedError) Cause() error {
+	return err.cause
+}
+
+func (err *detailedError) Unwrap() error {
+	return err.cause
+}
+
+// Details returns the details attached to the error or to an error it wraps.
+func Details(err error) []string {
+	var detailed *detailedError
+	if errors.As(err, &detailed) {
+		return detailed.details
+	}
+
+	return nil
+}
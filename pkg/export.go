@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+)
+
+// parquetRowGroupSize bounds the records the parquet writer keeps in memory before writing them out.
+const parquetRowGroupSize = 16 * 1024 * 1024
+
+// historyColumns are the columns of every export format.
+var historyColumns = []string{"user_id", "slug", "operation", "source", "variant", "datetime", "actor", "reason"}
+
+// HistoryWriter writes history records one by one in one of the export formats.
+type HistoryWriter interface {
+	Write(record models.History) error
+	// Flush writes the buffered records and completes the file.
+	Flush() error
+}
+
+func NewHistoryWriter(w io.Writer, format models.ExportFormat) (HistoryWriter, error) {
+	delimiter := format.Delimiter
+	if delimiter == 0 {
+		delimiter = models.DefaultDelimiter
+	}
+
+	switch format.Name {
+	case models.ExportFormatExcel:
+		return NewHistoryExcelWriter(w, delimiter), nil
+	case models.ExportFormatNDJSON:
+		return NewHistoryNDJSONWriter(w), nil
+	case models.ExportFormatParquet:
+		return NewHistoryParquetWriter(w)
+	default:
+		return NewHistoryCSVWriter(w, delimiter), nil
+	}
+}
+
+func ExportContentType(format models.ExportFormat) string {
+	switch format.Name {
+	case models.ExportFormatNDJSON:
+		return ContentTypeNDJSON
+	case models.ExportFormatParquet:
+		return ContentTypeParquet
+	default:
+		return ContentTypeCSV
+	}
+}
+
+// historyRow is a history record with the columns of the export.
+type historyRow struct {
+	UserID    int64  `json:"user_id" parquet:"name=user_id, type=INT64"`
+	Slug      string `json:"slug" parquet:"name=slug, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Operation string `json:"operation" parquet:"name=operation, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Source    string `json:"source" parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Variant   string `json:"variant" parquet:"name=variant, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Datetime  string `json:"datetime" parquet:"name=datetime, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Actor     string `json:"actor" parquet:"name=actor, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Reason    string `json:"reason" parquet:"name=reason, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+func newHistoryRow(record models.History) historyRow {
+	return historyRow{
+		UserID:    int64(record.UserID),
+		Slug:      record.SegmentSlug,
+		Operation: record.Operation,
+		Source:    record.Source,
+		Variant:   record.Variant,
+		Datetime:  record.Datetime,
+		Actor:     record.Actor,
+		Reason:    record.Reason,
+	}
+}
+
+// HistoryNDJSONWriter writes a JSON object per line.
+type HistoryNDJSONWriter struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func NewHistoryNDJSONWriter(w io.Writer) *HistoryNDJSONWriter {
+	buffer := bufio.NewWriter(w)
+
+	return &HistoryNDJSONWriter{
+		buffer:  buffer,
+		encoder: json.NewEncoder(buffer),
+	}
+}
+
+func (hw *HistoryNDJSONWriter) Write(record models.History) error {
+	return hw.encoder.Encode(newHistoryRow(record))
+}
+
+func (hw *HistoryNDJSONWriter) Flush() error {
+	return hw.buffer.Flush()
+}
+
+// HistoryParquetWriter writes records in row groups of parquetRowGroupSize, the file is complete after Flush.
+type HistoryParquetWriter struct {
+	writer *writer.ParquetWriter
+}
+
+func NewHistoryParquetWriter(w io.Writer) (*HistoryParquetWriter, error) {
+	parquetWriter, err := writer.NewParquetWriterFromWriter(w, new(historyRow), 1)
+	if err != nil {
+		return nil, err
+	}
+	parquetWriter.RowGroupSize = parquetRowGroupSize
+
+	return &HistoryParquetWriter{
+		writer: parquetWriter,
+	}, nil
+}
+
+func (hw *HistoryParquetWriter) Write(record models.History) error {
+	return hw.writer.Write(newHistoryRow(record))
+}
+
+func (hw *HistoryParquetWriter) Flush() error {
+	return hw.writer.WriteStop()
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"strings"
+	"testing"
+)
+
+var fakeRecords = []models.History{
+	{
+		UserID:      1,
+		SegmentSlug: "AVITO_VOICE_MESSAGES",
+		Operation:   models.OperationAdd,
+		Source:      models.SourceManual,
+		Datetime:    "2023-08-01T10:00:00Z",
+		Actor:       "pm",
+		Reason:      "launch; wave 1",
+	},
+	{
+		UserID:      2,
+		SegmentSlug: "AVITO_DISCOUNT_30",
+		Operation:   models.OperationDel,
+		Source:      models.SourceManual,
+		Datetime:    "2023-08-02T10:00:00Z",
+	},
+}
+
+func writeHistory(t *testing.T, format models.ExportFormat) []byte {
+	var file bytes.Buffer
+	writer, err := NewHistoryWriter(&file, format)
+	require.NoError(t, err)
+
+	for _, record := range fakeRecords {
+		require.NoError(t, writer.Write(record))
+	}
+	require.NoError(t, writer.Flush())
+
+	return file.Bytes()
+}
+
+func TestHistoryWriter_CSV(t *testing.T) {
+	t.Parallel()
+
+	file := writeHistory(t, models.ExportFormat{})
+
+	require.Equal(t, "user_id;slug;operation;source;variant;datetime;actor;reason\n"+
+		"1;AVITO_VOICE_MESSAGES;ADD;MANUAL;;2023-08-01T10:00:00Z;pm;\"launch; wave 1\"\n"+
+		"2;AVITO_DISCOUNT_30;DEL;MANUAL;;2023-08-02T10:00:00Z;;\n", string(file))
+}
+
+func TestHistoryWriter_Excel(t *testing.T) {
+	t.Parallel()
+
+	file := writeHistory(t, models.ExportFormat{Name: models.ExportFormatExcel, Delimiter: ','})
+
+	require.True(t, strings.HasPrefix(string(file), utf8BOM+"user_id,slug,operation,source,variant,datetime,actor,reason\r\n"))
+	require.Contains(t, string(file), "1,AVITO_VOICE_MESSAGES,ADD,MANUAL,,2023-08-01T10:00:00Z,pm,launch; wave 1\r\n")
+}
+
+func TestHistoryWriter_NDJSON(t *testing.T) {
+	t.Parallel()
+
+	file := writeHistory(t, models.ExportFormat{Name: models.ExportFormatNDJSON})
+
+	lines := strings.Split(strings.TrimSuffix(string(file), "\n"), "\n")
+	require.Len(t, lines, len(fakeRecords))
+
+	var row map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+	require.Len(t, row, len(historyColumns))
+	for _, column := range historyColumns {
+		require.Contains(t, row, column)
+	}
+	require.Equal(t, "AVITO_VOICE_MESSAGES", row["slug"])
+}
+
+func TestHistoryWriter_Parquet(t *testing.T) {
+	t.Parallel()
+
+	file := writeHistory(t, models.ExportFormat{Name: models.ExportFormatParquet})
+
+	source, err := buffer.NewBufferFile(file)
+	require.NoError(t, err)
+	parquetReader, err := reader.NewParquetReader(source, new(historyRow), 1)
+	require.NoError(t, err)
+	defer parquetReader.ReadStop()
+
+	require.Equal(t, int64(len(fakeRecords)), parquetReader.GetNumRows())
+	rows := make([]historyRow, len(fakeRecords))
+	require.NoError(t, parquetReader.Read(&rows))
+	for idx, record := range fakeRecords {
+		require.Equal(t, newHistoryRow(record), rows[idx])
+	}
+}
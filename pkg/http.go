@@ -5,9 +5,12 @@ import (
 	"fmt"
 	pkgErr "github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
 	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"mime"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,11 +28,33 @@ func (rw *ResponseWriterCode) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (rw *ResponseWriterCode) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func HandleError(w http.ResponseWriter, r *http.Request, err error) {
 	causeErr := pkgErr.Cause(err)
 	code := errors.HttpCode(causeErr)
 	customErr := errors.New(code, causeErr)
-	logLevel := errors.LogLevel(causeErr)
+	customErr.Details = errors.Details(err)
+
+	logError(r, err)
+	SendJSON(w, r, code, customErr)
+}
+
+// HandleAttachmentError reports the error as JSON unless the file has begun to be sent, then it is only logged.
+func HandleAttachmentError(aw *AttachmentWriter, r *http.Request, err error) {
+	if !aw.Started() {
+		HandleError(aw.ResponseWriter, r, err)
+		return
+	}
+
+	logError(r, err)
+}
+
+func logError(r *http.Request, err error) {
+	logLevel := errors.LogLevel(pkgErr.Cause(err))
 
 	globalLogger, ok := r.Context().Value(ContextHandlerLog).(*Logger)
 	if !ok {
@@ -38,8 +63,59 @@ func HandleError(w http.ResponseWriter, r *http.Request, err error) {
 	} else {
 		globalLogger.Log(logLevel, err)
 	}
+}
 
-	SendJSON(w, r, code, customErr)
+// exportFormatsByContentType maps the media types of the Accept header to the export formats.
+var exportFormatsByContentType = map[string]string{
+	ContentTypeCSV:          models.ExportFormatCSV,
+	ContentTypeExcel:        models.ExportFormatExcel,
+	ContentTypeNDJSON:       models.ExportFormatNDJSON,
+	"application/ndjson":    models.ExportFormatNDJSON,
+	ContentTypeParquet:      models.ExportFormatParquet,
+	"application/x-parquet": models.ExportFormatParquet,
+}
+
+// AcceptedExportFormat returns the export format of the Accept header with the highest quality, or an empty
+// string if it accepts none of them. Wildcards do not select a format.
+func AcceptedExportFormat(r *http.Request) string {
+	format := ""
+	bestQuality := 0.0
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		name, ok := exportFormatsByContentType[mediaType]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		if quality > bestQuality {
+			format = name
+			bestQuality = quality
+		}
+	}
+
+	return format
+}
+
+// RequestChange describes the membership changes made while serving the request, for history:
+// the actor comes from the auth header and the reason from the optional reason query parameter.
+func RequestChange(r *http.Request) models.Change {
+	return models.Change{
+		Actor:     r.Header.Get(HeaderActor),
+		Reason:    r.URL.Query().Get("reason"),
+		RequestID: r.Header.Get(HeaderRequestID),
+	}
 }
 
 func SendJSON(w http.ResponseWriter, r *http.Request, status int, dataStruct any) {
@@ -59,14 +135,48 @@ func SendJSON(w http.ResponseWriter, r *http.Request, status int, dataStruct any
 	}
 }
 
-func SendFile(w http.ResponseWriter, r *http.Request, fileName string) {
-	file, err := os.Open(HistoryFolderName + fileName)
-	if err != nil {
-		HandleError(w, r, pkgErr.Wrap(err, "file not found"))
-		return
+// AttachmentWriter sends what is written to it as a downloaded file. Headers are set on the first write,
+// so an error returned before any content is still sent as JSON. The file is sent in chunks as it is written,
+// and the server write timeout is lifted for it: a long export is stopped by the client going away instead.
+type AttachmentWriter struct {
+	http.ResponseWriter
+	fileName    string
+	contentType string
+	started     bool
+}
+
+// LiftDeadlines removes the server read and write timeouts for a request whose upload or processing may take
+// longer than them, such as a bulk change of segment members.
+func LiftDeadlines(w http.ResponseWriter) {
+	controller := http.NewResponseController(w)
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
+}
+
+func NewAttachmentWriter(w http.ResponseWriter, fileName, contentType string) *AttachmentWriter {
+	return &AttachmentWriter{
+		ResponseWriter: w,
+		fileName:       fileName,
+		contentType:    contentType,
+	}
+}
+
+func (aw *AttachmentWriter) Write(p []byte) (int, error) {
+	if !aw.started {
+		aw.started = true
+		aw.Header().Set("Content-Type", aw.contentType)
+		aw.Header().Set("Content-Disposition", "attachment; filename="+aw.fileName)
+		_ = http.NewResponseController(aw.ResponseWriter).SetWriteDeadline(time.Time{})
 	}
-	defer file.Close()
 
-	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
-	http.ServeContent(w, r, fileName, time.Now(), file)
+	return aw.ResponseWriter.Write(p)
+}
+
+func (aw *AttachmentWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// Started reports whether the file has begun to be sent, after that an error can only break the download.
+func (aw *AttachmentWriter) Started() bool {
+	return aw.started
 }
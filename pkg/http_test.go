@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAttachmentWriter_LongDownload(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aw := NewAttachmentWriter(NewResponseWriterCode(w), "history.csv", ContentTypeCSV)
+		for idx := 0; idx < 3; idx++ {
+			aw.Write([]byte("row\n"))
+			http.NewResponseController(aw).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, "row\nrow\nrow\n", string(body))
+	require.Equal(t, "attachment; filename=history.csv", response.Header.Get("Content-Disposition"))
+}
+
+func TestAcceptedExportFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		accept string
+		format string
+	}{
+		{accept: "", format: ""},
+		{accept: "*/*", format: ""},
+		{accept: "application/json", format: ""},
+		{accept: "text/csv", format: models.ExportFormatCSV},
+		{accept: "application/vnd.ms-excel", format: models.ExportFormatExcel},
+		{accept: "application/json, application/x-ndjson", format: models.ExportFormatNDJSON},
+		{accept: "text/csv;q=0.5, application/x-parquet;q=0.9", format: models.ExportFormatParquet},
+		{accept: "application/vnd.apache.parquet;q=0", format: ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/history", nil)
+		r.Header.Set("Accept", test.accept)
+
+		require.Equal(t, test.format, AcceptedExportFormat(r), test.accept)
+	}
+}
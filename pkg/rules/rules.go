@@ -0,0 +1,419 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Expr is a parsed targeting rule, e.g. `city in ["Moscow", "Kazan"] and platform == "ios"`.
+//
+// Supported syntax: comparisons (==, !=, <, <=, >, >=), `in [...]` and `not in [...]`,
+// combined with `and`, `or`, `not` and parentheses. Values are string or number literals.
+// Attribute values are compared as numbers when both sides are numeric and as strings otherwise,
+// so ISO dates like "2023-08-15" compare chronologically. A comparison on a missing attribute is false.
+type Expr interface {
+	Eval(attributes map[string]string) bool
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (e orExpr) Eval(attributes map[string]string) bool {
+	return e.left.Eval(attributes) || e.right.Eval(attributes)
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (e andExpr) Eval(attributes map[string]string) bool {
+	return e.left.Eval(attributes) && e.right.Eval(attributes)
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (e notExpr) Eval(attributes map[string]string) bool {
+	return !e.expr.Eval(attributes)
+}
+
+type compareExpr struct {
+	attribute string
+	op        string
+	value     string
+}
+
+func (e compareExpr) Eval(attributes map[string]string) bool {
+	actual, ok := attributes[e.attribute]
+	if !ok {
+		return false
+	}
+
+	cmp := compare(actual, e.value)
+	switch e.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+type inExpr struct {
+	attribute string
+	values    []string
+	negate    bool
+}
+
+func (e inExpr) Eval(attributes map[string]string) bool {
+	actual, ok := attributes[e.attribute]
+	if !ok {
+		return false
+	}
+
+	for _, value := range e.values {
+		if compare(actual, value) == 0 {
+			return !e.negate
+		}
+	}
+
+	return e.negate
+}
+
+func compare(a, b string) int {
+	numA, errA := strconv.ParseFloat(a, 64)
+	numB, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case numA < numB:
+			return -1
+		case numA > numB:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Parse compiles a rule expression.
+func Parse(rule string) (Expr, error) {
+	tokens, err := tokenize(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return expr, nil
+}
+
+// maxCachedRules bounds the cache of parsed rules, it is emptied when full.
+const maxCachedRules = 1024
+
+var cache = struct {
+	sync.RWMutex
+	exprs map[string]Expr
+}{exprs: make(map[string]Expr)}
+
+// cached returns the parsed rule, parsing it only on the first call. Unparsable rules are cached as nil.
+func cached(rule string) Expr {
+	cache.RLock()
+	expr, ok := cache.exprs[rule]
+	cache.RUnlock()
+	if ok {
+		return expr
+	}
+
+	expr, _ = Parse(rule)
+
+	cache.Lock()
+	if len(cache.exprs) >= maxCachedRules {
+		cache.exprs = make(map[string]Expr)
+	}
+	cache.exprs[rule] = expr
+	cache.Unlock()
+
+	return expr
+}
+
+// Match reports whether the attributes satisfy the rule; an unparsable rule matches nothing.
+// Rules are parsed once and reused across calls.
+func Match(rule string, attributes map[string]string) bool {
+	expr := cached(rule)
+	if expr == nil {
+		return false
+	}
+
+	return expr.Eval(attributes)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(rule string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(rule)
+
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '(' || r == ')' || r == '[' || r == ']' || r == ',':
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), pos: pos})
+			pos++
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if pos+1 < len(runes) && runes[pos+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("unknown operator %q at position %d", op, pos)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: pos})
+			pos += len(op)
+		case r == '"':
+			end := pos + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", pos)
+			}
+			value, err := strconv.Unquote(string(runes[pos : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", pos)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: pos})
+			pos = end + 1
+		case unicode.IsDigit(r) || r == '-':
+			end := pos + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			if _, err := strconv.ParseFloat(string(runes[pos:end]), 64); err != nil {
+				return nil, fmt.Errorf("invalid number at position %d", pos)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[pos:end]), pos: pos})
+			pos = end
+		case unicode.IsLetter(r) || r == '_':
+			end := pos + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) ||
+				runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[pos:end]), pos: pos})
+			pos = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", r, pos)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *parser) expectPunct(punct string) error {
+	tok := p.next()
+	if tok.kind != tokenPunct || tok.text != punct {
+		return fmt.Errorf("expected %q at position %d", punct, tok.pos)
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.isKeyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	if tok.kind == tokenPunct && tok.text == "(" {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	if tok.kind != tokenIdent || isReserved(tok.text) {
+		return nil, fmt.Errorf("expected attribute name at position %d", tok.pos)
+	}
+
+	attribute := tok.text
+	if p.peek().kind == tokenOp {
+		op := p.next().text
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{attribute: attribute, op: op, value: value}, nil
+	}
+
+	negate := false
+	if p.isKeyword("not") {
+		p.next()
+		negate = true
+	}
+	if !p.isKeyword("in") {
+		return nil, fmt.Errorf("expected operator after %q at position %d", attribute, p.peek().pos)
+	}
+	p.next()
+
+	values, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+
+	return inExpr{attribute: attribute, values: values, negate: negate}, nil
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if err := p.expectPunct("["); err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		tok := p.next()
+		if tok.kind == tokenPunct && tok.text == "]" {
+			return values, nil
+		}
+		if tok.kind != tokenPunct || tok.text != "," {
+			return nil, fmt.Errorf("expected \",\" or \"]\" at position %d", tok.pos)
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	tok := p.next()
+	if tok.kind != tokenString && tok.kind != tokenNumber {
+		return "", fmt.Errorf("expected value at position %d", tok.pos)
+	}
+
+	return tok.text, nil
+}
+
+func isReserved(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "in":
+		return true
+	}
+
+	return false
+}
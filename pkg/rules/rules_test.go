@@ -0,0 +1,80 @@
+package rules
+
+import (
+	"testing"
+)
+
+func TestParse_Eval(t *testing.T) {
+	attributes := map[string]string{
+		"city":       "Kazan",
+		"platform":   "ios",
+		"age":        "27",
+		"registered": "2023-08-15",
+	}
+
+	cases := []struct {
+		rule     string
+		expected bool
+	}{
+		{`city in ["Moscow", "Kazan"] and platform == "ios"`, true},
+		{`city in ["Moscow"] or platform == "android"`, false},
+		{`city not in ["Moscow"]`, true},
+		{`not (platform == "ios")`, false},
+		{`age >= 18 and age < 30`, true},
+		{`age > 100`, false},
+		{`registered < "2023-09-01"`, true},
+		{`country == "RU"`, false},
+		{`country != "RU"`, false},
+		{`platform != "android" AND city == "Kazan"`, true},
+	}
+
+	for _, c := range cases {
+		expr, err := Parse(c.rule)
+		if err != nil {
+			t.Errorf("[TEST] simple: unexpected err \"%v\" for rule %s", err, c.rule)
+			continue
+		}
+
+		if got := expr.Eval(attributes); got != c.expected {
+			t.Errorf("[TEST] simple: rule %s: expected %v, got %v", c.rule, c.expected, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	rules := []string{
+		``,
+		`city`,
+		`city = "Moscow"`,
+		`city in "Moscow"`,
+		`city in ["Moscow"`,
+		`(city == "Moscow"`,
+		`city == "Moscow" and`,
+		`city == Moscow`,
+		`city == "Moscow`,
+	}
+
+	for _, rule := range rules {
+		if _, err := Parse(rule); err == nil {
+			t.Errorf("[TEST] simple: expected error for rule %s", rule)
+		}
+	}
+}
+
+func TestMatch_Cached(t *testing.T) {
+	rule := `platform == "ios"`
+
+	if !Match(rule, map[string]string{"platform": "ios"}) {
+		t.Errorf("[TEST] simple: rule %s: expected %v, got %v", rule, true, false)
+	}
+	if Match(rule, map[string]string{"platform": "android"}) {
+		t.Errorf("[TEST] simple: rule %s: expected %v, got %v", rule, false, true)
+	}
+	if _, ok := cache.exprs[rule]; !ok {
+		t.Errorf("[TEST] simple: expected rule %s to be cached", rule)
+	}
+
+	if Match(`city ==`, map[string]string{"city": "Kazan"}) {
+		t.Errorf("[TEST] simple: expected unparsable rule to match nothing")
+	}
+}
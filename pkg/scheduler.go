@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+)
+
+// Deadlines runs a task at every scheduled moment. A moment that is already scheduled is ignored,
+// so overlapping polls can schedule the same deadlines again.
+type Deadlines struct {
+	mu        sync.Mutex
+	scheduled map[int64]*time.Timer
+	task      func()
+}
+
+func NewDeadlines(task func()) *Deadlines {
+	return &Deadlines{
+		scheduled: make(map[int64]*time.Timer),
+		task:      task,
+	}
+}
+
+func (d *Deadlines) Schedule(moment time.Time) {
+	key := moment.UnixNano()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.scheduled[key]; ok {
+		return
+	}
+
+	d.scheduled[key] = time.AfterFunc(time.Until(moment), func() {
+		d.mu.Lock()
+		delete(d.scheduled, key)
+		d.mu.Unlock()
+
+		d.task()
+	})
+}
+
+// Pending returns the number of scheduled moments that have not fired yet.
+func (d *Deadlines) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.scheduled)
+}
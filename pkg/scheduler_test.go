@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadlines_Schedule(t *testing.T) {
+	var runs int32
+	done := make(chan struct{}, 2)
+	deadlines := NewDeadlines(func() {
+		atomic.AddInt32(&runs, 1)
+		done <- struct{}{}
+	})
+
+	moment := time.Now().Add(20 * time.Millisecond)
+	deadlines.Schedule(moment)
+	deadlines.Schedule(moment)
+	deadlines.Schedule(time.Now().Add(-time.Second))
+
+	if pending := deadlines.Pending(); pending != 2 {
+		t.Errorf("[TEST] simple: expected %d pending deadlines, got %d", 2, pending)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("[TEST] simple: deadline did not fire")
+		}
+	}
+
+	if got := atomic.LoadInt32(&runs); got != 2 {
+		t.Errorf("[TEST] simple: expected %d runs, got %d", 2, got)
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/pkg"
+	"github.com/vvinokurshin/AvitoInternship/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Local keeps files in a directory and signs links to the route that serves them.
+type Local struct {
+	dir     string
+	baseURL string
+	key     []byte
+}
+
+// NewLocal creates the directory if needed. Without a key links are signed with a random one,
+// so they stop working after a restart.
+func NewLocal(dir, baseURL, key string) (*Local, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, pkgErrors.Wrap(err, "create storage directory")
+	}
+
+	local := &Local{
+		dir:     dir,
+		baseURL: baseURL,
+		key:     []byte(key),
+	}
+	if key == "" {
+		local.key = make([]byte, 32)
+		if _, err = rand.Read(local.key); err != nil {
+			return nil, pkgErrors.Wrap(err, "generate url key")
+		}
+	}
+
+	return local, nil
+}
+
+func (l *Local) Create(name string) (io.WriteCloser, error) {
+	if !validName(name) {
+		return nil, pkgErrors.Errorf("invalid object name %q", name)
+	}
+
+	return os.Create(filepath.Join(l.dir, name))
+}
+
+func (l *Local) Open(name string) (io.ReadCloser, error) {
+	if !validName(name) {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(filepath.Join(l.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (l *Local) Remove(name string) error {
+	if !validName(name) {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(l.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Local) URL(name string, ttl time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.sign(name, expires))
+
+	return l.baseURL + "/" + url.PathEscape(name) + "?" + query.Encode(), nil
+}
+
+// Verify checks the signature and expiry of a link made by URL.
+func (l *Local) Verify(name, expires, signature string) error {
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > deadline {
+		return errors.ErrLinkIsInvalid
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(l.sign(name, expires))) {
+		return errors.ErrLinkIsInvalid
+	}
+
+	return nil
+}
+
+func (l *Local) sign(name, expires string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(name + "\n" + expires))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves the file named by the route variable name to the holders of a link made by URL.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	query := r.URL.Query()
+
+	err := l.Verify(name, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		pkg.HandleError(w, r, err)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(l.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			pkg.HandleError(w, r, errors.ErrFileNotFound)
+			return
+		}
+
+		pkg.HandleError(w, r, pkgErrors.WithMessage(errors.ErrInternal, err.Error()))
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		pkg.HandleError(w, r, pkgErrors.WithMessage(errors.ErrInternal, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	http.ServeContent(w, r, name, stat.ModTime(), file)
+}
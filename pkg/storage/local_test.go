@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeObject(t *testing.T, store Storage, name, content string) {
+	file, err := store.Create(name)
+	if err != nil {
+		t.Fatalf("error while creating object: %v", err)
+	}
+	if _, err = file.Write([]byte(content)); err != nil {
+		t.Fatalf("error while writing object: %v", err)
+	}
+	if err = file.Close(); err != nil {
+		t.Fatalf("error while closing object: %v", err)
+	}
+}
+
+func readObject(t *testing.T, store Storage, name string) string {
+	file, err := store.Open(name)
+	if err != nil {
+		t.Fatalf("error while opening object: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("error while reading object: %v", err)
+	}
+
+	return string(content)
+}
+
+func TestLocal_Objects(t *testing.T) {
+	t.Parallel()
+
+	local, err := NewLocal(t.TempDir(), "/api/v1/files", "secret")
+	require.NoError(t, err)
+
+	writeObject(t, local, "report.csv", "data")
+	require.Equal(t, "data", readObject(t, local, "report.csv"))
+
+	require.NoError(t, local.Remove("report.csv"))
+	if _, err = local.Open("report.csv"); err != ErrNotFound {
+		t.Errorf("[TEST] simple: expected err \"%v\", got \"%v\"", ErrNotFound, err)
+	}
+	require.NoError(t, local.Remove("report.csv"))
+
+	if _, err = local.Create("../report.csv"); err == nil {
+		t.Errorf("[TEST] simple: expected err for name outside of the directory, got nil")
+	}
+}
+
+func TestLocal_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	local, err := NewLocal(t.TempDir(), "/api/v1/files", "secret")
+	require.NoError(t, err)
+	writeObject(t, local, "report.csv", "data")
+
+	link, err := local.URL("report.csv", time.Hour)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(link, "/api/v1/files/report.csv?"))
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	tests := []struct {
+		name   string
+		link   string
+		status int
+	}{
+		{name: "valid", link: link, status: http.StatusOK},
+		{name: "tampered", link: strings.Replace(link, "signature=", "signature=0", 1), status: http.StatusForbidden},
+		{
+			name:   "expired",
+			link:   "/api/v1/files/report.csv?expires=" + expired + "&signature=" + local.sign("report.csv", expired),
+			status: http.StatusForbidden,
+		},
+		{name: "other file", link: strings.Replace(link, "report.csv", "other.csv", 1), status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.link, nil)
+		name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/api/v1/files/"))
+		r = mux.SetURLVars(r, map[string]string{
+			"name": name,
+		})
+		w := httptest.NewRecorder()
+
+		local.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("[TEST] %s: Expected status %d, got %d ", test.name, test.status, w.Code)
+		} else if test.status == http.StatusOK {
+			require.Equal(t, "data", w.Body.String())
+			require.Equal(t, "attachment; filename=report.csv", w.Header().Get("Content-Disposition"))
+		}
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	t.Parallel()
+
+	first := UniqueName("history-2023-8.csv")
+	second := UniqueName("history-2023-8.csv")
+
+	require.NotEqual(t, first, second)
+	require.True(t, strings.HasPrefix(first, "history-2023-8-"))
+	require.True(t, strings.HasSuffix(first, ".csv"))
+}
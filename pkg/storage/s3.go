@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	pkgErrors "github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3Service         = "s3"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DateLayout      = "20060102T150405Z"
+	s3MaxURLTTL       = 7 * 24 * time.Hour
+	// s3RequestTimeout bounds waiting for a response, an upload also gets a second per s3MinUploadRate bytes.
+	s3RequestTimeout = time.Minute
+	s3MinUploadRate  = 1 << 20
+)
+
+// S3 keeps files in a bucket of an S3-compatible service (AWS, MinIO, ...), addressed in path style
+// and signed with Signature Version 4.
+type S3 struct {
+	endpoint *url.URL
+	bucket   string
+	signer   signer
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(endpoint, region, bucket, accessKey, secretKey string) (*S3, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, pkgErrors.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, pkgErrors.New("s3 bucket is required")
+	}
+
+	return &S3{
+		endpoint: endpointURL,
+		bucket:   bucket,
+		signer: signer{
+			accessKey: accessKey,
+			secretKey: secretKey,
+			region:    region,
+			service:   s3Service,
+		},
+		client: newS3Client(),
+		now:    time.Now,
+	}, nil
+}
+
+// newS3Client has no overall timeout, which would cut off large uploads and downloads: the server gets
+// s3RequestTimeout to answer, and each request bounds the whole transfer with its context when needed.
+func newS3Client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = s3RequestTimeout
+
+	return &http.Client{Transport: transport}
+}
+
+func uploadTimeout(size int64) time.Duration {
+	return s3RequestTimeout + time.Duration(size/s3MinUploadRate)*time.Second
+}
+
+// Create spools the object to a temporary file, because S3 needs the size of the object before the upload.
+func (s *S3) Create(name string) (io.WriteCloser, error) {
+	if !validName(name) {
+		return nil, pkgErrors.Errorf("invalid object name %q", name)
+	}
+
+	file, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return nil, pkgErrors.Wrap(err, "create temporary file")
+	}
+
+	return &s3Writer{s3: s, name: name, file: file}, nil
+}
+
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	// the body is read by the caller, so the download is not bounded here
+	response, err := s.do(context.Background(), http.MethodGet, name, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response.Body, nil
+	case http.StatusNotFound:
+		response.Body.Close()
+		return nil, ErrNotFound
+	default:
+		response.Body.Close()
+		return nil, pkgErrors.Errorf("get object %s: unexpected status %s", name, response.Status)
+	}
+}
+
+func (s *S3) Remove(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	response, err := s.do(ctx, http.MethodDelete, name, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK &&
+		response.StatusCode != http.StatusNotFound {
+		return pkgErrors.Errorf("delete object %s: unexpected status %s", name, response.Status)
+	}
+
+	return nil
+}
+
+// URL presigns a GET request of the object, S3 accepts links valid for at most 7 days.
+func (s *S3) URL(name string, ttl time.Duration) (string, error) {
+	if ttl > s3MaxURLTTL {
+		ttl = s3MaxURLTTL
+	}
+
+	return s.presign(http.MethodGet, s.objectURL(name), ttl, s.now()), nil
+}
+
+func (s *S3) objectURL(name string) *url.URL {
+	objectURL := *s.endpoint
+	objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + s.bucket + "/" + name
+	objectURL.RawPath = ""
+	objectURL.RawQuery = ""
+
+	return &objectURL
+}
+
+func (s *S3) do(ctx context.Context, method, name string, body io.Reader, size int64) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, s.objectURL(name).String(), body)
+	if err != nil {
+		return nil, pkgErrors.Wrap(err, "create s3 request")
+	}
+	if body != nil {
+		request.ContentLength = size
+	}
+
+	s.sign(request, s.now())
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, pkgErrors.Wrap(err, "send s3 request")
+	}
+
+	return response, nil
+}
+
+// sign adds the Authorization header, the payload is not signed to upload objects without reading them twice.
+func (s *S3) sign(request *http.Request, now time.Time) {
+	amzDate := now.UTC().Format(s3DateLayout)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headers := map[string]string{
+		"host":                 request.URL.Host,
+		"x-amz-content-sha256": s3UnsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	request.Header.Set("Authorization", s.signer.authorization(request.Method, request.URL, headers,
+		s3UnsignedPayload, now))
+}
+
+func (s *S3) presign(method string, objectURL *url.URL, ttl time.Duration, now time.Time) string {
+	scope := s.signer.scope(now)
+	query := objectURL.Query()
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.signer.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.UTC().Format(s3DateLayout))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(map[string]string{"host": objectURL.Host})
+	canonicalRequest := strings.Join([]string{method, canonicalURI(objectURL), canonicalQuery(query),
+		canonicalHeaders, signedHeaders, s3UnsignedPayload}, "\n")
+
+	signedURL := *objectURL
+	signedURL.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" +
+		s.signer.signature(now, scope, canonicalRequest)
+
+	return signedURL.String()
+}
+
+// signer computes Signature Version 4 of any AWS service, so it can be checked against the published test suite.
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// authorization returns the Authorization header of a request whose headers are all signed;
+// payloadHash is the hex SHA-256 of the body or UNSIGNED-PAYLOAD.
+func (s signer) authorization(method string, requestURL *url.URL, headers map[string]string, payloadHash string,
+	now time.Time) string {
+	signedHeaders, canonicalHeaders := canonicalHeaders(headers)
+	canonicalRequest := strings.Join([]string{method, canonicalURI(requestURL),
+		canonicalQuery(requestURL.Query()), canonicalHeaders, signedHeaders, payloadHash}, "\n")
+
+	scope := s.scope(now)
+	return s3Algorithm + " Credential=" + s.accessKey + "/" + scope + ", SignedHeaders=" + signedHeaders +
+		", Signature=" + s.signature(now, scope, canonicalRequest)
+}
+
+func (s signer) scope(now time.Time) string {
+	return now.UTC().Format("20060102") + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+func (s signer) signature(now time.Time, scope, canonicalRequest string) string {
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + now.UTC().Format(s3DateLayout) + "\n" + scope + "\n" +
+		hex.EncodeToString(hashedRequest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.UTC().Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func canonicalHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+func canonicalURI(objectURL *url.URL) string {
+	segments := strings.Split(objectURL.Path, "/")
+	for idx, segment := range segments {
+		segments[idx] = uriEncode(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes everything except the unreserved characters of RFC 3986, as Signature Version 4 requires.
+func uriEncode(value string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			encoded.WriteByte(b)
+			continue
+		}
+		encoded.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+	}
+
+	return encoded.String()
+}
+
+type s3Writer struct {
+	s3   *S3
+	name string
+	file *os.File
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+
+	size, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return pkgErrors.Wrap(err, "get size of upload")
+	}
+	if _, err = w.file.Seek(0, io.SeekStart); err != nil {
+		return pkgErrors.Wrap(err, "rewind upload")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout(size))
+	defer cancel()
+
+	response, err := w.s3.do(ctx, http.MethodPut, w.name, w.file, size)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return pkgErrors.Errorf("put object %s: unexpected status %s", w.name, response.Status)
+	}
+
+	return nil
+}
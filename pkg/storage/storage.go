@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/vvinokurshin/AvitoInternship/internal/config"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var ErrNotFound = pkgErrors.New("object not found")
+
+// Storage keeps generated files: a local directory for a single instance or an S3-compatible bucket
+// shared by replicas.
+type Storage interface {
+	// Create opens the object for writing, it is stored when the writer is closed.
+	Create(name string) (io.WriteCloser, error)
+	Open(name string) (io.ReadCloser, error)
+	Remove(name string) error
+	// URL returns a signed link to download the object that is valid for ttl.
+	URL(name string, ttl time.Duration) (string, error)
+}
+
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case BackendLocal, "":
+		return NewLocal(cfg.Storage.LocalDir, cfg.Routes.RoutePrefix+cfg.Routes.RouteFiles, cfg.Storage.URLKey)
+	case BackendS3:
+		return NewS3(cfg.Storage.S3Endpoint, cfg.Storage.S3Region, cfg.Storage.S3Bucket, cfg.Storage.S3AccessKey,
+			cfg.Storage.S3SecretKey)
+	default:
+		return nil, pkgErrors.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// UniqueName keeps the base and extension of the name and adds the time and a random suffix,
+// so files built for the same parameters never overwrite each other.
+func UniqueName(name string) string {
+	ext := path.Ext(name)
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return strings.TrimSuffix(name, ext) + "-" + time.Now().UTC().Format("20060102T150405") + "-" +
+		hex.EncodeToString(suffix) + ext
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
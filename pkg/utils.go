@@ -1,20 +1,150 @@
 package pkg
 
 import (
-	"math/rand"
-	"time"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/vvinokurshin/AvitoInternship/internal/models"
+	"github.com/vvinokurshin/AvitoInternship/pkg/rules"
+	"strconv"
 )
 
-func PercentageIDs(IDs []uint64, percent int) []uint64 {
-	newCount := len(IDs) * percent / 100
-	newIDs := make([]uint64, newCount)
+const BucketsCount = 100
 
-	rand.Seed(time.Now().UnixNano())
-	randIndexes := rand.Perm(len(IDs))[:newCount]
+func hash(salt string, userID uint64) uint64 {
+	sum := sha256.Sum256([]byte(salt + ":" + strconv.FormatUint(userID, 10)))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Bucket deterministically maps a user to one of BucketsCount buckets for the given salt.
+func Bucket(salt string, userID uint64) int {
+	return int(hash(salt, userID) % BucketsCount)
+}
 
-	for i, index := range randIndexes {
-		newIDs[i] = IDs[index]
+// InPercentage reports whether the user falls into the segment's slice of traffic.
+// Segments of one layer share the layer salt and occupy disjoint bucket ranges starting at LayerOffset.
+func InPercentage(segment *models.Segment, userID uint64, percent int) bool {
+	bucket := Bucket(segment.Salt, userID)
+	return bucket >= segment.LayerOffset && bucket < segment.LayerOffset+percentBuckets(percent)
+}
+
+func percentBuckets(percent int) int {
+	return percent * BucketsCount / 100
+}
+
+func PercentageIDs(IDs []uint64, segment *models.Segment, percent int) []uint64 {
+	newIDs := make([]uint64, 0, len(IDs)*percent/100)
+	for _, ID := range IDs {
+		if InPercentage(segment, ID, percent) {
+			newIDs = append(newIDs, ID)
+		}
 	}
 
 	return newIDs
 }
+
+// FreeLayerOffset finds the first bucket range of the given percent not occupied by other segments of the layer.
+func FreeLayerOffset(layerSegments []models.Segment, percent int) (int, bool) {
+	for offset := 0; offset+percentBuckets(percent) <= BucketsCount; offset++ {
+		if LayerRangeIsFree(layerSegments, 0, offset, percent) {
+			return offset, true
+		}
+	}
+
+	return 0, false
+}
+
+// LayerRangeIsFree checks that [offset, offset+percent) does not overlap other segments of the layer.
+func LayerRangeIsFree(layerSegments []models.Segment, segmentID uint64, offset, percent int) bool {
+	end := offset + percentBuckets(percent)
+	if end > BucketsCount {
+		return false
+	}
+
+	for _, segment := range layerSegments {
+		if segment.SegmentID == segmentID || segment.Percent == nil {
+			continue
+		}
+
+		if offset < segment.LayerOffset+percentBuckets(*segment.Percent) && segment.LayerOffset < end {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchingSegments returns the dynamic segments whose rule and rollout both cover the user.
+func MatchingSegments(segments []models.Segment, user *models.User) []models.Segment {
+	result := make([]models.Segment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.Percent == nil && segment.Rule == nil {
+			continue
+		}
+		if segment.Rule != nil && !rules.Match(*segment.Rule, user.Attributes) {
+			continue
+		}
+		if segment.Percent != nil && !InPercentage(&segment, user.UserID, *segment.Percent) {
+			continue
+		}
+
+		result = append(result, segment)
+	}
+
+	return result
+}
+
+// RuleSegments returns the rule segments matching the user. Only they are evaluated on read: percentage
+// memberships are stored when the segment, the user or the rollout changes, so they can be removed by hand.
+func RuleSegments(segments []models.Segment, user *models.User) []models.Segment {
+	result := make([]models.Segment, 0)
+	for _, segment := range MatchingSegments(segments, user) {
+		if segment.Rule != nil {
+			result = append(result, segment)
+		}
+	}
+
+	return result
+}
+
+// PickVariant deterministically assigns the user one of the weighted variants.
+// The variant hash is salted separately so the choice does not correlate with the rollout bucket.
+func PickVariant(salt string, userID uint64, variants []models.Variant) string {
+	totalWeight := 0
+	for _, variant := range variants {
+		totalWeight += variant.Weight
+	}
+	if totalWeight == 0 {
+		return ""
+	}
+
+	point := int(hash(salt+":variant", userID) % uint64(totalWeight))
+	for _, variant := range variants {
+		if point < variant.Weight {
+			return variant.Name
+		}
+		point -= variant.Weight
+	}
+
+	return ""
+}
+
+func SegmentMembers(segment *models.Segment, userIDs []uint64) []models.SegmentMember {
+	members := make([]models.SegmentMember, len(userIDs))
+	for idx, userID := range userIDs {
+		members[idx].UserID = userID
+		members[idx].Variant = PickVariant(segment.Salt, userID, segment.Variants)
+	}
+
+	return members
+}
+
+// PseudonymBase keeps pseudonymous user IDs far above any real bigserial value.
+const PseudonymBase = uint64(1) << 62
+
+// Pseudonym maps a deleted user to a stable ID keyed by a secret, so history stays joinable without the real ID.
+func Pseudonym(key string, userID uint64) uint64 {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strconv.FormatUint(userID, 10)))
+	return PseudonymBase | binary.BigEndian.Uint64(mac.Sum(nil)[:8])&(PseudonymBase-1)
+}
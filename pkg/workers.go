@@ -0,0 +1,32 @@
+package pkg
+
+// WorkerPool runs submitted tasks on a fixed number of goroutines, tasks wait for a free worker in a bounded queue.
+type WorkerPool struct {
+	tasks chan func()
+}
+
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	pool := &WorkerPool{
+		tasks: make(chan func(), queueSize),
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range pool.tasks {
+				task()
+			}
+		}()
+	}
+
+	return pool
+}
+
+// Submit queues the task and reports false when the queue is full.
+func (p *WorkerPool) Submit(task func()) bool {
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerPool_Submit(t *testing.T) {
+	done := make(chan struct{})
+	pool := NewWorkerPool(1, 1)
+
+	release := make(chan struct{})
+	if !pool.Submit(func() { <-release }) {
+		t.Fatalf("[TEST] simple: expected task to be accepted")
+	}
+
+	// the only worker is busy, so the next task waits in the queue and fills it
+	deadline := time.Now().Add(time.Second)
+	for !pool.Submit(func() { close(done) }) {
+		if time.Now().After(deadline) {
+			t.Fatalf("[TEST] simple: expected task to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if pool.Submit(func() {}) {
+		t.Errorf("[TEST] simple: expected task to be rejected by the full queue")
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("[TEST] simple: queued task did not run")
+	}
+}